@@ -0,0 +1,301 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/vitess.io/vitess-bot/go/dryrun"
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+const (
+	// adminAPIRoute is the prefix of the JSON admin endpoints:
+	//
+	//	GET  /api/admin/jobs[?status=<status>]
+	//	GET  /api/admin/jobs/<id>
+	//	POST /api/admin/jobs/<id>/retry
+	//	POST /api/admin/jobs/<id>/cancel
+	//	GET  /api/admin/dry-run
+	adminAPIRoute = "/api/admin/"
+	// adminDashboardRoute serves an HTML page listing the jobs, with buttons
+	// to retry or cancel them.
+	adminDashboardRoute = "/admin/"
+)
+
+// AdminHandler serves the admin API and dashboard, giving visibility on the
+// jobs of the queue. Every request must be authenticated with the admin token,
+// either as a bearer token or as the password of basic authentication.
+type AdminHandler struct {
+	jobs   *queue.Queue
+	token  string
+	dryRun *dryrun.Recorder
+}
+
+func NewAdminHandler(jobs *queue.Queue, token string) (*AdminHandler, error) {
+	if token == "" {
+		return nil, errors.New("admin token must not be empty")
+	}
+
+	return &AdminHandler{
+		jobs:  jobs,
+		token: token,
+	}, nil
+}
+
+// WithDryRun exposes the mutations recorded by rec, if not nil.
+func (h *AdminHandler) WithDryRun(rec *dryrun.Recorder) *AdminHandler {
+	h.dryRun = rec
+	return h
+}
+
+// Register adds the admin routes to mux.
+func (h *AdminHandler) Register(mux *http.ServeMux) {
+	mux.Handle(adminAPIRoute, h.authenticated(http.HandlerFunc(h.serveAPI)))
+	mux.Handle(adminDashboardRoute, h.authenticated(http.HandlerFunc(h.serveDashboard)))
+}
+
+func (h *AdminHandler) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, password, ok := r.BasicAuth(); ok {
+			token = password
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="vitess-bot admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jobSummary is a job without its event payload, which can be large.
+type jobSummary struct {
+	*queue.Job
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func summarize(job *queue.Job) jobSummary {
+	return jobSummary{Job: job}
+}
+
+// jobAction parses `<prefix>jobs/<id>[/<action>]` paths.
+func jobAction(path, prefix string) (id, action string, ok bool) {
+	rest, ok := strings.CutPrefix(path, prefix+"jobs")
+	if !ok {
+		return "", "", false
+	}
+
+	rest = strings.Trim(rest, "/")
+	if rest == "" {
+		return "", "", true
+	}
+
+	id, action, _ = strings.Cut(rest, "/")
+	return id, action, true
+}
+
+func (h *AdminHandler) serveAPI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == adminAPIRoute+"dry-run" && r.Method == http.MethodGet {
+		if h.dryRun == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "dry-run mode is disabled"})
+			return
+		}
+		writeJSON(w, http.StatusOK, h.dryRun.Mutations())
+		return
+	}
+
+	id, action, ok := jobAction(r.URL.Path, adminAPIRoute)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		status := queue.Status(r.URL.Query().Get("status"))
+
+		summaries := []jobSummary{}
+		for _, job := range h.jobs.Jobs() {
+			if status == "" || job.Status == status {
+				summaries = append(summaries, summarize(job))
+			}
+		}
+		writeJSON(w, http.StatusOK, summaries)
+	case id != "" && action == "" && r.Method == http.MethodGet:
+		job, err := h.jobs.Job(id)
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case id != "" && r.Method == http.MethodPost:
+		// Browsers send the basic authentication credentials along with forms
+		// posted from any site, but never a bearer token.
+		if _, _, ok := r.BasicAuth(); ok {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "actions require a bearer token"})
+			return
+		}
+		if err := h.act(r, id, action); err != nil {
+			writeJobError(w, err)
+			return
+		}
+
+		job, err := h.jobs.Job(id)
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, summarize(job))
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+// act runs a retry or cancel action on a job.
+func (h *AdminHandler) act(r *http.Request, id, action string) error {
+	var err error
+	switch action {
+	case "retry":
+		err = h.jobs.Retry(id)
+	case "cancel":
+		err = h.jobs.Cancel(id)
+	default:
+		return errors.Errorf("unknown action %q", action)
+	}
+
+	if err == nil {
+		zerolog.Ctx(r.Context()).Info().Msgf("Admin %s of job %s from %s", action, id, r.RemoteAddr)
+	}
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJobError(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	switch {
+	case errors.Is(err, queue.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, queue.ErrInvalidStatus):
+		code = http.StatusConflict
+	}
+
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"since": func(t time.Time) string {
+		return time.Since(t).Round(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>vitess-bot jobs</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.failed { background: #fdd; }
+.running { background: #ffd; }
+.canceled { color: #888; }
+</style>
+</head>
+<body>
+<h1>vitess-bot jobs</h1>
+<table>
+<tr><th>ID</th><th>Operation</th><th>Event</th><th>Pull Request</th><th>Status</th><th>Attempts</th><th>Updated</th><th>Error</th><th></th></tr>
+{{- range . }}
+<tr class="{{ .Status }}">
+<td><a href="/api/admin/jobs/{{ .ID }}">{{ .ID }}</a></td>
+<td>{{ .Operation }}{{ range $k, $v := .Args }}<br>{{ $k }}: {{ $v }}{{ end }}</td>
+<td>{{ .EventType }}<br>{{ .DeliveryID }}</td>
+<td>{{ if .Number }}<a href="https://github.com/{{ .Owner }}/{{ .Repo }}/pull/{{ .Number }}">{{ .Owner }}/{{ .Repo }}#{{ .Number }}</a>{{ else }}{{ .Owner }}/{{ .Repo }}{{ end }}</td>
+<td>{{ .Status }}</td>
+<td>{{ .Attempts }}</td>
+<td>{{ since .UpdatedAt }} ago</td>
+<td>{{ .Error }}</td>
+<td>
+{{- if or (eq .Status "pending") (eq .Status "running") }}
+<form method="post" action="/admin/jobs/{{ .ID }}/cancel"><button>Cancel</button></form>
+{{- else }}
+<form method="post" action="/admin/jobs/{{ .ID }}/retry"><button>Retry</button></form>
+{{- end }}
+</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+func (h *AdminHandler) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	id, action, ok := jobAction(r.URL.Path, adminDashboardRoute)
+	switch {
+	case r.URL.Path == adminDashboardRoute && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(w, h.jobs.Jobs()); err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to render admin dashboard")
+		}
+	case ok && id != "" && r.Method == http.MethodPost:
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request", http.StatusForbidden)
+			return
+		}
+		if err := h.act(r, id, action); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, adminDashboardRoute, http.StatusSeeOther)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// sameOrigin reports whether r was sent from a page of the admin handler
+// itself, according to its Origin header or, if missing, its Referer header.
+// Browsers send the basic authentication credentials of the dashboard along
+// with forms posted from any site, so its forms are only accepted from its
+// own pages.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return u.Host == r.Host
+}
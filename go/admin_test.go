@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+func TestAdminHandler(t *testing.T) {
+	jobs, err := queue.New(t.TempDir())
+	require.NoError(t, err)
+
+	job := &queue.Job{Operation: portOperation, Owner: "vitessio", Repo: "vitess", Number: 42, Payload: json.RawMessage(`{"big":"payload"}`)}
+	require.NoError(t, jobs.Enqueue(context.Background(), job))
+
+	h, err := NewAdminHandler(jobs, "secret")
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	do := func(method, path string, auth func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if auth != nil {
+			auth(r)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	bearer := func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/admin/jobs", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/admin/", func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }).Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/admin/jobs?status=pending", bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var got []map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		require.Len(t, got, 1)
+		assert.Equal(t, job.ID, got[0]["id"])
+		assert.Equal(t, float64(42), got[0]["number"])
+		assert.NotContains(t, got[0], "payload")
+
+		w = do(http.MethodGet, "/api/admin/jobs?status=failed", bearer)
+		assert.JSONEq(t, "[]", w.Body.String())
+	})
+
+	t.Run("cancel and retry", func(t *testing.T) {
+		w := do(http.MethodPost, "/api/admin/jobs/"+job.ID+"/cancel", bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"canceled"`)
+
+		w = do(http.MethodPost, "/api/admin/jobs/"+job.ID+"/cancel", bearer)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = do(http.MethodPost, "/admin/jobs/"+job.ID+"/retry", func(r *http.Request) {
+			r.SetBasicAuth("admin", "secret")
+			r.Header.Set("Origin", "http://"+r.Host)
+		})
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+
+		got, err := jobs.Job(job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, queue.Pending, got.Status)
+
+		assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/admin/jobs/unknown/retry", bearer).Code)
+	})
+
+	t.Run("cross-origin dashboard actions", func(t *testing.T) {
+		before, err := jobs.Job(job.ID)
+		require.NoError(t, err)
+
+		// Forms posted to the API from another site carry the basic
+		// authentication credentials of the dashboard.
+		w := do(http.MethodPost, "/api/admin/jobs/"+job.ID+"/cancel", func(r *http.Request) {
+			r.SetBasicAuth("admin", "secret")
+			r.Header.Set("Origin", "https://evil.example")
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		got, err := jobs.Job(job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, queue.Pending, got.Status)
+
+		for _, header := range []map[string]string{
+			{},
+			{"Origin": "https://evil.example"},
+			{"Referer": "https://evil.example/admin/"},
+			{"Origin": "null"},
+		} {
+			w := do(http.MethodPost, "/admin/jobs/"+job.ID+"/cancel", func(r *http.Request) {
+				r.SetBasicAuth("admin", "secret")
+				for k, v := range header {
+					r.Header.Set(k, v)
+				}
+			})
+			assert.Equal(t, http.StatusForbidden, w.Code, header)
+		}
+
+		w = do(http.MethodPost, "/admin/jobs/"+job.ID+"/cancel", func(r *http.Request) {
+			r.SetBasicAuth("admin", "secret")
+			r.Header.Set("Referer", "http://"+r.Host+"/admin/")
+		})
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+
+		got, err = jobs.Job(job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, queue.Pending, before.Status)
+		assert.Equal(t, queue.Canceled, got.Status)
+	})
+
+	t.Run("dashboard", func(t *testing.T) {
+		w := do(http.MethodGet, "/admin/", bearer)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "vitessio/vitess#42")
+	})
+}
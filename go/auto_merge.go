@@ -0,0 +1,384 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/vitess.io/vitess-bot/go/queue"
+	"github.com/vitess.io/vitess-bot/go/stats"
+)
+
+// AutoMergeHandler merges the ports opened by the bot without conflicts once
+// they are approved and their checks pass, on the repositories enabling the
+// auto_merge_ports setting. Approvals and checks completing are both
+// watched, as either can come last. The ports are merged by queued jobs.
+//
+// As checks complete, it also enqueues the update of the CI state of the ports
+// in the port status of their original Pull Request.
+type AutoMergeHandler struct {
+	githubapp.ClientCreator
+
+	cfg      *botConfig
+	settings *repoSettingsCache
+	botLogin string
+	jobs     *queue.Queue
+}
+
+func NewAutoMergeHandler(cc githubapp.ClientCreator, cfg *botConfig, settings *repoSettingsCache, jobs *queue.Queue, botLogin string) (*AutoMergeHandler, error) {
+	h := &AutoMergeHandler{
+		ClientCreator: cc,
+		cfg:           cfg,
+		settings:      settings,
+		botLogin:      botLogin,
+		jobs:          jobs,
+	}
+
+	jobs.Register(autoMergeOperation, h.runAutoMergeJob)
+
+	return h, nil
+}
+
+func (h *AutoMergeHandler) Handles() []string {
+	return []string{"pull_request_review", "check_suite", "status"}
+}
+
+func (h *AutoMergeHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var (
+		repo           *github.Repository
+		installationID int64
+		numbers        []int
+		sha            string
+	)
+	ctx = queue.WithDelivery(ctx, eventType, deliveryID)
+	switch eventType {
+	case "pull_request_review":
+		var event github.PullRequestReviewEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "Failed to parse pull_request_review event payload")
+		}
+		if event.GetAction() != "submitted" || !strings.EqualFold(event.GetReview().GetState(), "approved") {
+			return nil
+		}
+		repo, installationID = event.GetRepo(), githubapp.GetInstallationIDFromEvent(&event)
+		numbers = append(numbers, event.GetPullRequest().GetNumber())
+	case "check_suite":
+		var event github.CheckSuiteEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "Failed to parse check_suite event payload")
+		}
+		if event.GetAction() != "completed" {
+			return nil
+		}
+		repo, installationID = event.GetRepo(), githubapp.GetInstallationIDFromEvent(&event)
+		if err := h.trackChecks(ctx, repo, installationID, event.GetCheckSuite().GetHeadBranch()); err != nil {
+			return err
+		}
+		if event.GetCheckSuite().GetConclusion() != "success" {
+			return nil
+		}
+		for _, pr := range event.GetCheckSuite().PullRequests {
+			numbers = append(numbers, pr.GetNumber())
+		}
+	case "status":
+		var event github.StatusEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "Failed to parse status event payload")
+		}
+		repo, installationID = event.GetRepo(), githubapp.GetInstallationIDFromEvent(&event)
+		var branches []string
+		for _, branch := range event.Branches {
+			branches = append(branches, branch.GetName())
+		}
+		if err := h.trackChecks(ctx, repo, installationID, branches...); err != nil {
+			return err
+		}
+		if event.GetState() != "success" {
+			return nil
+		}
+		sha = event.GetSHA()
+	default:
+		return nil
+	}
+
+	if repo.GetName() != h.cfg.Vitess.Name {
+		return nil
+	}
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	if sha != "" {
+		// Status events do not tell the Pull Requests of the commit, the job
+		// looks them up.
+		return h.jobs.Enqueue(ctx, &queue.Job{
+			Operation:      autoMergeOperation,
+			InstallationID: installationID,
+			Owner:          owner,
+			Repo:           name,
+			Args:           map[string]string{"sha": sha},
+			Key:            fmt.Sprintf("%s/%s@%s", owner, name, sha),
+		})
+	}
+
+	for _, number := range numbers {
+		if err := h.enqueueAutoMerge(ctx, installationID, owner, name, number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackChecks enqueues the update of the port status of the original Pull
+// Requests of the ports among branches, whose checks changed.
+func (h *AutoMergeHandler) trackChecks(ctx context.Context, repo *github.Repository, installationID int64, branches ...string) error {
+	if repo.GetName() != h.cfg.Vitess.Name {
+		return nil
+	}
+
+	for _, branch := range branches {
+		if err := enqueuePortStatus(ctx, h.jobs, installationID, repo.GetOwner().GetLogin(), repo.GetName(), branch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueAutoMerge enqueues a job merging the Pull Request owner/name#number
+// if it is a port ready to be merged. The jobs of a Pull Request run one at a
+// time.
+func (h *AutoMergeHandler) enqueueAutoMerge(ctx context.Context, installationID int64, owner, name string, number int) error {
+	return h.jobs.Enqueue(ctx, &queue.Job{
+		Operation:      autoMergeOperation,
+		InstallationID: installationID,
+		Owner:          owner,
+		Repo:           name,
+		Number:         number,
+		Key:            fmt.Sprintf("%s/%s#%d", owner, name, number),
+	})
+}
+
+func (h *AutoMergeHandler) runAutoMergeJob(ctx context.Context, job *queue.Job) (err error) {
+	client, err := h.NewInstallationClient(job.InstallationID)
+	if err != nil {
+		return err
+	}
+
+	ctx, logger := githubapp.PrepareRepoContext(ctx, job.InstallationID, &github.Repository{
+		Owner: &github.User{Login: &job.Owner},
+		Name:  &job.Repo,
+	})
+	defer func() {
+		if e := panicHandler(logger); e != nil {
+			err = e
+		}
+	}()
+
+	settings, err := h.settings.get(ctx, client, job.InstallationID, job.Owner, job.Repo)
+	if err != nil {
+		return err
+	}
+	if !settings.Features.Ports || !settings.AutoMergePorts {
+		return nil
+	}
+
+	sha := job.Args["sha"]
+	if sha == "" {
+		return h.mergePort(ctx, client, job.Owner, job.Repo, job.Number)
+	}
+
+	prs, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, job.Owner, job.Repo, sha, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to list the Pull Requests of commit %s on %s/%s", sha, job.Owner, job.Repo)
+	}
+	ctx = queue.WithDelivery(ctx, job.EventType, job.DeliveryID)
+	for _, pr := range prs {
+		if pr.GetState() == "open" && pr.GetHead().GetSHA() == sha {
+			if err := h.enqueueAutoMerge(ctx, job.InstallationID, job.Owner, job.Repo, pr.GetNumber()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergePort merges the Pull Request owner/name#number if it is a port opened
+// by the bot without conflicts, approved, and whose required checks passed.
+func (h *AutoMergeHandler) mergePort(ctx context.Context, client *github.Client, owner, name string, number int) error {
+	logger := zerolog.Ctx(ctx)
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, name, number)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get Pull Request %s/%s#%d", owner, name, number)
+	}
+	if pr.GetState() != "open" || pr.GetDraft() || pr.GetUser().GetLogin() != h.botLogin || !portBranchRegexp.MatchString(pr.GetHead().GetRef()) {
+		return nil
+	}
+	for _, label := range pr.Labels {
+		if label.GetName() == mergeConflictLabel {
+			return nil
+		}
+	}
+	if pr.Mergeable != nil && !pr.GetMergeable() {
+		logger.Debug().Msgf("Port %s/%s#%d is not mergeable, not merging it", owner, name, number)
+		return nil
+	}
+
+	approved, err := isApproved(ctx, client, owner, name, number)
+	if err != nil || !approved {
+		return err
+	}
+
+	ci, err := getRequiredCIState(ctx, client, owner, name, pr.GetBase().GetRef(), pr.GetHead().GetSHA())
+	if err != nil || ci != ciSuccess {
+		return err
+	}
+
+	logger.Debug().Msgf("Merging approved port %s/%s#%d whose checks passed", owner, name, number)
+	_, _, err = client.PullRequests.Merge(
+		ctx,
+		owner,
+		name,
+		number,
+		"", // Default to the standard automatic commit message.
+		&github.PullRequestOptions{
+			SHA:         pr.GetHead().GetSHA(), // Fail if the branch has changed out from under us.
+			MergeMethod: "squash",
+		},
+	)
+	stats.Inc("ports.merged", "result", stats.Result(err))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to merge port %s/%s#%d", owner, name, number)
+	}
+	return nil
+}
+
+// getRequiredCIState returns the combined state of the checks of sha required
+// by the protection of branch. Checks that did not report yet are pending.
+// If branch requires no checks, all the checks of sha are combined instead.
+func getRequiredCIState(ctx context.Context, client *github.Client, owner, name, branch, sha string) (string, error) {
+	required, resp, err := client.Repositories.GetRequiredStatusChecks(ctx, owner, name, branch)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return ciNone, errors.Wrapf(err, "Failed to get the required status checks of branch %s on %s/%s", branch, owner, name)
+	}
+
+	contexts := map[string]bool{}
+	if required != nil {
+		for _, check := range required.Contexts {
+			contexts[check] = true
+		}
+		for _, check := range required.Checks {
+			contexts[check.Context] = true
+		}
+	}
+	if len(contexts) == 0 {
+		return getCIState(ctx, client, owner, name, sha)
+	}
+
+	states := map[string]string{}
+	runs, err := listCheckRuns(ctx, client, owner, name, sha)
+	if err != nil {
+		return ciNone, err
+	}
+	for _, run := range runs {
+		states[run.GetName()] = combineCIStates(states[run.GetName()], checkRunState(run))
+	}
+
+	statuses, err := listStatuses(ctx, client, owner, name, sha)
+	if err != nil {
+		return ciNone, err
+	}
+	for _, status := range statuses {
+		states[status.GetContext()] = combineCIStates(states[status.GetContext()], statusState(status.GetState()))
+	}
+
+	state := ciNone
+	for check := range contexts {
+		s, ok := states[check]
+		if !ok {
+			s = ciPending
+		}
+		state = combineCIStates(state, s)
+	}
+	return state, nil
+}
+
+// listStatuses returns the latest status of each context of sha.
+func listStatuses(ctx context.Context, client *github.Client, owner, name, sha string) ([]*github.RepoStatus, error) {
+	var statuses []*github.RepoStatus
+	perPage := 100
+	for page := 1; true; page++ {
+		combined, _, err := client.Repositories.GetCombinedStatus(ctx, owner, name, sha, &github.ListOptions{
+			Page:    page,
+			PerPage: perPage,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to get the status of %s on %s/%s", sha, owner, name)
+		}
+
+		statuses = append(statuses, combined.Statuses...)
+		if len(combined.Statuses) < perPage {
+			break
+		}
+	}
+
+	return statuses, nil
+}
+
+// isApproved tells whether a Pull Request has an approving review, and no
+// reviewer whose latest review requests changes.
+func isApproved(ctx context.Context, client *github.Client, owner, name string, number int) (bool, error) {
+	latest := map[string]string{}
+	perPage := 100
+	for page := 1; true; page++ {
+		reviews, _, err := client.PullRequests.ListReviews(ctx, owner, name, number, &github.ListOptions{
+			Page:    page,
+			PerPage: perPage,
+		})
+		if err != nil {
+			return false, errors.Wrapf(err, "Failed to list the reviews of Pull Request %s/%s#%d", owner, name, number)
+		}
+
+		for _, review := range reviews {
+			switch state := strings.ToUpper(review.GetState()); state {
+			case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+				latest[review.GetUser().GetLogin()] = state
+			}
+		}
+		if len(reviews) < perPage {
+			break
+		}
+	}
+
+	approved := false
+	for _, state := range latest {
+		switch state {
+		case "CHANGES_REQUESTED":
+			return false, nil
+		case "APPROVED":
+			approved = true
+		}
+	}
+	return approved, nil
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+func TestAutoMergeHandler(t *testing.T) {
+	review := func(login, state string) *github.PullRequestReview {
+		return &github.PullRequestReview{User: &github.User{Login: github.String(login)}, State: github.String(state)}
+	}
+	passing := &github.CheckRun{Status: github.String("completed"), Conclusion: github.String("success")}
+	failing := &github.CheckRun{Status: github.String("completed"), Conclusion: github.String("failure")}
+	flaky := &github.CheckRun{Name: github.String("flaky"), Status: github.String("completed"), Conclusion: github.String("failure")}
+
+	tcases := []struct {
+		name      string
+		settings  string
+		eventType string
+		author    string
+		labels    []*github.Label
+		reviews   []*github.PullRequestReview
+		checkRuns []*github.CheckRun
+		required  []string
+		merged    bool
+	}{
+		{
+			name:      "approved",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "pull_request_review",
+			reviews:   []*github.PullRequestReview{review("maintainer", "APPROVED")},
+			checkRuns: []*github.CheckRun{passing},
+			merged:    true,
+		},
+		{
+			name:      "check suite completed",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "check_suite",
+			reviews:   []*github.PullRequestReview{review("maintainer", "COMMENTED"), review("maintainer", "APPROVED")},
+			checkRuns: []*github.CheckRun{passing},
+			merged:    true,
+		},
+		{
+			name:      "status succeeded",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "status",
+			reviews:   []*github.PullRequestReview{review("maintainer", "APPROVED")},
+			merged:    true,
+		},
+		{
+			name:      "disabled",
+			eventType: "pull_request_review",
+			reviews:   []*github.PullRequestReview{review("maintainer", "APPROVED")},
+			checkRuns: []*github.CheckRun{passing},
+		},
+		{
+			name:      "not approved",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "check_suite",
+			reviews:   []*github.PullRequestReview{review("maintainer", "COMMENTED")},
+			checkRuns: []*github.CheckRun{passing},
+		},
+		{
+			name:      "changes requested",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "pull_request_review",
+			reviews:   []*github.PullRequestReview{review("other", "CHANGES_REQUESTED"), review("maintainer", "APPROVED")},
+			checkRuns: []*github.CheckRun{passing},
+		},
+		{
+			name:      "failing checks",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "pull_request_review",
+			reviews:   []*github.PullRequestReview{review("maintainer", "APPROVED")},
+			checkRuns: []*github.CheckRun{passing, failing},
+		},
+		{
+			name:      "failing check not required",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "pull_request_review",
+			reviews:   []*github.PullRequestReview{review("maintainer", "APPROVED")},
+			checkRuns: []*github.CheckRun{flaky},
+			required:  []string{"ci"},
+			merged:    true,
+		},
+		{
+			name:      "required check failing",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "pull_request_review",
+			reviews:   []*github.PullRequestReview{review("maintainer", "APPROVED")},
+			checkRuns: []*github.CheckRun{flaky},
+			required:  []string{"ci", "flaky"},
+		},
+		{
+			name:      "conflicts",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "pull_request_review",
+			labels:    []*github.Label{{Name: github.String(mergeConflictLabel)}},
+			reviews:   []*github.PullRequestReview{review("maintainer", "APPROVED")},
+			checkRuns: []*github.CheckRun{passing},
+		},
+		{
+			name:      "not opened by the bot",
+			settings:  "auto_merge_ports: true\n",
+			eventType: "pull_request_review",
+			author:    "contributor",
+			reviews:   []*github.PullRequestReview{review("maintainer", "APPROVED")},
+			checkRuns: []*github.CheckRun{passing},
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			gh := githubtest.NewServer(t)
+			gh.CreateBranch("vitessio", "vitess", "main", map[string]string{repoSettingsPath: tc.settings})
+			gh.CreateBranch("vitessio", "vitess", "release-18.0", nil)
+			sha := gh.CreateBranch("vitessio", "vitess", "backport-1-to-release-18.0", map[string]string{"fix.go": "package fix\n"})
+
+			author := tc.author
+			if author == "" {
+				author = githubtest.DefaultLogin
+			}
+			number := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				Title:  github.String("[release-18.0] Fix a bug (#1)"),
+				User:   &github.User{Login: github.String(author)},
+				Base:   &github.PullRequestBranch{Ref: github.String("release-18.0")},
+				Head:   &github.PullRequestBranch{Ref: github.String("backport-1-to-release-18.0"), SHA: github.String(sha)},
+				Labels: tc.labels,
+			})
+			gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+				r.Reviews[number] = tc.reviews
+				r.CheckRuns[sha] = tc.checkRuns
+				r.Statuses[sha] = []*github.RepoStatus{{Context: github.String("ci"), State: github.String("success")}}
+				if tc.required != nil {
+					r.RequiredChecks["release-18.0"] = tc.required
+				}
+			})
+
+			repo := &github.Repository{Name: github.String("vitess"), Owner: &github.User{Login: github.String("vitessio")}}
+			installation := &github.Installation{ID: github.Int64(1)}
+			var event any
+			switch tc.eventType {
+			case "pull_request_review":
+				event = github.PullRequestReviewEvent{
+					Action:       github.String("submitted"),
+					Review:       &github.PullRequestReview{State: github.String("approved")},
+					PullRequest:  &github.PullRequest{Number: github.Int(number)},
+					Repo:         repo,
+					Installation: installation,
+				}
+			case "check_suite":
+				event = github.CheckSuiteEvent{
+					Action:       github.String("completed"),
+					CheckSuite:   &github.CheckSuite{Conclusion: github.String("success"), PullRequests: []*github.PullRequest{{Number: github.Int(number)}}},
+					Repo:         repo,
+					Installation: installation,
+				}
+			case "status":
+				event = github.StatusEvent{
+					SHA:          github.String(sha),
+					State:        github.String("success"),
+					Repo:         repo,
+					Installation: installation,
+				}
+			}
+			payload, err := json.Marshal(event)
+			require.NoError(t, err)
+
+			jobs, err := queue.New(t.TempDir())
+			require.NoError(t, err)
+			jobs.WithMaxAttempts(1)
+			cfg := defaultBotConfig()
+			h, err := NewAutoMergeHandler(gh.ClientCreator(), cfg, newRepoSettingsCache(cfg, testChecklist), jobs, githubtest.DefaultLogin)
+			require.NoError(t, err)
+			require.NoError(t, h.Handle(context.Background(), tc.eventType, "delivery", payload))
+			assert.False(t, gh.PullRequest("vitessio", "vitess", number).GetMerged(), "merged before the job ran")
+
+			runJobs(t, jobs)
+			for _, job := range jobs.Jobs() {
+				assert.Equal(t, queue.Done, job.Status, job.Error)
+			}
+
+			assert.Equal(t, tc.merged, gh.PullRequest("vitessio", "vitess", number).GetMerged())
+		})
+	}
+}
+
+func TestGetRequiredCIState(t *testing.T) {
+	run := func(name, status, conclusion string) *github.CheckRun {
+		return &github.CheckRun{Name: github.String(name), Status: github.String(status), Conclusion: github.String(conclusion)}
+	}
+
+	// More check runs than fit in a page, the failing ones past the first
+	// page.
+	var runs []*github.CheckRun
+	for i := 0; i < 150; i++ {
+		runs = append(runs, run(fmt.Sprintf("check-%d", i), "completed", "success"))
+	}
+	runs[120].Conclusion = github.String("failure")
+	runs[130].Conclusion = github.String("failure")
+
+	tcases := []struct {
+		name     string
+		required []string
+		want     string
+	}{
+		{
+			name: "unprotected",
+			want: ciFailure,
+		},
+		{
+			name:     "no required checks",
+			required: []string{},
+			want:     ciFailure,
+		},
+		{
+			name:     "required check failing past the first page",
+			required: []string{"check-1", "check-120"},
+			want:     ciFailure,
+		},
+		{
+			name:     "failing checks not required",
+			required: []string{"check-1", "check-140", "ci"},
+			want:     ciSuccess,
+		},
+		{
+			name:     "required check missing",
+			required: []string{"check-1", "other"},
+			want:     ciPending,
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			gh := githubtest.NewServer(t)
+			gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+				r.CheckRuns["c0ffee"] = runs
+				r.Statuses["c0ffee"] = []*github.RepoStatus{{Context: github.String("ci"), State: github.String("success")}}
+				if tc.required != nil {
+					r.RequiredChecks["release-18.0"] = tc.required
+				}
+			})
+
+			state, err := getRequiredCIState(context.Background(), gh.Client(), "vitessio", "vitess", "release-18.0", "c0ffee")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, state)
+		})
+	}
+}
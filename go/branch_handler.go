@@ -0,0 +1,216 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+)
+
+const (
+	// portLabelColor is the color of the "Backport to: " labels of the
+	// supported release branches, and archivedLabelColor the one of the
+	// release branches that reached end of life.
+	portLabelColor     = "c5def5"
+	archivedLabelColor = "ededed"
+)
+
+// BranchHandler keeps the "Backport to: " labels in sync with the release
+// branches: the label of a new release branch is created, and those of the
+// release branches that reached end of life are archived.
+type BranchHandler struct {
+	githubapp.ClientCreator
+
+	cfg      *botConfig
+	settings *repoSettingsCache
+}
+
+func NewBranchHandler(cc githubapp.ClientCreator, cfg *botConfig, settings *repoSettingsCache) (*BranchHandler, error) {
+	return &BranchHandler{
+		ClientCreator: cc,
+		cfg:           cfg,
+		settings:      settings,
+	}, nil
+}
+
+func (h *BranchHandler) Handles() []string {
+	return []string{"create", "delete"}
+}
+
+func (h *BranchHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) (err error) {
+	var (
+		refType, ref   string
+		repo           *github.Repository
+		installationID int64
+	)
+	switch eventType {
+	case "create":
+		var event github.CreateEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "Failed to parse create event payload")
+		}
+		refType, ref, repo = event.GetRefType(), event.GetRef(), event.GetRepo()
+		installationID = githubapp.GetInstallationIDFromEvent(&event)
+	case "delete":
+		var event github.DeleteEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "Failed to parse delete event payload")
+		}
+		refType, ref, repo = event.GetRefType(), event.GetRef(), event.GetRepo()
+		installationID = githubapp.GetInstallationIDFromEvent(&event)
+	default:
+		return nil
+	}
+
+	if refType != "branch" || repo.GetName() != h.cfg.Vitess.Name {
+		return nil
+	}
+	if _, ok := parseReleaseBranch(ref); !ok {
+		return nil
+	}
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	ctx, logger := githubapp.PrepareRepoContext(ctx, installationID, repo)
+	defer func() {
+		if e := panicHandler(logger); e != nil {
+			err = e
+		}
+	}()
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	settings, err := h.settings.get(ctx, client, installationID, owner, name)
+	if err != nil {
+		return err
+	}
+	if !settings.Features.PortLabels {
+		return nil
+	}
+
+	deleted := ""
+	if eventType == "create" {
+		logger.Debug().Msgf("Release branch %s was created on %s/%s, creating its port label", ref, owner, name)
+		if err := ensurePortLabel(ctx, client, owner, name, settings.BackportLabelPrefix+ref, ref); err != nil {
+			return err
+		}
+	} else {
+		logger.Debug().Msgf("Release branch %s was deleted on %s/%s, archiving its port label", ref, owner, name)
+		deleted = ref
+	}
+
+	return archivePortLabels(ctx, client, owner, name, settings, deleted)
+}
+
+func portLabelDescription(branch string) string {
+	return fmt.Sprintf("Backport this Pull Request to %s once merged", branch)
+}
+
+func archivedLabelDescription(branch string) string {
+	return fmt.Sprintf("Archived: %s reached end of life", branch)
+}
+
+// ensurePortLabel creates the port label of a release branch, or restores its
+// color and description if it already exists.
+func ensurePortLabel(ctx context.Context, client *github.Client, owner, name, label, branch string) error {
+	want := &github.Label{
+		Name:        github.String(label),
+		Color:       github.String(portLabelColor),
+		Description: github.String(portLabelDescription(branch)),
+	}
+
+	existing, resp, err := client.Issues.GetLabel(ctx, owner, name, label)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		if _, _, err := client.Issues.CreateLabel(ctx, owner, name, want); err != nil {
+			return errors.Wrapf(err, "Failed to create label %q on repository %s/%s", label, owner, name)
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get label %q on repository %s/%s", label, owner, name)
+	}
+
+	if existing.GetColor() == want.GetColor() && existing.GetDescription() == want.GetDescription() {
+		return nil
+	}
+	if _, _, err := client.Issues.EditLabel(ctx, owner, name, label, want); err != nil {
+		return errors.Wrapf(err, "Failed to update label %q on repository %s/%s", label, owner, name)
+	}
+	return nil
+}
+
+// archivePortLabels archives the port labels of the deleted release branch,
+// if any, and of the release branches older than the
+// settings.SupportedReleases most recent ones. Archived labels are kept, so
+// that the Pull Requests they were added to keep them, but are grayed out.
+func archivePortLabels(ctx context.Context, client *github.Client, owner, name string, settings *repoSettings, deleted string) error {
+	var oldest releaseVersion
+	if settings.SupportedReleases > 0 {
+		supported, err := latestReleaseBranches(ctx, client, owner, name, settings.SupportedReleases)
+		if err != nil {
+			return err
+		}
+		if len(supported) == settings.SupportedReleases {
+			oldest, _ = parseReleaseBranch(supported[len(supported)-1])
+		}
+	}
+
+	perPage := 100
+	for page := 1; true; page++ {
+		labels, _, err := client.Issues.ListLabels(ctx, owner, name, &github.ListOptions{
+			Page:    page,
+			PerPage: perPage,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "Failed to list the labels of repository %s/%s", owner, name)
+		}
+
+		for _, label := range labels {
+			if !strings.HasPrefix(label.GetName(), settings.BackportLabelPrefix) || label.GetColor() == archivedLabelColor {
+				continue
+			}
+
+			branch := strings.TrimPrefix(label.GetName(), settings.BackportLabelPrefix)
+			version, ok := parseReleaseBranch(branch)
+			if !ok || (branch != deleted && !version.less(oldest)) {
+				continue
+			}
+
+			if _, _, err := client.Issues.EditLabel(ctx, owner, name, label.GetName(), &github.Label{
+				Name:        label.Name,
+				Color:       github.String(archivedLabelColor),
+				Description: github.String(archivedLabelDescription(branch)),
+			}); err != nil {
+				return errors.Wrapf(err, "Failed to archive label %q on repository %s/%s", label.GetName(), owner, name)
+			}
+		}
+		if len(labels) < perPage {
+			break
+		}
+	}
+
+	return nil
+}
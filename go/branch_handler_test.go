@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+)
+
+func TestBranchHandler(t *testing.T) {
+	supported := func(branch string) string {
+		return branch + " " + portLabelColor + " " + portLabelDescription(branch)
+	}
+	archived := func(branch string) string {
+		return branch + " " + archivedLabelColor + " " + archivedLabelDescription(branch)
+	}
+
+	tcases := []struct {
+		name      string
+		eventType string
+		refType   string
+		ref       string
+		want      []string
+	}{
+		{
+			name:      "new release branch",
+			eventType: "create",
+			refType:   "branch",
+			ref:       "release-20.0",
+			want:      []string{archived("release-17.0"), supported("release-18.0"), supported("release-19.0"), supported("release-20.0")},
+		},
+		{
+			name:      "deleted release branch",
+			eventType: "delete",
+			refType:   "branch",
+			ref:       "release-18.0",
+			want:      []string{supported("release-17.0"), archived("release-18.0"), supported("release-19.0")},
+		},
+		{
+			name:      "other branch",
+			eventType: "create",
+			refType:   "branch",
+			ref:       "fix",
+			want:      []string{supported("release-17.0"), supported("release-18.0"), supported("release-19.0")},
+		},
+		{
+			name:      "tag",
+			eventType: "create",
+			refType:   "tag",
+			ref:       "release-20.0",
+			want:      []string{supported("release-17.0"), supported("release-18.0"), supported("release-19.0")},
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			gh := githubtest.NewServer(t)
+			branches := []string{"main", "release-17.0", "release-18.0", "release-19.0"}
+			if tc.eventType == "create" && tc.refType == "branch" {
+				branches = append(branches, tc.ref)
+			}
+			for _, branch := range branches {
+				gh.CreateBranch("vitessio", "vitess", branch, nil)
+			}
+			gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+				if tc.eventType == "delete" {
+					delete(r.Refs, "heads/"+tc.ref)
+				}
+				for _, branch := range []string{"release-17.0", "release-18.0", "release-19.0"} {
+					r.RepoLabels[backportLabelPrefix+branch] = &github.Label{
+						Name:        github.String(backportLabelPrefix + branch),
+						Color:       github.String(portLabelColor),
+						Description: github.String(portLabelDescription(branch)),
+					}
+				}
+				r.RepoLabels["Type: Bug"] = &github.Label{Name: github.String("Type: Bug")}
+			})
+
+			cfg := defaultBotConfig()
+			h, err := NewBranchHandler(gh.ClientCreator(), cfg, newRepoSettingsCache(cfg, testChecklist))
+			require.NoError(t, err)
+
+			payload, err := json.Marshal(github.CreateEvent{
+				Ref:          github.String(tc.ref),
+				RefType:      github.String(tc.refType),
+				Repo:         &github.Repository{Name: github.String("vitess"), Owner: &github.User{Login: github.String("vitessio")}},
+				Installation: &github.Installation{ID: github.Int64(1)},
+			})
+			require.NoError(t, err)
+			require.NoError(t, h.Handle(context.Background(), tc.eventType, "delivery", payload))
+
+			var labels []string
+			for _, label := range gh.RepoLabels("vitessio", "vitess") {
+				if label.GetName() == "Type: Bug" {
+					assert.Empty(t, label.GetColor())
+					continue
+				}
+				labels = append(labels, label.GetName()[len(backportLabelPrefix):]+" "+label.GetColor()+" "+label.GetDescription())
+			}
+			assert.Equal(t, tc.want, labels)
+		})
+	}
+}
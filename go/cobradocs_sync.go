@@ -44,7 +44,7 @@ func (h *PullRequestHandler) synchronizeCobraDocs(
 ) (*github.PullRequest, error) {
 	logger := zerolog.Ctx(ctx)
 	op := "update cobradocs"
-	branch := "prod"
+	branch := website.DefaultBranch
 	headBranch := cobraDocsSyncBranchName(pr.GetNumber())
 	headRef := fmt.Sprintf("refs/heads/%s", headBranch)
 
@@ -84,7 +84,7 @@ func (h *PullRequestHandler) synchronizeCobraDocs(
 		logger.Debug().Msgf("Using existing PR #%d (%s/%s:%s)", openPR.GetNumber(), baseRepo.GetOwner().GetLogin(), baseRepo.GetName(), headBranch)
 
 		// If branch already existed, hard reset to `prod`.
-		if err := website.ResetHard(ctx, branch); err != nil {
+		if err := website.ResetHard(ctx, "origin/"+branch); err != nil {
 			return nil, errors.Wrapf(err, "Failed to reset %s to %s to %s for %s", headBranch, branch, op, pr.GetHTMLURL())
 		}
 	}
@@ -107,7 +107,7 @@ func (h *PullRequestHandler) synchronizeCobraDocs(
 		client,
 		website,
 		pr,
-		branch,
+		"origin/"+branch,
 		"HEAD",
 		baseTree,
 		parent,
@@ -158,11 +158,11 @@ func (h *PullRequestHandler) synchronizeCobraDocs(
 		}
 
 		// Remove the doNotMerge label.
-		if resp, err := client.Issues.RemoveLabelForIssue(ctx, website.Owner, website.Name, openPR.GetNumber(), doNotMergeLabel); err != nil {
+		if resp, err := client.Issues.RemoveLabelForIssue(ctx, website.Owner, website.Name, openPR.GetNumber(), h.cfg.Labels.DoNotMerge); err != nil {
 			// We get a 404 if the label was already removed.
 			if resp.StatusCode != http.StatusNotFound {
 
-				return nil, errors.Wrapf(err, "Failed to remove %s label to %s", doNotMergeLabel, openPR.GetHTMLURL())
+				return nil, errors.Wrapf(err, "Failed to remove %s label to %s", h.cfg.Labels.DoNotMerge, openPR.GetHTMLURL())
 			}
 		}
 
@@ -204,17 +204,23 @@ func setupRepo(ctx context.Context, repo *git.Repo, op string) error {
 		return errors.Wrapf(err, "Failed to clean the repository %s/%s to %s", repo.Owner, repo.Name, op)
 	}
 
-	if err := repo.Checkout(ctx, repo.DefaultBranch); err != nil {
-		return errors.Wrapf(err, "Failed to checkout %s in %s/%s to %s", repo.DefaultBranch, repo.Owner, repo.Name, op)
-	}
-
 	if err := repo.Fetch(ctx, "origin"); err != nil {
 		return errors.Wrapf(err, "Failed to fetch origin on repository %s/%s to %s", repo.Owner, repo.Name, op)
 	}
 
-	if err := repo.ResetHard(ctx, "FETCH_HEAD"); err != nil {
-		return errors.Wrapf(err, "Failed to reset the repository %s/%s to %s", repo.Owner, repo.Name, op)
+	// Worktrees share their local branches, so stay detached rather than
+	// checking out the default branch, which another worktree may be using.
+	if err := repo.Checkout(ctx, "origin/"+repo.DefaultBranch); err != nil {
+		return errors.Wrapf(err, "Failed to checkout %s in %s/%s to %s", repo.DefaultBranch, repo.Owner, repo.Name, op)
 	}
 
 	return nil
 }
+
+// releaseRepo gives back a worktree acquired from worktrees, logging any
+// failure since there is nothing else the caller can do about it.
+func releaseRepo(ctx context.Context, worktrees *git.Worktrees, repo *git.Repo) {
+	if err := worktrees.Release(ctx, repo); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msgf("Failed to release worktree %s", repo.LocalDir)
+	}
+}
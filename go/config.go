@@ -17,22 +17,44 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	"github.com/joho/godotenv"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vitess.io/vitess-bot/go/git"
 )
 
 type config struct {
 	Github githubapp.Config
+	Bot    *botConfig
 
-	botLogin        string
-	reviewChecklist string
-	address         string
-	logFile         string
+	botLogin          string
+	reviewChecklist   string
+	address           string
+	logFile           string
+	jobsDir           string
+	adminToken        string
+	dryRun            bool
+	deliveriesDir     string
+	remoteURLTemplate string
+	gitCredentials    string
 }
 
+const (
+	// gitCredentialsSSH authenticates git with the SSH key of the host.
+	gitCredentialsSSH = "ssh"
+	// gitCredentialsApp authenticates git over HTTPS with installation access
+	// tokens of the GitHub App.
+	gitCredentialsApp = "app"
+)
+
 func readConfig() (*config, error) {
 	err := godotenv.Load()
 	if err != nil {
@@ -75,5 +97,178 @@ func readConfig() (*config, error) {
 
 	// Get log file path
 	c.logFile = os.Getenv("LOG_FILE")
+
+	// Get the directory in which jobs are persisted. It defaults to a directory
+	// outside the checkout of the bot, which deployments clean.
+	c.jobsDir = os.Getenv("JOBS_DIR")
+	if c.jobsDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find the default JOBS_DIR, please set the JOBS_DIR environment variable")
+		}
+		c.jobsDir = filepath.Join(home, ".vitess-bot", "jobs")
+	}
+
+	// Get the token of the admin API, which is disabled if unset
+	c.adminToken = os.Getenv("ADMIN_TOKEN")
+
+	// Get how git authenticates to the remotes
+	c.gitCredentials = os.Getenv("GIT_CREDENTIALS")
+	switch c.gitCredentials {
+	case "":
+		c.gitCredentials = gitCredentialsSSH
+	case gitCredentialsSSH, gitCredentialsApp:
+	default:
+		return nil, errors.Errorf("invalid GIT_CREDENTIALS value: %s", c.gitCredentials)
+	}
+
+	// Get the URL repositories are cloned from
+	c.remoteURLTemplate = os.Getenv("GIT_REMOTE_URL_TEMPLATE")
+	if c.remoteURLTemplate == "" {
+		c.remoteURLTemplate = git.DefaultRemoteURLTemplate
+		if c.gitCredentials == gitCredentialsApp {
+			c.remoteURLTemplate = git.HTTPSRemoteURLTemplate
+		}
+	}
+
+	// Get the directory in which webhook deliveries are recorded, if any
+	c.deliveriesDir = os.Getenv("DELIVERIES_DIR")
+
+	// Check whether mutations should be logged instead of performed
+	if dryRun := os.Getenv("DRY_RUN"); dryRun != "" {
+		c.dryRun, err = strconv.ParseBool(dryRun)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid DRY_RUN value: %s", dryRun)
+		}
+	}
+
+	// Read the bot configuration file, if any
+	c.Bot = defaultBotConfig()
+	if pathConfig := os.Getenv("CONFIG_PATH"); pathConfig != "" {
+		bytes, err = os.ReadFile(pathConfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read config file: %s", pathConfig)
+		}
+
+		c.Bot, err = parseBotConfig(bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid config file: %s", pathConfig)
+		}
+	}
 	return &c, nil
 }
+
+// botConfig describes the repositories the bot works on and how it labels
+// their Pull Requests. It is read from the YAML file at CONFIG_PATH, see
+// config/vitess-bot.yml for an example.
+type botConfig struct {
+	// Vitess is the repository whose Pull Requests and releases are handled.
+	Vitess repoConfig `yaml:"vitess"`
+	// Website is the repository hosting the documentation, in the same
+	// organization as Vitess.
+	Website repoConfig `yaml:"website"`
+
+	Labels     labelsConfig     `yaml:"labels"`
+	ErrorCodes errorCodesConfig `yaml:"error_codes"`
+}
+
+type repoConfig struct {
+	Name          string `yaml:"name"`
+	DefaultBranch string `yaml:"default_branch"`
+}
+
+type labelsConfig struct {
+	// Always are added to every new Pull Request that is not a port.
+	Always []string `yaml:"always"`
+	// DoNotMerge is added to the cobradocs preview Pull Requests.
+	DoNotMerge string `yaml:"do_not_merge"`
+	// Benchmark triggers an arewefastyet comment. Leave empty to disable.
+	Benchmark string `yaml:"benchmark"`
+}
+
+type errorCodesConfig struct {
+	// File is the file defining the error codes, whose changes trigger an
+	// update of the error code documentation.
+	File string `yaml:"file"`
+	// Generator is the Go package printing the error code documentation.
+	Generator string `yaml:"generator"`
+}
+
+func defaultBotConfig() *botConfig {
+	return &botConfig{
+		Vitess: repoConfig{
+			Name:          "vitess",
+			DefaultBranch: "main",
+		},
+		Website: repoConfig{
+			Name:          "website",
+			DefaultBranch: "prod",
+		},
+		Labels: labelsConfig{
+			Always: []string{
+				"NeedsWebsiteDocsUpdate",
+				"NeedsDescriptionUpdate",
+				"NeedsIssue",
+				"NeedsBackportReason",
+			},
+			DoNotMerge: "do-not-merge",
+			Benchmark:  "Benchmark me",
+		},
+		ErrorCodes: errorCodesConfig{
+			File:      "go/vt/vterrors/code.go",
+			Generator: "./go/vt/vterrors/vterrorsgen",
+		},
+	}
+}
+
+// parseBotConfig parses a YAML bot configuration. Unset fields keep their
+// default value, while unknown fields are rejected to catch typos.
+func parseBotConfig(data []byte) (*botConfig, error) {
+	c := defaultBotConfig()
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *botConfig) validate() error {
+	required := []struct {
+		field, value string
+	}{
+		{"vitess.name", c.Vitess.Name},
+		{"vitess.default_branch", c.Vitess.DefaultBranch},
+		{"website.name", c.Website.Name},
+		{"website.default_branch", c.Website.DefaultBranch},
+		{"labels.do_not_merge", c.Labels.DoNotMerge},
+		{"error_codes.file", c.ErrorCodes.File},
+		{"error_codes.generator", c.ErrorCodes.Generator},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			return errors.Errorf("%s must be set", r.field)
+		}
+	}
+
+	if c.Vitess.Name == c.Website.Name {
+		return errors.Errorf("vitess.name and website.name must be different, got %s for both", c.Vitess.Name)
+	}
+
+	for _, label := range c.Labels.Always {
+		if label == "" {
+			return errors.New("labels.always must not contain empty labels")
+		}
+	}
+	return nil
+}
+
+// repo returns the repository of the given owner described by c.
+func (c repoConfig) repo(owner string) *git.Repo {
+	return git.NewRepo(owner, c.Name).WithDefaultBranch(c.DefaultBranch)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBotConfig(t *testing.T) {
+	tcases := []struct {
+		name    string
+		in      string
+		want    func(c *botConfig)
+		wantErr string
+	}{
+		{
+			name: "empty",
+			in:   "",
+			want: func(c *botConfig) {},
+		},
+		{
+			name: "fork",
+			in:   "vitess:\n  name: vitess-staging\nlabels:\n  always: []\n  benchmark: \"\"\n",
+			want: func(c *botConfig) {
+				c.Vitess.Name = "vitess-staging"
+				c.Labels.Always = []string{}
+				c.Labels.Benchmark = ""
+			},
+		},
+		{
+			name:    "unknown field",
+			in:      "vitess:\n  default-branch: master\n",
+			wantErr: "field default-branch not found",
+		},
+		{
+			name:    "missing required field",
+			in:      "website:\n  default_branch: \"\"\n",
+			wantErr: "website.default_branch must be set",
+		},
+		{
+			name:    "same repositories",
+			in:      "website:\n  name: vitess\n",
+			wantErr: "vitess.name and website.name must be different",
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseBotConfig([]byte(tc.in))
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			want := defaultBotConfig()
+			tc.want(want)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestExampleBotConfig(t *testing.T) {
+	data, err := os.ReadFile("../config/vitess-bot.yml")
+	require.NoError(t, err)
+
+	got, err := parseBotConfig(data)
+	require.NoError(t, err)
+	assert.Equal(t, defaultBotConfig(), got)
+}
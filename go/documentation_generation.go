@@ -38,21 +38,21 @@ const (
 	errorCodeSuffixLabel = "<!-- end -->"
 )
 
-func detectErrorCodeChanges(ctx context.Context, vitess *git.Repo, prInfo prInformation, client *github.Client) (bool, error) {
+func detectErrorCodeChanges(ctx context.Context, vitess *git.Repo, prInfo prInformation, client *github.Client, errorCodesFile string) (bool, error) {
 	allFiles, err := vitess.ListPRFiles(ctx, client, prInfo.num)
 	if err != nil {
 		return false, err
 	}
 
 	for _, file := range allFiles {
-		if file.GetFilename() == "go/vt/vterrors/code.go" {
+		if file.GetFilename() == errorCodesFile {
 			return true, nil
 		}
 	}
 	return false, nil
 }
 
-func cloneVitessAndGenerateErrors(ctx context.Context, vitess *git.Repo, prInfo prInformation) (string, error) {
+func cloneVitessAndGenerateErrors(ctx context.Context, vitess *git.Repo, prInfo prInformation, generator string) (string, error) {
 	if err := vitess.Clone(ctx); err != nil {
 		return "", errors.Wrapf(err, "Failed to clone repository %s/%s to generate error code on Pull Request %d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
 	}
@@ -70,37 +70,29 @@ func cloneVitessAndGenerateErrors(ctx context.Context, vitess *git.Repo, prInfo
 		return "", errors.Wrapf(err, "Failed to checkout on Pull Request %s/%s#%d to generate error code", prInfo.repoOwner, prInfo.repoName, prInfo.num)
 	}
 
-	vterrorsgenVitessBytes, err := shell.NewContext(ctx, "go", "run", "./go/vt/vterrors/vterrorsgen").InDir(vitess.LocalDir).Output()
+	vterrorsgenVitessBytes, err := shell.NewContext(ctx, "go", "run", generator).InDir(vitess.LocalDir).Output()
 	if err != nil {
-		return "", errors.Wrapf(err, "Failed to run ./go/vt/vterrors/vterrorsgen on Pull Request %s/%s#%d to generate error code", prInfo.repoOwner, prInfo.repoName, prInfo.num)
+		return "", errors.Wrapf(err, "Failed to run %s on Pull Request %s/%s#%d to generate error code", generator, prInfo.repoOwner, prInfo.repoName, prInfo.num)
 	}
 	return string(vterrorsgenVitessBytes), err
 }
 
-func cloneWebsiteAndGetCurrentVersionOfDocs(ctx context.Context, website *git.Repo, prInfo prInformation) (string, error) {
-	if err := website.Clone(ctx); err != nil {
-		return "", errors.Wrapf(err, "Failed to clone repository vitessio/website to generate error code on Pull Request %d", prInfo.num)
+func cloneWebsiteAndGetCurrentVersionOfDocs(ctx context.Context, website *git.Repo, prInfo prInformation, vitessDefaultBranch string) (string, error) {
+	if err := setupRepo(ctx, website, fmt.Sprintf("generate error code on Pull Request %d", prInfo.num)); err != nil {
+		return "", err
 	}
 
-	if err := website.Clean(ctx); err != nil {
-		return "", errors.Wrapf(err, "Failed to clean vitessio/website to generate error code on Pull Request %d", prInfo.num)
-	}
-
-	if err := website.Pull(ctx); err != nil {
-		return "", errors.Wrapf(err, "Failed to pull vitessio/website to generate error code on Pull Request %d", prInfo.num)
-	}
-
-	currentVersionDocs, err := findCorrespondingDocumentationVersion(website, prInfo.base.GetRef())
+	currentVersionDocs, err := findCorrespondingDocumentationVersion(website, prInfo.base.GetRef(), vitessDefaultBranch)
 	if err != nil {
 		return "", errors.Wrapf(err, "Failed to find corresponding documentation version for Pull Request %d", prInfo.num)
 	}
 	return currentVersionDocs, nil
 }
 
-func findCorrespondingDocumentationVersion(website *git.Repo, baseRef string) (string, error) {
+func findCorrespondingDocumentationVersion(website *git.Repo, baseRef, vitessDefaultBranch string) (string, error) {
 	// If our base is "main" we want to open the config.toml of the website repository
 	// and figure out what is the "next" release.
-	if baseRef == "main" {
+	if baseRef == vitessDefaultBranch {
 		file, err := os.Open(path.Join(website.LocalDir, "config.toml"))
 		if err != nil {
 			return "", errors.Wrapf(err, "Failed to open config.toml file")
@@ -174,7 +166,7 @@ func generateErrorCodeDocumentation(
 
 	statusBytes, err := website.Status(ctx, "-s")
 	if err != nil {
-		return "", "", errors.Wrapf(err, "Failed to do git status on vitessio/website to generate error code on Pull Request %d", prInfo.num)
+		return "", "", errors.Wrapf(err, "Failed to do git status on %s/%s to generate error code on Pull Request %d", website.Owner, website.Name, prInfo.num)
 	}
 	if len(statusBytes) == 0 {
 		return "", "", nil
@@ -199,9 +191,9 @@ func createCommitAndPullRequestForErrorCode(
 	newBranch := false
 	branchName := fmt.Sprintf("update-error-code-%d", prInfo.num)
 	refName := "refs/heads/" + branchName
-	branch, r, err := client.Repositories.GetBranch(ctx, prInfo.repoOwner, "website", branchName, false)
+	branch, r, err := client.Repositories.GetBranch(ctx, website.Owner, website.Name, branchName, false)
 	if r.StatusCode != http.StatusNotFound && err != nil {
-		return errors.Wrapf(err, "Failed to get branch %s on vitessio/website to generate error code on Pull Request %d", branchName, prInfo.num)
+		return errors.Wrapf(err, "Failed to get branch %s on %s/%s to generate error code on Pull Request %d", branchName, website.Owner, website.Name, prInfo.num)
 	}
 
 	// If the branchName is not a branch on the repository, we will receive a http.StatusNotFound status code
@@ -209,22 +201,22 @@ func createCommitAndPullRequestForErrorCode(
 	if r.StatusCode == http.StatusNotFound {
 		newBranch = true
 
-		prodBranch, _, err := client.Repositories.GetBranch(ctx, prInfo.repoOwner, "website", "prod", false)
+		prodBranch, _, err := client.Repositories.GetBranch(ctx, website.Owner, website.Name, website.DefaultBranch, false)
 		if err != nil {
-			return errors.Wrapf(err, "Failed get production branch on vitessio/website to generate error code on Pull Request %d", prInfo.num)
+			return errors.Wrapf(err, "Failed get production branch on %s/%s to generate error code on Pull Request %d", website.Owner, website.Name, prInfo.num)
 		}
 
 		baseTree = prodBranch.GetCommit().Commit.Tree.GetSHA()
 		parent = prodBranch.GetCommit().GetSHA()
 
-		_, _, err = client.Git.CreateRef(ctx, prInfo.repoOwner, "website", &github.Reference{
+		_, _, err = client.Git.CreateRef(ctx, website.Owner, website.Name, &github.Reference{
 			Ref: &refName,
 			Object: &github.GitObject{
 				SHA: &parent,
 			},
 		})
 		if err != nil {
-			return errors.Wrapf(err, "Failed to create git ref on vitessio/website to generate error code on Pull Request %d", prInfo.num)
+			return errors.Wrapf(err, "Failed to create git ref on %s/%s to generate error code on Pull Request %d", website.Owner, website.Name, prInfo.num)
 		}
 	} else {
 		baseTree = branch.GetCommit().Commit.Tree.GetSHA()
@@ -235,7 +227,7 @@ func createCommitAndPullRequestForErrorCode(
 		Content:  github.String(errorDocContent),
 		Encoding: github.String("utf-8"),
 	}
-	blob, _, err = client.Git.CreateBlob(ctx, prInfo.repoOwner, "website", blob)
+	blob, _, err = client.Git.CreateBlob(ctx, website.Owner, website.Name, blob)
 	if err != nil {
 		return errors.Wrapf(err, "Failed create blob to generate error code on Pull Request %d", prInfo.num)
 	}
@@ -251,7 +243,7 @@ func createCommitAndPullRequestForErrorCode(
 			},
 		},
 	}
-	tree, _, err = client.Git.CreateTree(ctx, prInfo.repoOwner, "website", baseTree, tree.Entries)
+	tree, _, err = client.Git.CreateTree(ctx, website.Owner, website.Name, baseTree, tree.Entries)
 	if err != nil {
 		return errors.Wrapf(err, "Failed create tree to generate error code on Pull Request %d", prInfo.num)
 	}
@@ -264,7 +256,7 @@ func createCommitAndPullRequestForErrorCode(
 			{SHA: &parent},
 		},
 	}
-	commit, _, err = client.Git.CreateCommit(ctx, prInfo.repoOwner, "website", commit)
+	commit, _, err = client.Git.CreateCommit(ctx, website.Owner, website.Name, commit)
 	if err != nil {
 		return errors.Wrapf(err, "Failed create commit to generate error code on Pull Request %d", prInfo.num)
 	}
@@ -274,7 +266,7 @@ func createCommitAndPullRequestForErrorCode(
 		Ref:    github.String(refName),
 		Object: &github.GitObject{SHA: commit.SHA},
 	}
-	_, _, err = client.Git.UpdateRef(ctx, prInfo.repoOwner, "website", ref, true)
+	_, _, err = client.Git.UpdateRef(ctx, website.Owner, website.Name, ref, true)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to update ref to generate error code on Pull Request %d", prInfo.num)
 	}
@@ -284,11 +276,11 @@ func createCommitAndPullRequestForErrorCode(
 		newPR := &github.NewPullRequest{
 			Title:               github.String(fmt.Sprintf("Update error code documentation (#%d)", prInfo.num)),
 			Head:                github.String(branchName),
-			Base:                github.String("prod"),
-			Body:                github.String(fmt.Sprintf("## Description\nThis Pull Request updates the error code documentation based on the changes made in https://github.com/%s/vitess/pull/%d", prInfo.repoOwner, prInfo.num)),
+			Base:                github.String(website.DefaultBranch),
+			Body:                github.String(fmt.Sprintf("## Description\nThis Pull Request updates the error code documentation based on the changes made in https://github.com/%s/%s/pull/%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)),
 			MaintainerCanModify: github.Bool(true),
 		}
-		_, _, err = client.PullRequests.Create(ctx, prInfo.repoOwner, "website", newPR)
+		_, _, err = client.PullRequests.Create(ctx, website.Owner, website.Name, newPR)
 		if err != nil {
 			return errors.Wrapf(err, "Failed create PR to generate error code on Pull Request %d", prInfo.num)
 		}
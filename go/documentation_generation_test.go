@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+)
+
+func TestCreateCommitAndPullRequestForErrorCode(t *testing.T) {
+	const docPath = "content/en/docs/19.0/reference/errors/query-serving.md"
+
+	ctx := context.Background()
+	gh := githubtest.NewServer(t)
+	gh.CreateBranch("vitessio", "website", "prod", map[string]string{
+		docPath:     "old errors",
+		"README.md": "website",
+	})
+
+	website := git.NewRepo("vitessio", "website").WithDefaultBranch("prod").WithLocalDir(t.TempDir())
+	prInfo := prInformation{num: 42, repoOwner: "vitessio", repoName: "vitess"}
+
+	// The first change opens a Pull Request.
+	require.NoError(t, createCommitAndPullRequestForErrorCode(ctx, website, prInfo, gh.Client(), "new errors", website.LocalDir+"/"+docPath))
+
+	pulls := gh.PullRequests("vitessio", "website")
+	require.Len(t, pulls, 1)
+	assert.Equal(t, "Update error code documentation (#42)", pulls[0].GetTitle())
+	assert.Equal(t, "update-error-code-42", pulls[0].GetHead().GetRef())
+	assert.Equal(t, "prod", pulls[0].GetBase().GetRef())
+	assert.Contains(t, pulls[0].GetBody(), "https://github.com/vitessio/vitess/pull/42")
+
+	content, ok := gh.File("vitessio", "website", "update-error-code-42", docPath)
+	require.True(t, ok)
+	assert.Equal(t, "new errors", content)
+	content, ok = gh.File("vitessio", "website", "update-error-code-42", "README.md")
+	require.True(t, ok)
+	assert.Equal(t, "website", content)
+
+	// The production branch is left untouched.
+	content, _ = gh.File("vitessio", "website", "prod", docPath)
+	assert.Equal(t, "old errors", content)
+
+	// Later changes update the same branch and Pull Request.
+	require.NoError(t, createCommitAndPullRequestForErrorCode(ctx, website, prInfo, gh.Client(), "newer errors", website.LocalDir+"/"+docPath))
+
+	assert.Len(t, gh.PullRequests("vitessio", "website"), 1)
+	content, _ = gh.File("vitessio", "website", "update-error-code-42", docPath)
+	assert.Equal(t, "newer errors", content)
+}
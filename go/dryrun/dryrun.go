@@ -0,0 +1,174 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dryrun records the mutations the bot would make to GitHub, through
+// its API or with git push, instead of performing them.
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// maxMutations is the number of mutations kept in memory by a Recorder.
+const maxMutations = 1000
+
+// Mutation is a change that was not made because of the dry-run mode.
+type Mutation struct {
+	Time time.Time `json:"time"`
+
+	// Method, URL and Body describe a GitHub API request.
+	Method string `json:"method,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Body   string `json:"body,omitempty"`
+
+	// Dir and Command describe a git command.
+	Dir     string   `json:"dir,omitempty"`
+	Command []string `json:"command,omitempty"`
+}
+
+// Recorder logs mutations and keeps the most recent ones in memory.
+type Recorder struct {
+	m         sync.Mutex
+	mutations []Mutation
+}
+
+func New() *Recorder {
+	return &Recorder{}
+}
+
+// Record logs the mutation and keeps it in memory.
+func (r *Recorder) Record(ctx context.Context, m Mutation) {
+	m.Time = time.Now()
+
+	logger := zerolog.Ctx(ctx)
+	if m.Command != nil {
+		logger.Info().Msgf("[dry-run] Skipping `%s` in %s", strings.Join(m.Command, " "), m.Dir)
+	} else {
+		logger.Info().Msgf("[dry-run] Skipping %s %s: %s", m.Method, m.URL, m.Body)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.mutations = append(r.mutations, m)
+	if len(r.mutations) > maxMutations {
+		r.mutations = r.mutations[len(r.mutations)-maxMutations:]
+	}
+}
+
+// Mutations returns the recorded mutations, oldest first.
+func (r *Recorder) Mutations() []Mutation {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return append([]Mutation(nil), r.mutations...)
+}
+
+// Middleware returns a client middleware, to be used with
+// githubapp.WithClientMiddleware, recording the mutating requests instead of
+// sending them. Read-only requests are sent as usual.
+//
+// Recorded requests get a successful response echoing their body when it is a
+// JSON object, and an empty one otherwise, so that the objects returned by the
+// client only hold the fields that were sent, see echo.
+func (r *Recorder) Middleware() func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !isMutation(req) {
+				return next.RoundTrip(req)
+			}
+
+			var body []byte
+			if req.Body != nil {
+				var err error
+				body, err = io.ReadAll(req.Body)
+				req.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			r.Record(req.Context(), Mutation{
+				Method: req.Method,
+				URL:    req.URL.String(),
+				Body:   string(body),
+			})
+
+			body = echo(body)
+
+			return &http.Response{
+				Status:        "200 OK",
+				StatusCode:    http.StatusOK,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        http.Header{"Content-Type": []string{"application/json"}},
+				Body:          io.NopCloser(bytes.NewReader(body)),
+				ContentLength: int64(len(body)),
+				Request:       req,
+			}, nil
+		})
+	}
+}
+
+// unechoedFields are the fields of the requests whose type differs in the
+// responses, e.g. the branches of Pull Requests are sent as names but returned
+// as objects, so that echoing them would fail to decode.
+var unechoedFields = []string{"head", "base"}
+
+// echo returns the response body of a recorded request: its body if it is a
+// JSON object, without the unechoedFields, and an empty one otherwise.
+func echo(body []byte) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return nil
+	}
+
+	for _, field := range unechoedFields {
+		delete(fields, field)
+	}
+	echoed, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+	return echoed
+}
+
+// isMutation reports whether the request changes anything on GitHub. Requests
+// for installation tokens are let through since the bot cannot work without.
+func isMutation(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+
+	return !strings.HasSuffix(req.URL.Path, "/access_tokens")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
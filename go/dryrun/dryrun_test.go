@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"number": 42}`))
+	}))
+	defer srv.Close()
+
+	rec := New()
+	client, err := github.NewEnterpriseClient(srv.URL, srv.URL, &http.Client{
+		Transport: rec.Middleware()(http.DefaultTransport),
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	pr, _, err := client.PullRequests.Get(ctx, "vitessio", "vitess", 42)
+	require.NoError(t, err)
+	assert.Equal(t, 42, pr.GetNumber())
+
+	comment, _, err := client.Issues.CreateComment(ctx, "vitessio", "vitess", 42, &github.IssueComment{Body: github.String("hello")})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", comment.GetBody())
+
+	newPR, _, err := client.PullRequests.Create(ctx, "vitessio", "vitess", &github.NewPullRequest{
+		Title: github.String("[release-18.0] Fix a bug (#1)"),
+		Head:  github.String("backport-1-to-release-18.0"),
+		Base:  github.String("release-18.0"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "[release-18.0] Fix a bug (#1)", newPR.GetTitle())
+	assert.Nil(t, newPR.Head)
+
+	labels, _, err := client.Issues.AddLabelsToIssue(ctx, "vitessio", "vitess", 42, []string{"NeedsIssue"})
+	require.NoError(t, err)
+	assert.Empty(t, labels)
+
+	_, _, err = client.Apps.CreateInstallationToken(ctx, 1, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"GET /api/v3/repos/vitessio/vitess/pulls/42",
+		"POST /api/v3/app/installations/1/access_tokens",
+	}, sent)
+
+	mutations := rec.Mutations()
+	require.Len(t, mutations, 3)
+	assert.Equal(t, http.MethodPost, mutations[0].Method)
+	assert.Equal(t, srv.URL+"/api/v3/repos/vitessio/vitess/issues/42/comments", mutations[0].URL)
+	assert.JSONEq(t, `{"body": "hello"}`, mutations[0].Body)
+	assert.JSONEq(t, `{"title": "[release-18.0] Fix a bug (#1)", "head": "backport-1-to-release-18.0", "base": "release-18.0"}`, mutations[1].Body)
+	assert.JSONEq(t, `["NeedsIssue"]`, mutations[2].Body)
+}
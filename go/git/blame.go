@@ -0,0 +1,164 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/vitess.io/vitess-bot/go/shell"
+)
+
+// BlamedCommit is a commit blamed for some lines of a file.
+type BlamedCommit struct {
+	SHA     string
+	Summary string
+}
+
+// LineRange is a range of lines of a file, starting at 1, both ends included.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,\d+)? @@`)
+
+// ChangedLines returns the lines of path at from that were changed by to. Lines
+// inserted by to are represented by the line they were inserted after.
+func (r *Repo) ChangedLines(ctx context.Context, from, to, path string) ([]LineRange, error) {
+	out, err := shell.NewContext(ctx, "git", "diff", "--no-color", "--unified=0", from, to, "--", path).InDir(r.LocalDir).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to diff %s between %s and %s", path, from, to)
+	}
+
+	var ranges []LineRange
+	for _, line := range strings.Split(string(out), "\n") {
+		m := hunkHeaderRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+
+		if count == 0 {
+			// A pure insertion, after the line start.
+			if start == 0 {
+				start = 1
+			}
+			count = 1
+		}
+		ranges = append(ranges, LineRange{Start: start, End: start + count - 1})
+	}
+
+	return ranges, nil
+}
+
+// Blame returns the commits that last changed the given lines of path at rev,
+// in the order they appear in the file. If since is not empty, only the
+// commits of since..rev are returned.
+func (r *Repo) Blame(ctx context.Context, rev, path string, lines []LineRange, since string) ([]BlamedCommit, error) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	args := []string{"blame", "--line-porcelain"}
+	for _, l := range lines {
+		args = append(args, fmt.Sprintf("-L%d,%d", l.Start, l.End))
+	}
+	if since != "" {
+		rev = since + ".." + rev
+	}
+	args = append(args, rev, "--", path)
+
+	out, err := shell.NewContext(ctx, "git", args...).InDir(r.LocalDir).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to blame %s at %s", path, rev)
+	}
+
+	return uniqueCommits(parseBlame(out), nil), nil
+}
+
+// uniqueCommits returns the commits blamed for lines, or for all the lines if
+// nil, in the order of the lines and without duplicates.
+func uniqueCommits(commits map[int]BlamedCommit, lines []int) []BlamedCommit {
+	if lines == nil {
+		for line := range commits {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+	}
+
+	var unique []BlamedCommit
+	seen := map[string]bool{}
+	for _, line := range lines {
+		commit, ok := commits[line]
+		if !ok || seen[commit.SHA] {
+			continue
+		}
+		seen[commit.SHA] = true
+		unique = append(unique, commit)
+	}
+
+	return unique
+}
+
+// parseBlame returns the commits of the output of `git blame --line-porcelain`,
+// by line number. Lines not committed yet, and lines older than the range of
+// commits blamed, are skipped.
+func parseBlame(out []byte) map[int]BlamedCommit {
+	commits := map[int]BlamedCommit{}
+
+	var (
+		line     int
+		commit   BlamedCommit
+		boundary bool
+	)
+	for _, text := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			// The content of the line ends its entry.
+			if strings.Trim(commit.SHA, "0") != "" && !boundary {
+				commits[line] = commit
+			}
+			line, commit, boundary = 0, BlamedCommit{}, false
+		case line == 0:
+			// The header of the entry: <sha> <original line> <final line> [<lines in group>]
+			fields := strings.Fields(text)
+			if len(fields) < 3 {
+				continue
+			}
+			commit.SHA = fields[0]
+			line, _ = strconv.Atoi(fields[2])
+		case text == "boundary":
+			boundary = true
+		case strings.HasPrefix(text, "summary "):
+			commit.Summary = strings.TrimPrefix(text, "summary ")
+		}
+	}
+
+	return commits
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/vitess.io/vitess-bot/go/shell"
+)
+
+// Conflict is a file left with conflicts by a cherry-pick or a merge.
+type Conflict struct {
+	Path string
+	// Hunks is the number of conflicting regions in the file. It is 0 when the
+	// file was deleted on one side and modified on the other.
+	Hunks int
+	// Commits are the commits that last changed the conflicting regions on the
+	// side of HEAD, in the order they appear in the file.
+	Commits []BlamedCommit
+}
+
+const (
+	conflictStart = "<<<<<<< "
+	conflictBase  = "||||||| "
+	conflictSep   = "======="
+	conflictEnd   = ">>>>>>> "
+)
+
+// Conflicts returns the files left with conflicts in the working tree, along
+// with the commits of HEAD that last changed their conflicting regions.
+func (r *Repo) Conflicts(ctx context.Context) ([]Conflict, error) {
+	out, err := shell.NewContext(ctx, "git", "diff", "--name-only", "--diff-filter=U", "-z").InDir(r.LocalDir).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list the conflicting files in %s", r.LocalDir)
+	}
+
+	var conflicts []Conflict
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path == "" {
+			continue
+		}
+
+		conflict, err := r.conflict(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	return conflicts, nil
+}
+
+// conflict counts the conflicting regions of path and blames the lines of
+// HEAD's side of each of them.
+func (r *Repo) conflict(ctx context.Context, path string) (Conflict, error) {
+	conflict := Conflict{Path: path}
+
+	content, err := os.ReadFile(filepath.Join(r.LocalDir, path))
+	if os.IsNotExist(err) {
+		return conflict, nil
+	}
+	if err != nil {
+		return conflict, errors.Wrapf(err, "Failed to read conflicting file %s", path)
+	}
+
+	// Line numbers, starting at 1, of HEAD's side of the conflicting regions.
+	var ours []int
+	inOurs := false
+	for i, text := range strings.Split(string(content), "\n") {
+		switch {
+		case strings.HasPrefix(text, conflictStart):
+			conflict.Hunks++
+			inOurs = true
+		case strings.HasPrefix(text, conflictBase), text == conflictSep, strings.HasPrefix(text, conflictEnd):
+			inOurs = false
+		case inOurs:
+			ours = append(ours, i+1)
+		}
+	}
+	if len(ours) == 0 {
+		return conflict, nil
+	}
+
+	// Blaming the content of the working tree attributes the lines coming
+	// from HEAD to their commits, while keeping the line numbers of the file.
+	blame, err := shell.NewContext(ctx, "git", "blame", "--line-porcelain", "--contents", path, "--", path).InDir(r.LocalDir).Output()
+	if err != nil {
+		return conflict, errors.Wrapf(err, "Failed to blame conflicting file %s", path)
+	}
+
+	conflict.Commits = uniqueCommits(parseBlame(blame), ours)
+	return conflict, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/git/gittest"
+)
+
+func config(version, name string) string {
+	return fmt.Sprintf("package config\n\nconst Version = %s\n%sconst Name = %q\n", version, strings.Repeat("\n// Filler.\n", 5), name)
+}
+
+func TestConflicts(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	origin := gittest.NewOrigin(t, root, "vitessio", "vitess", "main")
+	origin.Commit("main", "Add the config", map[string]string{
+		"config.go": config("18", "vitess"),
+		"docs.md":   "# Docs\n",
+	})
+	origin.Branch("release-18.0", "main")
+	version := origin.Commit("release-18.0", "Patch the version", map[string]string{"config.go": config("18.1", "vitess")})
+	name := origin.Commit("release-18.0", "Rename the release", map[string]string{"config.go": config("18.1", "vitess-18")})
+	origin.Commit("release-18.0", "Remove the docs", map[string]string{"docs.md": ""})
+
+	clean := origin.MergePR("main", "add-feature", "Add a feature", map[string]string{"feature.go": "package feature\n"})
+	conflicting := origin.MergePR("main", "bump", "Bump the version", map[string]string{
+		"config.go": config("19", "vitess-19"),
+		"docs.md":   "# Docs\n\nVersion 19.\n",
+	})
+
+	worktrees := NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+
+	tcases := []struct {
+		name     string
+		sha      string
+		expected []Conflict
+	}{
+		{name: "clean", sha: clean},
+		{
+			name: "conflict",
+			sha:  conflicting,
+			expected: []Conflict{
+				{
+					Path:  "config.go",
+					Hunks: 2,
+					Commits: []BlamedCommit{
+						{SHA: version, Summary: "Patch the version"},
+						{SHA: name, Summary: "Rename the release"},
+					},
+				},
+				{Path: "docs.md"},
+			},
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			repo, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", tc.name)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, worktrees.Release(ctx, repo))
+			}()
+
+			require.NoError(t, repo.ResetHard(ctx, "origin/release-18.0"))
+			_ = repo.CherryPickMerge(ctx, tc.sha)
+
+			conflicts, err := repo.Conflicts(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, conflicts)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPSRemoteURLTemplate is the template of the URL of the repositories on
+// github.com over HTTPS, to be used along with a TokenSource.
+const HTTPSRemoteURLTemplate = "https://github.com/{owner}/{repo}.git"
+
+// TokenSource returns an access token to the repository owner/name, used to
+// authenticate the git commands talking to its remote over HTTPS.
+//
+// It is called before each of these commands, so that long-running jobs do not
+// outlive their token: implementations should cache tokens until they are
+// about to expire.
+type TokenSource func(ctx context.Context, owner, name string) (string, error)
+
+// authEnv returns the environment variables making git authenticate to the
+// remote of owner/name with a token of tokens, if not nil.
+//
+// The token is sent as an extra HTTP header configured through the
+// environment, rather than in the remote URL or the git configuration, so that
+// it is never written to disk.
+func authEnv(ctx context.Context, tokens TokenSource, owner, name string) ([]string, error) {
+	if tokens == nil {
+		return nil, nil
+	}
+
+	token, err := tokens(ctx, owner, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get an access token to %s/%s", owner, name)
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	return []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + auth,
+	}, nil
+}
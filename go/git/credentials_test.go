@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/git/gittest"
+)
+
+func TestTokenSource(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	origin := gittest.NewOrigin(t, root, "vitessio", "vitess", "main")
+	server := gittest.NewHTTPServer(t, root, "first-token")
+
+	tcases := []struct {
+		name   string
+		tokens TokenSource
+		err    string
+	}{
+		{
+			name: "no token",
+			err:  "Failed to fetch origin",
+		},
+		{
+			name: "failing token source",
+			tokens: func(ctx context.Context, owner, name string) (string, error) {
+				return "", errors.New("no installation")
+			},
+			err: "Failed to get an access token to vitessio/vitess: no installation",
+		},
+		{
+			name: "revoked token",
+			tokens: func(ctx context.Context, owner, name string) (string, error) {
+				return "revoked-token", nil
+			},
+			err: "Failed to fetch origin",
+		},
+		{
+			name: "valid token",
+			tokens: func(ctx context.Context, owner, name string) (string, error) {
+				return "first-token", nil
+			},
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			worktrees := NewWorktrees(t.TempDir()).
+				WithRemoteURLTemplate(server.RemoteURLTemplate()).
+				WithTokenSource(tc.tokens)
+
+			repo, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", tc.name)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, worktrees.Release(ctx, repo))
+		})
+	}
+
+	// The token source is called before every command talking to the remote,
+	// so that tokens can be refreshed during a job.
+	token := "first-token"
+	var calls []string
+	worktrees := NewWorktrees(t.TempDir()).
+		WithRemoteURLTemplate(server.RemoteURLTemplate()).
+		WithTokenSource(func(ctx context.Context, owner, name string) (string, error) {
+			calls = append(calls, owner+"/"+name)
+			return token, nil
+		})
+
+	repo, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", "push")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, worktrees.Release(ctx, repo))
+	}()
+
+	require.NoError(t, repo.Checkout(ctx, "-bfeature"))
+	require.NoError(t, os.WriteFile(filepath.Join(repo.LocalDir, "feature.go"), []byte("package feature\n"), 0666))
+	require.NoError(t, repo.Add(ctx, "feature.go"))
+	require.NoError(t, repo.Commit(ctx, "Add a feature", CommitOpts{}))
+
+	server.Revoke("first-token")
+	server.Allow("second-token")
+	assert.Error(t, repo.Push(ctx, PushOpts{Remote: "origin", Refs: []string{"feature"}}))
+
+	token = "second-token"
+	require.NoError(t, repo.Push(ctx, PushOpts{Remote: "origin", Refs: []string{"feature"}}))
+	require.NoError(t, repo.Fetch(ctx, "origin"))
+	assert.Equal(t, "package feature", origin.File("feature", "feature.go"))
+
+	assert.Equal(t, []string{"vitessio/vitess", "vitessio/vitess", "vitessio/vitess", "vitessio/vitess"}, calls)
+	for _, user := range server.Users() {
+		assert.Equal(t, "x-access-token", user)
+	}
+
+	// The token is not persisted in the configuration of the clone.
+	config, err := exec.Command("git", "-C", repo.LocalDir, "config", "--list").Output()
+	require.NoError(t, err)
+	assert.NotContains(t, string(config), "extraheader")
+	assert.NotContains(t, string(config), "token")
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gittest
+
+import (
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// HTTPServer serves the origins created under a root directory over the smart
+// HTTP protocol of git, requiring basic authentication as GitHub does.
+type HTTPServer struct {
+	*httptest.Server
+
+	m      sync.Mutex
+	tokens map[string]bool
+	users  []string
+}
+
+// NewHTTPServer starts serving the origins created under root, which is closed
+// at the end of the test. Requests are only accepted with one of the tokens as
+// password, see Allow.
+func NewHTTPServer(t testing.TB, root string, tokens ...string) *HTTPServer {
+	t.Helper()
+
+	s := &HTTPServer{tokens: map[string]bool{}}
+	s.Allow(tokens...)
+
+	backend := &cgi.Handler{
+		Path: filepath.Join(run(t, root, "--exec-path"), "git-http-backend"),
+		Root: "/",
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + root,
+			"GIT_HTTP_EXPORT_ALL=1",
+			// Pushes are only accepted from authenticated users by default,
+			// which the backend cannot tell.
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.receivepack",
+			"GIT_CONFIG_VALUE_0=true",
+		},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, token, ok := req.BasicAuth()
+
+		s.m.Lock()
+		allowed := ok && s.tokens[token]
+		if allowed {
+			s.users = append(s.users, user)
+		}
+		s.m.Unlock()
+
+		if !allowed {
+			w.Header().Set("WWW-Authenticate", `Basic realm="GitHub"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		backend.ServeHTTP(w, req)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Allow makes the server accept the tokens, in addition to the previous ones.
+func (s *HTTPServer) Allow(tokens ...string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, token := range tokens {
+		s.tokens[token] = true
+	}
+}
+
+// Revoke makes the server reject the tokens.
+func (s *HTTPServer) Revoke(tokens ...string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, token := range tokens {
+		delete(s.tokens, token)
+	}
+}
+
+// Users returns the users authenticated by the requests accepted so far.
+func (s *HTTPServer) Users() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return append([]string(nil), s.users...)
+}
+
+// RemoteURLTemplate returns the remote URL template, see git.RemoteURL,
+// matching the origins served.
+func (s *HTTPServer) RemoteURLTemplate() string {
+	return s.URL + "/{owner}/{repo}.git"
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gittest builds local bare repositories acting as the origin of the
+// repositories under test, so that git operations can be tested without
+// github.com.
+package gittest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Isolate makes the git commands of the test ignore the global and system
+// configurations, never prompt for credentials, and gives them an identity to
+// commit with.
+func Isolate(t testing.TB) {
+	t.Helper()
+
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_TERMINAL_PROMPT", "0")
+	t.Setenv("GIT_AUTHOR_NAME", "Test Author")
+	t.Setenv("GIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test Committer")
+	t.Setenv("GIT_COMMITTER_EMAIL", "committer@example.com")
+}
+
+// RemoteURLTemplate returns the remote URL template, see git.RemoteURL,
+// matching the origins created under root.
+func RemoteURLTemplate(root string) string {
+	return filepath.Join(root, "{owner}", "{repo}.git")
+}
+
+// Origin is a bare repository, along with a clone used to build its history.
+type Origin struct {
+	t testing.TB
+
+	// Dir is the directory of the bare repository, usable as a remote URL.
+	Dir  string
+	work string
+}
+
+// NewOrigin creates the bare repository root/owner/name.git, whose
+// defaultBranch has a single commit adding a README.md.
+//
+// It calls Isolate, so it cannot be used in parallel tests.
+func NewOrigin(t testing.TB, root, owner, name, defaultBranch string) *Origin {
+	t.Helper()
+	Isolate(t)
+
+	o := &Origin{
+		t:    t,
+		Dir:  filepath.Join(root, owner, name+".git"),
+		work: t.TempDir(),
+	}
+
+	if err := os.MkdirAll(o.Dir, 0777|os.ModeDir); err != nil {
+		t.Fatal(err)
+	}
+	run(t, o.Dir, "init", "--bare")
+	run(t, o.Dir, "symbolic-ref", "HEAD", "refs/heads/"+defaultBranch)
+
+	run(t, o.work, "init")
+	run(t, o.work, "remote", "add", "origin", o.Dir)
+	run(t, o.work, "checkout", "-b", defaultBranch)
+	o.Commit(defaultBranch, "Initial commit", map[string]string{"README.md": name + "\n"})
+
+	return o
+}
+
+// Git runs a git command in the clone used to build the history, and returns
+// its trimmed output.
+func (o *Origin) Git(arg ...string) string {
+	o.t.Helper()
+	return run(o.t, o.work, arg...)
+}
+
+// Branch creates the branch name from the ref from and pushes it.
+func (o *Origin) Branch(name, from string) string {
+	o.t.Helper()
+
+	o.Git("checkout", "-B", name, from)
+	o.Git("push", "-q", "origin", name)
+	return o.Git("rev-parse", "HEAD")
+}
+
+// Commit commits files on branch and pushes it, creating the branch from the
+// current commit if needed. Files with an empty content are deleted. It
+// returns the SHA of the commit.
+func (o *Origin) Commit(branch, message string, files map[string]string) string {
+	o.t.Helper()
+
+	if o.Git("branch", "--list", branch) == "" {
+		o.Git("checkout", "-b", branch)
+	} else {
+		o.Git("checkout", branch)
+	}
+
+	for path, content := range files {
+		full := filepath.Join(o.work, path)
+		if content == "" {
+			o.Git("rm", "-q", path)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(full), 0777|os.ModeDir); err != nil {
+			o.t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0666); err != nil {
+			o.t.Fatal(err)
+		}
+		o.Git("add", path)
+	}
+
+	o.Git("commit", "-q", "--allow-empty", "-m", message)
+	o.Git("push", "-q", "origin", branch)
+	return o.Git("rev-parse", "HEAD")
+}
+
+// Merge merges head into base with a merge commit, as GitHub does when merging
+// a Pull Request, and pushes base. It returns the SHA of the merge commit.
+func (o *Origin) Merge(base, head, message string) string {
+	o.t.Helper()
+
+	o.Git("checkout", base)
+	o.Git("merge", "-q", "--no-ff", "-m", message, head)
+	o.Git("push", "-q", "origin", base)
+	return o.Git("rev-parse", "HEAD")
+}
+
+// MergePR commits files on a new branch created from base, then merges it into
+// base, as when merging a Pull Request. It returns the SHA of the merge commit.
+func (o *Origin) MergePR(base, branch, message string, files map[string]string) string {
+	o.t.Helper()
+
+	o.Branch(branch, base)
+	o.Commit(branch, message, files)
+	return o.Merge(base, branch, "Merge branch '"+branch+"'")
+}
+
+// Change is a commit of a Pull Request.
+type Change struct {
+	Message string
+	// Files are the contents of the files changed by the commit, see Commit.
+	Files map[string]string
+}
+
+// RebasePR commits changes on a new branch created from base, then rebases
+// and merges it into base, as when rebasing and merging a Pull Request. It
+// returns the SHAs of the rebased commits, oldest first.
+func (o *Origin) RebasePR(base, branch string, changes []Change) []string {
+	o.t.Helper()
+
+	o.Branch(branch, base)
+	for _, change := range changes {
+		o.Commit(branch, change.Message, change.Files)
+	}
+
+	o.Git("rebase", "-q", "--force-rebase", base, branch)
+	o.Git("checkout", base)
+	o.Git("merge", "-q", "--ff-only", branch)
+	o.Git("push", "-q", "origin", base)
+	return strings.Fields(o.Git("rev-list", "--reverse", fmt.Sprintf("--max-count=%d", len(changes)), "HEAD"))
+}
+
+// SquashPR commits changes on a new branch created from base, then squashes
+// and merges it into base with message, as when squashing and merging a Pull
+// Request. It returns the SHA of the squashed commit.
+func (o *Origin) SquashPR(base, branch, message string, changes []Change) string {
+	o.t.Helper()
+
+	o.Branch(branch, base)
+	for _, change := range changes {
+		o.Commit(branch, change.Message, change.Files)
+	}
+
+	o.Git("checkout", base)
+	o.Git("merge", "-q", "--squash", branch)
+	o.Git("commit", "-q", "-m", message)
+	o.Git("push", "-q", "origin", base)
+	return o.Git("rev-parse", "HEAD")
+}
+
+// Rev returns the SHA ref points to in the bare repository.
+func (o *Origin) Rev(ref string) string {
+	o.t.Helper()
+	return run(o.t, o.Dir, "rev-parse", ref)
+}
+
+// SetRef points ref to sha in the bare repository, or deletes it if sha is
+// empty, as a push would.
+func (o *Origin) SetRef(ref, sha string) {
+	o.t.Helper()
+
+	if sha == "" {
+		run(o.t, o.Dir, "update-ref", "-d", ref)
+		return
+	}
+	run(o.t, o.Dir, "update-ref", ref, sha)
+}
+
+// File returns the content of a file at ref in the bare repository.
+func (o *Origin) File(ref, path string) string {
+	o.t.Helper()
+	return run(o.t, o.Dir, "show", ref+":"+path)
+}
+
+// Log returns the subjects of the commits of ref in the bare repository, most
+// recent first, down to and excluding since if not empty.
+func (o *Origin) Log(ref, since string) []string {
+	o.t.Helper()
+
+	rng := ref
+	if since != "" {
+		rng = since + ".." + ref
+	}
+	out := run(o.t, o.Dir, "log", "--format=%s", rng)
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+func run(t testing.TB, dir string, arg ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", arg...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s in %s: %v\n%s", strings.Join(arg, " "), dir, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
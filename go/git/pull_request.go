@@ -104,3 +104,25 @@ func (r *Repo) ListPRFiles(ctx context.Context, client *github.Client, pr int) (
 
 	return allFiles, nil
 }
+
+// ListPRCommits returns a list of all commits of a given PR in the repo, oldest
+// first.
+func (r *Repo) ListPRCommits(ctx context.Context, client *github.Client, pr int) (allCommits []*github.RepositoryCommit, err error) {
+	cont := true
+	for page := 1; cont; page++ {
+		commits, _, err := client.PullRequests.ListCommits(ctx, r.Owner, r.Name, pr, &github.ListOptions{
+			Page:    page,
+			PerPage: rowsPerPage,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list commits in Pull Request %s/%s#%d - at page %d", r.Owner, r.Name, pr, page)
+		}
+		allCommits = append(allCommits, commits...)
+		if len(commits) < rowsPerPage {
+			cont = false
+			break
+		}
+	}
+
+	return allCommits, nil
+}
@@ -21,14 +21,38 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/vitess.io/vitess-bot/go/dryrun"
 	"github.com/vitess.io/vitess-bot/go/shell"
 )
 
+// DefaultRemoteURLTemplate is the template of the URL repositories are cloned
+// from, see RemoteURL.
+const DefaultRemoteURLTemplate = "git@github.com:{owner}/{repo}.git"
+
+// RemoteURL expands the {owner} and {repo} placeholders of a remote URL
+// template.
+func RemoteURL(template, owner, name string) string {
+	return strings.NewReplacer("{owner}", owner, "{repo}", name).Replace(template)
+}
+
 type Repo struct {
 	Owner         string
 	Name          string
 	DefaultBranch string
 	LocalDir      string
+	// RemoteURL is the URL the repository is cloned from. Defaults to
+	// DefaultRemoteURLTemplate.
+	RemoteURL string
+
+	// store is the shared clone of the repository when LocalDir is one of
+	// its worktrees.
+	store *store
+	// lockKey is the lock held by the worktree until released.
+	lockKey string
+	// dryRun, if set, records pushes instead of running them.
+	dryRun *dryrun.Recorder
+	// tokens, if set, authenticates the commands talking to the remote.
+	tokens TokenSource
 }
 
 func NewRepo(owner, name string) *Repo {
@@ -49,6 +73,33 @@ func (r *Repo) WithDefaultBranch(branch string) *Repo {
 	return r
 }
 
+// WithDryRun makes the repository record pushes with rec instead of running
+// them.
+func (r *Repo) WithDryRun(rec *dryrun.Recorder) *Repo {
+	r.dryRun = rec
+	return r
+}
+
+// WithRemoteURL sets the URL the repository is cloned from.
+func (r *Repo) WithRemoteURL(url string) *Repo {
+	r.RemoteURL = url
+	return r
+}
+
+// WithTokenSource makes the repository authenticate to its remote over HTTPS
+// with the access tokens of tokens.
+func (r *Repo) WithTokenSource(tokens TokenSource) *Repo {
+	r.tokens = tokens
+	return r
+}
+
+func (r *Repo) remoteURL() string {
+	if r.RemoteURL != "" {
+		return r.RemoteURL
+	}
+	return RemoteURL(DefaultRemoteURLTemplate, r.Owner, r.Name)
+}
+
 func (r *Repo) Add(ctx context.Context, arg ...string) error {
 	_, err := shell.NewContext(ctx, "git", append([]string{"add"}, arg...)...).InDir(r.LocalDir).Output()
 	return err
@@ -59,6 +110,13 @@ func (r *Repo) Checkout(ctx context.Context, ref string) error {
 	return err
 }
 
+// CheckoutNewBranch checks out branch, created or reset at startPoint. It does
+// not depend on branch existing on any remote.
+func (r *Repo) CheckoutNewBranch(ctx context.Context, branch, startPoint string) error {
+	_, err := shell.NewContext(ctx, "git", "checkout", "-B", branch, startPoint).InDir(r.LocalDir).Output()
+	return err
+}
+
 func (r *Repo) CherryPickMerge(ctx context.Context, sha string) error {
 	_, err := shell.NewContext(ctx, "git", append([]string{"cherry-pick", "-m", "1"}, sha)...).InDir(r.LocalDir).Output()
 	return err
@@ -70,7 +128,12 @@ func (r *Repo) Clean(ctx context.Context) error {
 }
 
 func (r *Repo) Clone(ctx context.Context) error {
-	_, err := shell.NewContext(ctx, "git", "clone", fmt.Sprintf("git@github.com:%s/%s.git", r.Owner, r.Name), r.LocalDir).Output()
+	if r.store != nil {
+		// Worktrees are checked out when acquired.
+		return nil
+	}
+
+	_, err := r.gitRemote(ctx, "", "clone", r.remoteURL(), r.LocalDir)
 	if err != nil && !strings.Contains(err.Error(), "already exists and is not an empty directory") {
 		return err
 	}
@@ -80,6 +143,8 @@ func (r *Repo) Clone(ctx context.Context) error {
 
 type CommitOpts struct {
 	Author string
+	// Trailers are appended to the message, e.g. "Co-authored-by: ...".
+	Trailers []string
 
 	Amend  bool
 	NoEdit bool
@@ -100,6 +165,10 @@ func (r *Repo) Commit(ctx context.Context, msg string, opts CommitOpts) error {
 		args = append(args, fmt.Sprintf("--author=%q", opts.Author))
 	}
 
+	for _, trailer := range opts.Trailers {
+		args = append(args, "--trailer", trailer)
+	}
+
 	if opts.Amend {
 		args = append(args, "--amend")
 	}
@@ -108,6 +177,16 @@ func (r *Repo) Commit(ctx context.Context, msg string, opts CommitOpts) error {
 	return err
 }
 
+// CommitMessage returns the full message of the commit sha.
+func (r *Repo) CommitMessage(ctx context.Context, sha string) (string, error) {
+	out, err := shell.NewContext(ctx, "git", "show", "-s", "--format=%B", sha).InDir(r.LocalDir).Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
 type DiffTreeOpts struct {
 	Recursive bool
 }
@@ -132,12 +211,49 @@ func (r *Repo) FetchRef(ctx context.Context, remote, ref string) error {
 }
 
 func (r *Repo) fetch(ctx context.Context, arg ...string) error {
-	_, err := shell.NewContext(ctx, "git", append([]string{"fetch"}, arg...)...).InDir(r.LocalDir).Output()
+	if r.store != nil {
+		// Fetching updates the refs shared with the other worktrees.
+		r.store.m.Lock()
+		defer r.store.m.Unlock()
+	}
+
+	_, err := r.gitRemote(ctx, r.LocalDir, append([]string{"fetch"}, arg...)...)
 	return err
 }
 
+// Log returns the subjects of the commits listed by `git log` with the given
+// arguments, most recent first.
+func (r *Repo) Log(ctx context.Context, arg ...string) ([]string, error) {
+	out, err := shell.NewContext(ctx, "git", append([]string{"log", "--format=%s"}, arg...)...).InDir(r.LocalDir).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := strings.TrimSpace(string(out))
+	if trimmed == "" {
+		return nil, nil
+	}
+	return strings.Split(trimmed, "\n"), nil
+}
+
+// MergeBase returns the SHA of the best common ancestor of a and b.
+func (r *Repo) MergeBase(ctx context.Context, a, b string) (string, error) {
+	out, err := shell.NewContext(ctx, "git", "merge-base", a, b).InDir(r.LocalDir).Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Parents returns the SHAs of the parents of the commit sha, the first parent
+// first.
+func (r *Repo) Parents(ctx context.Context, sha string) ([]string, error) {
+	return r.shas(ctx, "rev-parse", sha+"^@")
+}
+
 func (r *Repo) Pull(ctx context.Context) error {
-	_, err := shell.NewContext(ctx, "git", "pull").InDir(r.LocalDir).Output()
+	_, err := r.gitRemote(ctx, r.LocalDir, "pull")
 	return err
 }
 
@@ -167,15 +283,50 @@ func (r *Repo) Push(ctx context.Context, opts PushOpts) error {
 		}
 	}
 
-	_, err := shell.NewContext(ctx, "git", args...).InDir(r.LocalDir).Output()
+	if r.dryRun != nil {
+		r.dryRun.Record(ctx, dryrun.Mutation{
+			Dir:     r.LocalDir,
+			Command: append([]string{"git"}, args...),
+		})
+		return nil
+	}
+
+	_, err := r.gitRemote(ctx, r.LocalDir, args...)
 	return err
 }
 
+// gitRemote runs a git command talking to the remote in dir, authenticated
+// with the token source of the repository, if any.
+func (r *Repo) gitRemote(ctx context.Context, dir string, arg ...string) ([]byte, error) {
+	env, err := authEnv(ctx, r.tokens, r.Owner, r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return shell.NewContext(ctx, "git", arg...).InDir(dir).WithExtraEnv(env...).Output()
+}
+
 func (r *Repo) ResetHard(ctx context.Context, ref string) error {
 	_, err := shell.NewContext(ctx, "git", append([]string{"reset", "--hard"}, ref)...).InDir(r.LocalDir).Output()
 	return err
 }
 
+// RevList returns the SHAs of the commits listed by `git rev-list` with the
+// given arguments, most recent first.
+func (r *Repo) RevList(ctx context.Context, arg ...string) ([]string, error) {
+	return r.shas(ctx, append([]string{"rev-list"}, arg...)...)
+}
+
+// shas runs a git command printing SHAs and returns them.
+func (r *Repo) shas(ctx context.Context, arg ...string) ([]string, error) {
+	out, err := shell.NewContext(ctx, "git", arg...).InDir(r.LocalDir).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(string(out)), nil
+}
+
 func (r *Repo) Status(ctx context.Context, arg ...string) ([]byte, error) {
 	return shell.NewContext(ctx, "git", append([]string{"status"}, arg...)...).InDir(r.LocalDir).Output()
 }
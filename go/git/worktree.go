@@ -0,0 +1,273 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/vitess.io/vitess-bot/go/dryrun"
+	"github.com/vitess.io/vitess-bot/go/shell"
+)
+
+// Worktrees hands out isolated `git worktree` checkouts, so that independent
+// jobs can work on the same repository concurrently. All the worktrees of a
+// repository share the objects of a single bare clone.
+type Worktrees struct {
+	dir               string
+	remoteURLTemplate string
+
+	m      sync.Mutex
+	stores map[string]*store
+	seq    int
+	// locks hand out the worktrees of each repository and job one at a time,
+	// by repository and job.
+	locks map[string]*jobLock
+
+	dryRun *dryrun.Recorder
+	tokens TokenSource
+}
+
+// jobLock is held by the worktree of a job, until released. refs counts the
+// worktrees holding or waiting for it.
+type jobLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// store is the bare clone shared by all the worktrees of a repository.
+type store struct {
+	dir          string
+	worktreesDir string
+
+	// m serializes the operations writing to the shared refs, e.g. fetches
+	// and adding or removing worktrees.
+	m           sync.Mutex
+	initialized bool
+}
+
+// NewWorktrees returns a manager keeping its clones and worktrees under dir.
+func NewWorktrees(dir string) *Worktrees {
+	return &Worktrees{
+		dir:               dir,
+		remoteURLTemplate: DefaultRemoteURLTemplate,
+		stores:            map[string]*store{},
+		locks:             map[string]*jobLock{},
+	}
+}
+
+var unsafeWorktreeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// WithDryRun makes the repositories handed out record pushes with rec instead
+// of running them.
+func (w *Worktrees) WithDryRun(rec *dryrun.Recorder) *Worktrees {
+	w.dryRun = rec
+	return w
+}
+
+// WithRemoteURLTemplate sets the template of the URL the repositories are
+// cloned from, see RemoteURL. It only applies to repositories that were not
+// cloned yet.
+func (w *Worktrees) WithRemoteURLTemplate(template string) *Worktrees {
+	w.remoteURLTemplate = template
+	return w
+}
+
+// WithTokenSource makes the repositories handed out, and their shared clones,
+// authenticate to their remote over HTTPS with the access tokens of tokens.
+func (w *Worktrees) WithTokenSource(tokens TokenSource) *Worktrees {
+	w.tokens = tokens
+	return w
+}
+
+// Acquire returns a repository checked out in a new worktree, detached at the
+// tip of defaultBranch on origin. The job names the work done in the worktree,
+// typically after the branch it checks out: the worktrees of a repository for
+// the same job are handed out one at a time, Acquire waiting for the previous
+// one to be released, so that concurrent jobs do not work on the same branch.
+//
+// The worktree must be given back with Release once done.
+func (w *Worktrees) Acquire(ctx context.Context, owner, name, defaultBranch, job string) (repo *Repo, err error) {
+	key := owner + "/" + name
+	lockKey := key + ":" + job
+	if err := w.lock(ctx, lockKey); err != nil {
+		return nil, errors.Wrapf(err, "Failed to wait for the worktree of %s for %s", key, job)
+	}
+	defer func() {
+		if err != nil {
+			w.unlock(lockKey)
+		}
+	}()
+
+	w.m.Lock()
+	s, ok := w.stores[key]
+	if !ok {
+		s = &store{
+			dir:          filepath.Join(w.dir, owner, name+".git"),
+			worktreesDir: filepath.Join(w.dir, owner, name+".worktrees"),
+		}
+		w.stores[key] = s
+	}
+	w.seq++
+	seq := w.seq
+	w.m.Unlock()
+
+	repo = NewRepo(owner, name).
+		WithDefaultBranch(defaultBranch).
+		WithRemoteURL(RemoteURL(w.remoteURLTemplate, owner, name)).
+		WithDryRun(w.dryRun).
+		WithTokenSource(w.tokens)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := s.init(ctx, repo.remoteURL()); err != nil {
+		return nil, errors.Wrapf(err, "Failed to initialize the clone of %s", key)
+	}
+
+	if _, err := repo.gitRemote(ctx, s.dir, "fetch", "--prune", "origin"); err != nil {
+		return nil, errors.Wrapf(err, "Failed to fetch origin in the clone of %s", key)
+	}
+
+	dir := filepath.Join(s.worktreesDir, fmt.Sprintf("%s-%d", unsafeWorktreeChars.ReplaceAllString(job, "-"), seq))
+	if _, err := s.git(ctx, "worktree", "add", "--detach", dir, "origin/"+defaultBranch); err != nil {
+		return nil, errors.Wrapf(err, "Failed to add worktree %s of %s", dir, key)
+	}
+
+	repo.LocalDir = dir
+	repo.store = s
+	repo.lockKey = lockKey
+	return repo, nil
+}
+
+// lock takes the lock of key, waiting for it to be unlocked if needed.
+func (w *Worktrees) lock(ctx context.Context, key string) error {
+	w.m.Lock()
+	l, ok := w.locks[key]
+	if !ok {
+		l = &jobLock{ch: make(chan struct{}, 1)}
+		w.locks[key] = l
+	}
+	l.refs++
+	w.m.Unlock()
+
+	select {
+	case l.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		w.release(key, l)
+		return ctx.Err()
+	}
+}
+
+// unlock releases the lock of key, taken with lock.
+func (w *Worktrees) unlock(key string) {
+	w.m.Lock()
+	l := w.locks[key]
+	w.m.Unlock()
+
+	<-l.ch
+	w.release(key, l)
+}
+
+// release forgets the lock l of key once no worktree holds or waits for it.
+func (w *Worktrees) release(key string, l *jobLock) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(w.locks, key)
+	}
+}
+
+// Release removes the worktree of the repository, along with the local branch
+// it had checked out, if any, and lets the next worktree of its job be
+// acquired.
+func (w *Worktrees) Release(ctx context.Context, repo *Repo) error {
+	s := repo.store
+	if s == nil {
+		return errors.Errorf("%s is not a worktree", repo.LocalDir)
+	}
+	defer w.unlock(repo.lockKey)
+
+	branch, _ := shell.NewContext(ctx, "git", "symbolic-ref", "--short", "-q", "HEAD").InDir(repo.LocalDir).Output()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, err := s.git(ctx, "worktree", "remove", "--force", repo.LocalDir); err != nil {
+		return errors.Wrapf(err, "Failed to remove worktree %s", repo.LocalDir)
+	}
+
+	if b := strings.TrimSpace(string(branch)); b != "" {
+		if _, err := s.git(ctx, "branch", "-D", b); err != nil {
+			return errors.Wrapf(err, "Failed to delete branch %s of worktree %s", b, repo.LocalDir)
+		}
+	}
+
+	return nil
+}
+
+// init clones the repository the first time it is used and gets rid of the
+// worktrees left behind by a previous run of the bot.
+//
+// Must be called with s.m held.
+func (s *store) init(ctx context.Context, url string) error {
+	if s.initialized {
+		return nil
+	}
+
+	if _, err := os.Stat(s.dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(s.dir), 0777|os.ModeDir); err != nil {
+			return err
+		}
+
+		// Rather than cloning, set up an empty bare repository so that it has
+		// no local branches, only remote-tracking ones. Local branches are
+		// created by the worktrees as needed.
+		if _, err := shell.NewContext(ctx, "git", "init", "--bare", s.dir).Output(); err != nil {
+			return err
+		}
+
+		if _, err := s.git(ctx, "remote", "add", "origin", url); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(s.worktreesDir); err != nil {
+		return err
+	}
+
+	if _, err := s.git(ctx, "worktree", "prune"); err != nil {
+		return err
+	}
+
+	s.initialized = true
+	return nil
+}
+
+func (s *store) git(ctx context.Context, arg ...string) ([]byte, error) {
+	return shell.NewContext(ctx, "git", arg...).InDir(s.dir).Output()
+}
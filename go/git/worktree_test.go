@@ -0,0 +1,192 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/dryrun"
+	"github.com/vitess.io/vitess-bot/go/git/gittest"
+)
+
+func TestRemoteURL(t *testing.T) {
+	assert.Equal(t, "git@github.com:vitessio/vitess.git", NewRepo("vitessio", "vitess").remoteURL())
+	assert.Equal(t, "/tmp/origin", NewRepo("vitessio", "vitess").WithRemoteURL("/tmp/origin").remoteURL())
+	assert.Equal(t, "https://example.com/vitessio/website.git", RemoteURL("https://example.com/{owner}/{repo}.git", "vitessio", "website"))
+}
+
+func TestWorktrees(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	origin := gittest.NewOrigin(t, root, "vitessio", "vitess", "main")
+
+	worktrees := NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+
+	first, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", "first job")
+	require.NoError(t, err)
+	second, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", "second job")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.LocalDir, second.LocalDir)
+	assert.Equal(t, origin.Dir, first.RemoteURL)
+
+	// Changes in a worktree do not affect the others.
+	require.NoError(t, first.Checkout(ctx, "-bfeature"))
+	require.NoError(t, os.WriteFile(filepath.Join(first.LocalDir, "feature.go"), []byte("package feature\n"), 0666))
+	require.NoError(t, first.Add(ctx, "feature.go"))
+	require.NoError(t, first.Commit(ctx, "Add a feature", CommitOpts{}))
+	require.NoError(t, first.Push(ctx, PushOpts{Remote: "origin", Refs: []string{"feature"}}))
+	assert.NoFileExists(t, filepath.Join(second.LocalDir, "feature.go"))
+	assert.Equal(t, "package feature", origin.File("feature", "feature.go"))
+
+	// The new branch is visible to the other worktrees once fetched. A local
+	// branch can only be checked out by one worktree at a time.
+	require.NoError(t, second.Fetch(ctx, "origin"))
+	assert.ErrorContains(t, second.Checkout(ctx, "feature"), "already checked out")
+	require.NoError(t, second.Checkout(ctx, "origin/feature"))
+	assert.FileExists(t, filepath.Join(second.LocalDir, "feature.go"))
+
+	// Releasing removes the worktree and its local branch, so that the next
+	// job can check it out again.
+	require.NoError(t, worktrees.Release(ctx, first))
+	assert.NoDirExists(t, first.LocalDir)
+	require.NoError(t, worktrees.Release(ctx, second))
+
+	third, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", "third job")
+	require.NoError(t, err)
+	require.NoError(t, third.Checkout(ctx, "feature"))
+	require.NoError(t, worktrees.Release(ctx, third))
+}
+
+func TestWorktreesSameJob(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	gittest.NewOrigin(t, root, "vitessio", "vitess", "main")
+
+	worktrees := NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+
+	first, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", "backport-1-to-release-18.0")
+	require.NoError(t, err)
+	require.NoError(t, first.Checkout(ctx, "-bbackport-1-to-release-18.0"))
+
+	// Other jobs are not held back.
+	other, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", "backport-2-to-release-18.0")
+	require.NoError(t, err)
+	require.NoError(t, worktrees.Release(ctx, other))
+
+	// The same job waits for the previous worktree to be released, or for its
+	// context to be done.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = worktrees.Acquire(timeoutCtx, "vitessio", "vitess", "main", "backport-1-to-release-18.0")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan *Repo)
+	go func() {
+		second, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", "backport-1-to-release-18.0")
+		assert.NoError(t, err)
+		acquired <- second
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("the worktree of the same job was acquired before the first one was released")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, worktrees.Release(ctx, first))
+	second := <-acquired
+	require.NotNil(t, second)
+	require.NoError(t, second.Checkout(ctx, "-bbackport-1-to-release-18.0"))
+	require.NoError(t, worktrees.Release(ctx, second))
+	assert.Empty(t, worktrees.locks)
+}
+
+func TestCherryPickMerge(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	origin := gittest.NewOrigin(t, root, "vitessio", "vitess", "main")
+	origin.Commit("main", "Add the config", map[string]string{"config.go": "package config\n\nconst Version = 18\n"})
+	origin.Branch("release-18.0", "main")
+
+	clean := origin.MergePR("main", "add-feature", "Add a feature", map[string]string{"feature.go": "package feature\n"})
+	conflicting := origin.MergePR("main", "bump-version", "Bump the version", map[string]string{"config.go": "package config\n\nconst Version = 19\n"})
+	origin.Commit("release-18.0", "Patch the version", map[string]string{"config.go": "package config\n\nconst Version = 18.1\n"})
+
+	worktrees := NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+
+	tcases := []struct {
+		name     string
+		sha      string
+		conflict bool
+		dryRun   bool
+	}{
+		{name: "clean", sha: clean},
+		{name: "conflict", sha: conflicting, conflict: true},
+		{name: "dry run", sha: clean, dryRun: true},
+	}
+
+	for i, tc := range tcases {
+		i, tc := i, tc
+		t.Run(tc.name, func(t *testing.T) {
+			repo, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", tc.name)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, worktrees.Release(ctx, repo))
+			}()
+
+			var rec *dryrun.Recorder
+			if tc.dryRun {
+				rec = dryrun.New()
+				repo.WithDryRun(rec)
+			}
+
+			branch := fmt.Sprintf("backport-%d-to-release-18.0", i)
+			require.NoError(t, repo.Checkout(ctx, "-b"+branch))
+			require.NoError(t, repo.ResetHard(ctx, "origin/release-18.0"))
+
+			err = repo.CherryPickMerge(ctx, tc.sha)
+			if tc.conflict {
+				require.ErrorContains(t, err, "conflicts")
+
+				status, err := repo.Status(ctx, "--porcelain")
+				require.NoError(t, err)
+				assert.Equal(t, "UU config.go\n", string(status))
+				return
+			}
+			require.NoError(t, err)
+
+			require.NoError(t, repo.Push(ctx, PushOpts{Remote: "origin", Refs: []string{branch}, Force: true}))
+			if tc.dryRun {
+				require.Len(t, rec.Mutations(), 1)
+				assert.Equal(t, []string{"git", "push", "--force", "origin", branch}, rec.Mutations()[0].Command)
+				assert.NotContains(t, origin.Git("ls-remote", "origin"), "refs/heads/"+branch)
+				return
+			}
+
+			assert.Equal(t, []string{"Merge branch 'add-feature'", "Patch the version"}, origin.Log(branch, "release-18.0~1"))
+			assert.Equal(t, "package config\n\nconst Version = 18.1", origin.File(branch, "config.go"))
+		})
+	}
+}
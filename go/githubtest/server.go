@@ -0,0 +1,1330 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package githubtest provides an in-memory fake of the GitHub REST API, so
+// that the handlers of the bot can be tested end to end with a real
+// github.Client.
+//
+// Only the endpoints used by the bot are implemented: issue comments and
+// labels, Pull Requests, git refs, trees, blobs and commits, branches and
+// their required checks, file contents, commit checks and statuses, reviews,
+// repository labels, milestones, and installation access tokens, along with
+// the GraphQL mutation taking a Pull Request out of draft.
+package githubtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+)
+
+// DefaultLogin is the login of the user authenticated with the fake API.
+const DefaultLogin = "vitess-bot[bot]"
+
+// Repo is the state of a repository of the fake API.
+//
+// Its fields must only be accessed through Server.Update.
+type Repo struct {
+	Owner         string
+	Name          string
+	DefaultBranch string
+	// InstallationID is the ID of the installation of the App on the
+	// repository.
+	InstallationID int64
+
+	// Pulls are the Pull Requests of the repository, by number. Their labels
+	// are stored in Labels.
+	Pulls map[int]*github.PullRequest
+	// PullFiles are the files changed by each Pull Request.
+	PullFiles map[int][]*github.CommitFile
+	// PullCommits are the commits of each Pull Request, oldest first.
+	PullCommits map[int][]*github.RepositoryCommit
+	// Reviewers are the reviewers requested on each Pull Request.
+	Reviewers map[int]*github.Reviewers
+	// Reviews are the reviews submitted on each Pull Request, oldest first.
+	Reviews map[int][]*github.PullRequestReview
+	// Comments are the comments of each issue or Pull Request.
+	Comments map[int][]*github.IssueComment
+	// CheckRuns and Statuses are the check runs and commit statuses of each
+	// commit, by SHA.
+	CheckRuns map[string][]*github.CheckRun
+	Statuses  map[string][]*github.RepoStatus
+	// RequiredChecks are the contexts of the checks required by the
+	// protection of each branch. Branches missing from it are not protected.
+	RequiredChecks map[string][]string
+	// Labels are the labels of each issue or Pull Request.
+	Labels map[int][]string
+	// RepoLabels are the labels defined on the repository, by name.
+	RepoLabels map[string]*github.Label
+	// Milestones are the milestones of the repository.
+	Milestones []*github.Milestone
+	// Collaborators are the only users reviews can be requested from, if not
+	// nil.
+	Collaborators []string
+	// Teams are the teams of the owner of the repository. Reviews can only be
+	// requested from them by slug.
+	Teams []*github.Team
+
+	// Refs are the SHAs of the git references, e.g. "heads/main".
+	Refs    map[string]string
+	Commits map[string]*github.Commit
+	// Trees are the files of each tree, by path.
+	Trees map[string]map[string]*github.TreeEntry
+	Blobs map[string]string
+
+	nextNumber int
+}
+
+func newRepo(owner, name string) *Repo {
+	return &Repo{
+		Owner:          owner,
+		Name:           name,
+		DefaultBranch:  "main",
+		InstallationID: 1,
+		Pulls:          map[int]*github.PullRequest{},
+		PullFiles:      map[int][]*github.CommitFile{},
+		PullCommits:    map[int][]*github.RepositoryCommit{},
+		Reviewers:      map[int]*github.Reviewers{},
+		Reviews:        map[int][]*github.PullRequestReview{},
+		Comments:       map[int][]*github.IssueComment{},
+		CheckRuns:      map[string][]*github.CheckRun{},
+		Statuses:       map[string][]*github.RepoStatus{},
+		RequiredChecks: map[string][]string{},
+		Labels:         map[int][]string{},
+		RepoLabels:     map[string]*github.Label{},
+		Refs:           map[string]string{},
+		Commits:        map[string]*github.Commit{},
+		Trees:          map[string]map[string]*github.TreeEntry{},
+		Blobs:          map[string]string{},
+	}
+}
+
+func (r *Repo) repository() *github.Repository {
+	return &github.Repository{
+		Name:          github.String(r.Name),
+		FullName:      github.String(r.Owner + "/" + r.Name),
+		Owner:         &github.User{Login: github.String(r.Owner)},
+		DefaultBranch: github.String(r.DefaultBranch),
+	}
+}
+
+// Server is an in-memory fake of the GitHub REST API.
+type Server struct {
+	*httptest.Server
+
+	// Login is the author of the comments, Pull Requests and commits created
+	// through the API.
+	Login string
+	// TokenTTL is how long the installation access tokens created through the
+	// API are valid. Defaults to one hour, as on GitHub.
+	TokenTTL time.Duration
+
+	m           sync.Mutex
+	repos       map[string]*Repo
+	seq         int64
+	requests    []string
+	onRefUpdate func(owner, name, ref, sha string)
+	failing     map[string]bool
+	tokens      []string
+}
+
+// NewServer starts a fake API, which is closed at the end of the test.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		Login:    DefaultLogin,
+		TokenTTL: time.Hour,
+		repos:    map[string]*Repo{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Client returns a client of the fake API, sending its requests through the
+// given middleware.
+func (s *Server) Client(middleware ...githubapp.ClientMiddleware) *github.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	for _, m := range middleware {
+		transport = m(transport)
+	}
+
+	client := github.NewClient(&http.Client{Transport: transport})
+	client.BaseURL, _ = url.Parse(s.URL + "/")
+	return client
+}
+
+// ClientCreator returns a githubapp.ClientCreator whose REST clients all use
+// the fake API, through the given middleware. Its GraphQL clients are not
+// implemented.
+func (s *Server) ClientCreator(middleware ...githubapp.ClientMiddleware) githubapp.ClientCreator {
+	return &clientCreator{s: s, middleware: middleware}
+}
+
+type clientCreator struct {
+	githubapp.ClientCreator
+	s          *Server
+	middleware []githubapp.ClientMiddleware
+}
+
+func (cc *clientCreator) NewAppClient() (*github.Client, error) {
+	return cc.s.Client(cc.middleware...), nil
+}
+
+func (cc *clientCreator) NewInstallationClient(installationID int64) (*github.Client, error) {
+	return cc.s.Client(cc.middleware...), nil
+}
+
+func (cc *clientCreator) NewTokenClient(token string) (*github.Client, error) {
+	return cc.s.Client(cc.middleware...), nil
+}
+
+// Fail makes the requests of the given method and path, e.g.
+// "POST /repos/vitessio/vitess/issues/1/labels", fail with a server error.
+func (s *Server) Fail(method, path string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.failing == nil {
+		s.failing = map[string]bool{}
+	}
+	s.failing[method+" "+path] = true
+}
+
+// OnRefUpdate sets a function called whenever a git reference is created,
+// updated or deleted (with an empty sha) through the API, e.g. to mirror the
+// change to a local origin repository.
+func (s *Server) OnRefUpdate(f func(owner, name, ref, sha string)) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.onRefUpdate = f
+}
+
+// Update calls f with the repository owner/name, creating it if needed. The
+// state of the server must not be accessed concurrently with f.
+func (s *Server) Update(owner, name string, f func(r *Repo)) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f(s.repo(owner, name))
+}
+
+func (s *Server) repo(owner, name string) *Repo {
+	key := owner + "/" + name
+	r, ok := s.repos[key]
+	if !ok {
+		r = newRepo(owner, name)
+		s.repos[key] = r
+	}
+	return r
+}
+
+// Tokens returns the installation access tokens created through the API, in
+// order.
+func (s *Server) Tokens() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return append([]string(nil), s.tokens...)
+}
+
+// Requests returns the requests received by the server, as "METHOD path".
+func (s *Server) Requests() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// CreateBranch creates a branch holding the given files, in a single commit on
+// top of the current commit of the branch, if any. It returns the SHA of the
+// commit.
+func (s *Server) CreateBranch(owner, name, branch string, files map[string]string) string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r := s.repo(owner, name)
+
+	var parents []*github.Commit
+	baseTree := ""
+	if sha, ok := r.Refs["heads/"+branch]; ok {
+		parents = append(parents, &github.Commit{SHA: github.String(sha)})
+		baseTree = r.Commits[sha].GetTree().GetSHA()
+	}
+
+	entries := make([]*github.TreeEntry, 0, len(files))
+	for path, content := range files {
+		entries = append(entries, &github.TreeEntry{Path: github.String(path), Content: github.String(content)})
+	}
+
+	tree := s.createTree(r, baseTree, entries)
+	commit := s.createCommit(r, "Update "+branch, tree, parents)
+	r.Refs["heads/"+branch] = commit.GetSHA()
+
+	return commit.GetSHA()
+}
+
+// AddPullRequest adds pr to the repository, numbering it if needed, and
+// returns its number. Its labels are moved to Repo.Labels.
+func (s *Server) AddPullRequest(owner, name string, pr *github.PullRequest) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r := s.repo(owner, name)
+	if pr.Number == nil {
+		r.nextNumber++
+		pr.Number = github.Int(r.nextNumber)
+	} else if pr.GetNumber() > r.nextNumber {
+		r.nextNumber = pr.GetNumber()
+	}
+	if pr.State == nil {
+		pr.State = github.String("open")
+	}
+	if pr.NodeID == nil {
+		pr.NodeID = github.String(r.nodeID(pr.GetNumber()))
+	}
+	if pr.GetMerged() && pr.MergedAt == nil {
+		pr.MergedAt = &github.Timestamp{Time: time.Now()}
+	}
+
+	for _, label := range pr.Labels {
+		r.Labels[pr.GetNumber()] = append(r.Labels[pr.GetNumber()], label.GetName())
+	}
+	pr.Labels = nil
+
+	for _, branch := range []*github.PullRequestBranch{pr.Base, pr.Head} {
+		if branch != nil && branch.Repo == nil {
+			branch.Repo = r.repository()
+		}
+	}
+
+	r.Pulls[pr.GetNumber()] = pr
+	return pr.GetNumber()
+}
+
+// PullRequest returns a copy of a Pull Request, with its labels.
+func (s *Server) PullRequest(owner, name string, number int) *github.PullRequest {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r := s.repo(owner, name)
+	if _, ok := r.Pulls[number]; !ok {
+		return nil
+	}
+	return r.pull(number)
+}
+
+// PullRequests returns copies of all the Pull Requests of a repository, by
+// increasing number.
+func (s *Server) PullRequests(owner, name string) []*github.PullRequest {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r := s.repo(owner, name)
+	return r.pulls()
+}
+
+// Comments returns the bodies of the comments of an issue or Pull Request.
+func (s *Server) Comments(owner, name string, number int) []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var bodies []string
+	for _, comment := range s.repo(owner, name).Comments[number] {
+		bodies = append(bodies, comment.GetBody())
+	}
+	return bodies
+}
+
+// Labels returns the labels of an issue or Pull Request.
+func (s *Server) Labels(owner, name string, number int) []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return append([]string(nil), s.repo(owner, name).Labels[number]...)
+}
+
+// RepoLabels returns copies of the labels defined on a repository, sorted by
+// name.
+func (s *Server) RepoLabels(owner, name string) []*github.Label {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.repo(owner, name).repoLabels()
+}
+
+// Ref returns the SHA a git reference, e.g. "heads/main", points to.
+func (s *Server) Ref(owner, name, ref string) (string, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	sha, ok := s.repo(owner, name).Refs[ref]
+	return sha, ok
+}
+
+// File returns the content of a file on a branch.
+func (s *Server) File(owner, name, branch, path string) (string, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.repo(owner, name).file("heads/"+branch, path)
+}
+
+func (r *Repo) pull(number int) *github.PullRequest {
+	pr := *r.Pulls[number]
+	pr.Labels = nil
+	for _, label := range r.Labels[number] {
+		pr.Labels = append(pr.Labels, &github.Label{Name: github.String(label)})
+	}
+	return &pr
+}
+
+func (r *Repo) pulls() []*github.PullRequest {
+	numbers := make([]int, 0, len(r.Pulls))
+	for number := range r.Pulls {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	pulls := make([]*github.PullRequest, 0, len(numbers))
+	for _, number := range numbers {
+		pulls = append(pulls, r.pull(number))
+	}
+	return pulls
+}
+
+func (r *Repo) file(ref, path string) (string, bool) {
+	commit, ok := r.Commits[r.Refs[ref]]
+	if !ok {
+		return "", false
+	}
+
+	entry, ok := r.Trees[commit.GetTree().GetSHA()][path]
+	if !ok {
+		return "", false
+	}
+	return r.Blobs[entry.GetSHA()], true
+}
+
+func (s *Server) nextSHA() string {
+	s.seq++
+	return fmt.Sprintf("%040x", s.seq)
+}
+
+func (s *Server) createBlob(r *Repo, content string) string {
+	sha := s.nextSHA()
+	r.Blobs[sha] = content
+	return sha
+}
+
+// createTree creates a tree from baseTree and entries. Entries without SHA nor
+// content delete the file at their path.
+func (s *Server) createTree(r *Repo, baseTree string, entries []*github.TreeEntry) string {
+	files := map[string]*github.TreeEntry{}
+	for path, entry := range r.Trees[baseTree] {
+		files[path] = entry
+	}
+
+	for _, entry := range entries {
+		path := entry.GetPath()
+		switch {
+		case entry.Content != nil:
+			files[path] = &github.TreeEntry{Path: github.String(path), Mode: github.String("100644"), Type: github.String("blob"), SHA: github.String(s.createBlob(r, entry.GetContent()))}
+		case entry.SHA != nil:
+			files[path] = &github.TreeEntry{Path: github.String(path), Mode: entry.Mode, Type: entry.Type, SHA: entry.SHA}
+		default:
+			delete(files, path)
+		}
+	}
+
+	sha := s.nextSHA()
+	r.Trees[sha] = files
+	return sha
+}
+
+func (s *Server) createCommit(r *Repo, message, tree string, parents []*github.Commit) *github.Commit {
+	now := time.Now()
+	commit := &github.Commit{
+		SHA:     github.String(s.nextSHA()),
+		Message: github.String(message),
+		Tree:    &github.Tree{SHA: github.String(tree)},
+		Parents: parents,
+		Author:  &github.CommitAuthor{Name: github.String(s.Login), Date: &github.Timestamp{Time: now}},
+	}
+	r.Commits[commit.GetSHA()] = commit
+	return commit
+}
+
+type apiError struct {
+	status  int
+	message string
+}
+
+func notFound() *apiError {
+	return &apiError{status: http.StatusNotFound, message: "Not Found"}
+}
+
+func unprocessable(format string, args ...any) *apiError {
+	return &apiError{status: http.StatusUnprocessableEntity, message: fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	path := strings.TrimPrefix(req.URL.EscapedPath(), "/api/v3")
+	s.requests = append(s.requests, req.Method+" "+path)
+	if s.failing[req.Method+" "+path] {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(map[string]any{"message": "Server Error"})
+		return
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments = append(segments, unescaped)
+	}
+
+	var (
+		status = http.StatusOK
+		resp   any
+		apiErr *apiError
+	)
+	switch {
+	case len(segments) == 4 && segments[0] == "app" && segments[1] == "installations" && segments[3] == "access_tokens" && req.Method == http.MethodPost:
+		token := fmt.Sprintf("fake-installation-token-%s-%d", segments[2], len(s.tokens)+1)
+		s.tokens = append(s.tokens, token)
+		status, resp = http.StatusCreated, &github.InstallationToken{
+			Token:     github.String(token),
+			ExpiresAt: &github.Timestamp{Time: time.Now().Add(s.TokenTTL)},
+		}
+	case len(segments) == 1 && segments[0] == "graphql" && req.Method == http.MethodPost:
+		status, resp, apiErr = s.serveGraphQL(req)
+	case len(segments) >= 4 && segments[0] == "repos":
+		status, resp, apiErr = s.serveRepo(req, s.repo(segments[1], segments[2]), segments[3:])
+	default:
+		apiErr = notFound()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if apiErr != nil {
+		w.WriteHeader(apiErr.status)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"message": apiErr.message,
+			"errors":  []map[string]string{{"message": apiErr.message}},
+		})
+		return
+	}
+
+	w.WriteHeader(status)
+	if resp != nil {
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func decode(req *http.Request, v any) *apiError {
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		return &apiError{status: http.StatusBadRequest, message: "Problems parsing JSON: " + err.Error()}
+	}
+	return nil
+}
+
+// paginate returns the page of items requested by the page and per_page query
+// parameters.
+func paginate[T any](req *http.Request, items []T) []T {
+	page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+	if perPage < 1 {
+		perPage = 30
+	}
+
+	start := (page - 1) * perPage
+	if start >= len(items) {
+		return []T{}
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+// serveGraphQL serves the only mutation of the GraphQL API used by the bot,
+// markPullRequestReadyForReview, given the node ID of the Pull Request as the
+// "id" variable.
+func (s *Server) serveGraphQL(req *http.Request) (int, any, *apiError) {
+	var body struct {
+		Query     string            `json:"query"`
+		Variables map[string]string `json:"variables"`
+	}
+	if err := decode(req, &body); err != nil {
+		return 0, nil, err
+	}
+
+	graphQLError := func(message string) map[string]any {
+		return map[string]any{"errors": []map[string]string{{"message": message}}}
+	}
+	if !strings.Contains(body.Query, "markPullRequestReadyForReview") {
+		return http.StatusOK, graphQLError("Unsupported query"), nil
+	}
+
+	for _, r := range s.repos {
+		for _, pr := range r.Pulls {
+			if pr.GetNodeID() != body.Variables["id"] {
+				continue
+			}
+
+			pr.Draft = github.Bool(false)
+			return http.StatusOK, map[string]any{
+				"data": map[string]any{
+					"markPullRequestReadyForReview": map[string]any{
+						"pullRequest": map[string]any{"isDraft": false},
+					},
+				},
+			}, nil
+		}
+	}
+	return http.StatusOK, graphQLError(fmt.Sprintf("Could not resolve to a node with the global id of '%s'", body.Variables["id"])), nil
+}
+
+func (s *Server) serveRepo(req *http.Request, r *Repo, path []string) (int, any, *apiError) {
+	switch path[0] {
+	case "issues":
+		return s.serveIssues(req, r, path[1:])
+	case "pulls":
+		return s.servePulls(req, r, path[1:])
+	case "git":
+		return s.serveGit(req, r, path[1:])
+	case "commits":
+		if len(path) != 3 || req.Method != http.MethodGet {
+			break
+		}
+		sha := path[1]
+		if ref, ok := r.Refs["heads/"+sha]; ok {
+			sha = ref
+		}
+		switch path[2] {
+		case "pulls":
+			return http.StatusOK, paginate(req, r.pullsWithCommit(sha)), nil
+		case "check-runs":
+			return http.StatusOK, &github.ListCheckRunsResults{
+				Total:     github.Int(len(r.CheckRuns[sha])),
+				CheckRuns: paginate(req, r.CheckRuns[sha]),
+			}, nil
+		case "status":
+			return http.StatusOK, r.combinedStatus(req, sha), nil
+		}
+	case "labels":
+		return s.serveLabels(req, r, path[1:])
+	case "milestones":
+		if len(path) != 1 || req.Method != http.MethodGet {
+			break
+		}
+		state := req.URL.Query().Get("state")
+		if state == "" {
+			state = "open"
+		}
+		var milestones []*github.Milestone
+		for _, milestone := range r.Milestones {
+			if state == "all" || milestone.GetState() == state {
+				milestones = append(milestones, milestone)
+			}
+		}
+		return http.StatusOK, paginate(req, milestones), nil
+	case "installation":
+		if len(path) != 1 || req.Method != http.MethodGet {
+			break
+		}
+		return http.StatusOK, &github.Installation{ID: github.Int64(r.InstallationID)}, nil
+	case "branches":
+		if len(path) < 2 || req.Method != http.MethodGet {
+			break
+		}
+		if n := len(path); n > 3 && path[n-2] == "protection" && path[n-1] == "required_status_checks" {
+			return s.getRequiredChecks(r, strings.Join(path[1:n-2], "/"))
+		}
+		return s.getBranch(r, strings.Join(path[1:], "/"))
+	case "contents":
+		if len(path) < 2 || req.Method != http.MethodGet {
+			break
+		}
+		ref := req.URL.Query().Get("ref")
+		if ref == "" {
+			ref = r.DefaultBranch
+		}
+		content, ok := r.file("heads/"+ref, strings.Join(path[1:], "/"))
+		if !ok {
+			return 0, nil, notFound()
+		}
+		return http.StatusOK, &github.RepositoryContent{
+			Type:     github.String("file"),
+			Path:     github.String(strings.Join(path[1:], "/")),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+		}, nil
+	}
+	return 0, nil, notFound()
+}
+
+func (s *Server) getBranch(r *Repo, branch string) (int, any, *apiError) {
+	sha, ok := r.Refs["heads/"+branch]
+	if !ok {
+		return 0, nil, notFound()
+	}
+
+	commit, ok := r.Commits[sha]
+	if !ok {
+		commit = &github.Commit{SHA: github.String(sha)}
+	}
+	return http.StatusOK, &github.Branch{
+		Name: github.String(branch),
+		Commit: &github.RepositoryCommit{
+			SHA:    github.String(sha),
+			Commit: commit,
+		},
+	}, nil
+}
+
+func (s *Server) getRequiredChecks(r *Repo, branch string) (int, any, *apiError) {
+	contexts, ok := r.RequiredChecks[branch]
+	if !ok {
+		return 0, nil, &apiError{status: http.StatusNotFound, message: "Branch not protected"}
+	}
+
+	checks := &github.RequiredStatusChecks{Contexts: contexts}
+	for _, context := range contexts {
+		checks.Checks = append(checks.Checks, &github.RequiredStatusCheck{Context: context})
+	}
+	return http.StatusOK, checks, nil
+}
+
+func (s *Server) serveIssues(req *http.Request, r *Repo, path []string) (int, any, *apiError) {
+	if len(path) == 0 {
+		return 0, nil, notFound()
+	}
+	if path[0] == "comments" && len(path) == 2 {
+		return s.serveIssueComment(req, r, path[1])
+	}
+	number, err := strconv.Atoi(path[0])
+	if err != nil {
+		return 0, nil, notFound()
+	}
+
+	switch {
+	case len(path) == 1 && req.Method == http.MethodPatch:
+		pr, ok := r.Pulls[number]
+		if !ok {
+			return 0, nil, notFound()
+		}
+
+		var update github.IssueRequest
+		if err := decode(req, &update); err != nil {
+			return 0, nil, err
+		}
+
+		if update.Milestone != nil {
+			pr.Milestone = nil
+			for _, milestone := range r.Milestones {
+				if milestone.GetNumber() == update.GetMilestone() {
+					pr.Milestone = milestone
+				}
+			}
+			if pr.Milestone == nil {
+				return 0, nil, unprocessable("Milestone %d does not exist", update.GetMilestone())
+			}
+		}
+		return http.StatusOK, &github.Issue{Number: github.Int(number), Title: pr.Title, Milestone: pr.Milestone}, nil
+	case len(path) == 2 && path[1] == "comments" && req.Method == http.MethodGet:
+		return http.StatusOK, paginate(req, r.Comments[number]), nil
+	case len(path) == 2 && path[1] == "comments" && req.Method == http.MethodPost:
+		var comment github.IssueComment
+		if err := decode(req, &comment); err != nil {
+			return 0, nil, err
+		}
+
+		s.seq++
+		now := time.Now()
+		comment.ID = github.Int64(s.seq)
+		comment.User = &github.User{Login: github.String(s.Login)}
+		comment.CreatedAt = &github.Timestamp{Time: now}
+		comment.UpdatedAt = &github.Timestamp{Time: now}
+		r.Comments[number] = append(r.Comments[number], &comment)
+		return http.StatusCreated, &comment, nil
+	case len(path) == 2 && path[1] == "labels" && req.Method == http.MethodPost:
+		var labels []string
+		if err := decode(req, &labels); err != nil {
+			return 0, nil, err
+		}
+
+		for _, label := range labels {
+			if !slices.Contains(r.Labels[number], label) {
+				r.Labels[number] = append(r.Labels[number], label)
+			}
+		}
+		return http.StatusOK, issueLabels(r.Labels[number]), nil
+	case len(path) == 3 && path[1] == "labels" && req.Method == http.MethodDelete:
+		labels := r.Labels[number]
+		for i, label := range labels {
+			if label == path[2] {
+				r.Labels[number] = append(labels[:i:i], labels[i+1:]...)
+				return http.StatusOK, issueLabels(r.Labels[number]), nil
+			}
+		}
+		return 0, nil, &apiError{status: http.StatusNotFound, message: "Label does not exist"}
+	}
+	return 0, nil, notFound()
+}
+
+func (s *Server) serveIssueComment(req *http.Request, r *Repo, id string) (int, any, *apiError) {
+	commentID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || req.Method != http.MethodPatch {
+		return 0, nil, notFound()
+	}
+
+	for _, comments := range r.Comments {
+		for _, comment := range comments {
+			if comment.GetID() != commentID {
+				continue
+			}
+
+			var update github.IssueComment
+			if err := decode(req, &update); err != nil {
+				return 0, nil, err
+			}
+			comment.Body = update.Body
+			comment.UpdatedAt = &github.Timestamp{Time: time.Now()}
+			return http.StatusOK, comment, nil
+		}
+	}
+	return 0, nil, notFound()
+}
+
+// combinedStatus combines the statuses of sha as GitHub does: failing if any
+// failed, pending if any is pending or there are none, successful otherwise.
+func (r *Repo) combinedStatus(req *http.Request, sha string) *github.CombinedStatus {
+	state := "success"
+	statuses := r.Statuses[sha]
+	if len(statuses) == 0 {
+		state = "pending"
+	}
+	for _, status := range statuses {
+		switch status.GetState() {
+		case "failure", "error":
+			state = "failure"
+		case "pending":
+			if state != "failure" {
+				state = "pending"
+			}
+		}
+	}
+
+	return &github.CombinedStatus{
+		State:      github.String(state),
+		SHA:        github.String(sha),
+		TotalCount: github.Int(len(statuses)),
+		Statuses:   paginate(req, statuses),
+	}
+}
+
+func (s *Server) serveLabels(req *http.Request, r *Repo, path []string) (int, any, *apiError) {
+	switch {
+	case len(path) == 0 && req.Method == http.MethodGet:
+		return http.StatusOK, paginate(req, r.repoLabels()), nil
+	case len(path) == 0 && req.Method == http.MethodPost:
+		var label github.Label
+		if err := decode(req, &label); err != nil {
+			return 0, nil, err
+		}
+		if _, ok := r.RepoLabels[label.GetName()]; ok {
+			return 0, nil, unprocessable("Validation Failed: already_exists")
+		}
+
+		s.seq++
+		label.ID = github.Int64(s.seq)
+		r.RepoLabels[label.GetName()] = &label
+		return http.StatusCreated, &label, nil
+	}
+
+	if len(path) != 1 {
+		return 0, nil, notFound()
+	}
+	label, ok := r.RepoLabels[path[0]]
+	if !ok {
+		return 0, nil, notFound()
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		return http.StatusOK, label, nil
+	case http.MethodPatch:
+		var update github.Label
+		if err := decode(req, &update); err != nil {
+			return 0, nil, err
+		}
+
+		if update.Name != nil && update.GetName() != label.GetName() {
+			delete(r.RepoLabels, label.GetName())
+			label.Name = update.Name
+			r.RepoLabels[label.GetName()] = label
+		}
+		if update.Color != nil {
+			label.Color = update.Color
+		}
+		if update.Description != nil {
+			label.Description = update.Description
+		}
+		return http.StatusOK, label, nil
+	}
+	return 0, nil, notFound()
+}
+
+func (r *Repo) repoLabels() []*github.Label {
+	labels := make([]*github.Label, 0, len(r.RepoLabels))
+	for _, label := range r.RepoLabels {
+		l := *label
+		labels = append(labels, &l)
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	return labels
+}
+
+func issueLabels(names []string) []*github.Label {
+	labels := make([]*github.Label, 0, len(names))
+	for _, name := range names {
+		labels = append(labels, &github.Label{Name: github.String(name)})
+	}
+	return labels
+}
+
+// branchName strips the optional "owner:" prefix of a head branch.
+func branchName(head string) string {
+	if _, branch, ok := strings.Cut(head, ":"); ok {
+		return branch
+	}
+	return head
+}
+
+func (s *Server) servePulls(req *http.Request, r *Repo, path []string) (int, any, *apiError) {
+	if len(path) == 0 {
+		switch req.Method {
+		case http.MethodGet:
+			return http.StatusOK, paginate(req, r.listPulls(req.URL.Query())), nil
+		case http.MethodPost:
+			return s.createPull(req, r)
+		}
+		return 0, nil, notFound()
+	}
+
+	number, err := strconv.Atoi(path[0])
+	if err != nil {
+		return 0, nil, notFound()
+	}
+	pr, ok := r.Pulls[number]
+	if !ok {
+		return 0, nil, notFound()
+	}
+
+	switch {
+	case len(path) == 1 && req.Method == http.MethodGet:
+		return http.StatusOK, r.pull(number), nil
+	case len(path) == 1 && req.Method == http.MethodPatch:
+		var update struct {
+			Title               *string `json:"title"`
+			Body                *string `json:"body"`
+			State               *string `json:"state"`
+			Base                *string `json:"base"`
+			MaintainerCanModify *bool   `json:"maintainer_can_modify"`
+		}
+		if err := decode(req, &update); err != nil {
+			return 0, nil, err
+		}
+
+		if update.Title != nil {
+			pr.Title = update.Title
+		}
+		if update.Body != nil {
+			pr.Body = update.Body
+		}
+		if update.State != nil {
+			pr.State = update.State
+		}
+		if update.Base != nil {
+			pr.Base = &github.PullRequestBranch{Ref: update.Base, SHA: github.String(r.Refs["heads/"+*update.Base]), Repo: r.repository()}
+		}
+		if update.MaintainerCanModify != nil {
+			pr.MaintainerCanModify = update.MaintainerCanModify
+		}
+		return http.StatusOK, r.pull(number), nil
+	case len(path) == 2 && path[1] == "merge" && req.Method == http.MethodPut:
+		return s.mergePull(req, r, pr)
+	case len(path) == 2 && path[1] == "files" && req.Method == http.MethodGet:
+		return http.StatusOK, paginate(req, r.PullFiles[number]), nil
+	case len(path) == 2 && path[1] == "commits" && req.Method == http.MethodGet:
+		return http.StatusOK, paginate(req, r.PullCommits[number]), nil
+	case len(path) == 2 && path[1] == "reviews" && req.Method == http.MethodGet:
+		return http.StatusOK, paginate(req, r.Reviews[number]), nil
+	case len(path) == 2 && path[1] == "requested_reviewers" && req.Method == http.MethodGet:
+		reviewers := r.Reviewers[number]
+		if reviewers == nil {
+			reviewers = &github.Reviewers{}
+		}
+		return http.StatusOK, reviewers, nil
+	case len(path) == 2 && path[1] == "requested_reviewers" && req.Method == http.MethodPost:
+		var request github.ReviewersRequest
+		if err := decode(req, &request); err != nil {
+			return 0, nil, err
+		}
+
+		reviewers := r.Reviewers[number]
+		if reviewers == nil {
+			reviewers = &github.Reviewers{}
+			r.Reviewers[number] = reviewers
+		}
+		for _, login := range request.Reviewers {
+			if login == pr.GetUser().GetLogin() {
+				return 0, nil, unprocessable("Review cannot be requested from pull request author.")
+			}
+			for _, team := range r.Teams {
+				if login == team.GetName() || login == team.GetSlug() {
+					return 0, nil, unprocessable("Could not resolve to a User with the login of '%s'.", login)
+				}
+			}
+			if r.Collaborators != nil && !slices.Contains(r.Collaborators, login) {
+				return 0, nil, unprocessable("Reviews may only be requested from collaborators. One or more of the users or teams you specified is not a collaborator of the %s/%s repository.", r.Owner, r.Name)
+			}
+		}
+		var teams []*github.Team
+		for _, slug := range request.TeamReviewers {
+			i := slices.IndexFunc(r.Teams, func(team *github.Team) bool { return team.GetSlug() == slug })
+			if i < 0 {
+				return 0, nil, unprocessable("Reviews may only be requested from collaborators. One or more of the users or teams you specified is not a collaborator of the %s/%s repository.", r.Owner, r.Name)
+			}
+			teams = append(teams, r.Teams[i])
+		}
+		for _, login := range request.Reviewers {
+			reviewers.Users = append(reviewers.Users, &github.User{Login: github.String(login)})
+		}
+		reviewers.Teams = append(reviewers.Teams, teams...)
+		return http.StatusCreated, r.pull(number), nil
+	}
+	return 0, nil, notFound()
+}
+
+// nodeID returns the GraphQL node ID of a Pull Request.
+func (r *Repo) nodeID(number int) string {
+	return fmt.Sprintf("PR_%s_%s_%d", r.Owner, r.Name, number)
+}
+
+// pullsWithCommit returns the Pull Requests merged as sha, or having sha as
+// their head or one of their commits.
+func (r *Repo) pullsWithCommit(sha string) []*github.PullRequest {
+	var pulls []*github.PullRequest
+	for _, pr := range r.pulls() {
+		found := pr.GetMergeCommitSHA() == sha || pr.GetHead().GetSHA() == sha
+		for _, commit := range r.PullCommits[pr.GetNumber()] {
+			found = found || commit.GetSHA() == sha
+		}
+		if found {
+			pulls = append(pulls, pr)
+		}
+	}
+	return pulls
+}
+
+func (r *Repo) listPulls(query url.Values) []*github.PullRequest {
+	state := query.Get("state")
+	if state == "" {
+		state = "open"
+	}
+
+	var pulls []*github.PullRequest
+	for _, pr := range r.pulls() {
+		if state != "all" && pr.GetState() != state {
+			continue
+		}
+		if head := query.Get("head"); head != "" && pr.GetHead().GetRef() != branchName(head) {
+			continue
+		}
+		if base := query.Get("base"); base != "" && pr.GetBase().GetRef() != base {
+			continue
+		}
+		pulls = append(pulls, pr)
+	}
+	return pulls
+}
+
+func (s *Server) createPull(req *http.Request, r *Repo) (int, any, *apiError) {
+	var newPR github.NewPullRequest
+	if err := decode(req, &newPR); err != nil {
+		return 0, nil, err
+	}
+
+	head, base := branchName(newPR.GetHead()), newPR.GetBase()
+	headSHA, ok := r.Refs["heads/"+head]
+	if !ok {
+		return 0, nil, unprocessable("Head ref %s does not exist", head)
+	}
+	baseSHA, ok := r.Refs["heads/"+base]
+	if !ok {
+		return 0, nil, unprocessable("Base ref %s does not exist", base)
+	}
+
+	for _, pr := range r.Pulls {
+		if pr.GetState() == "open" && pr.GetHead().GetRef() == head && pr.GetBase().GetRef() == base {
+			return 0, nil, unprocessable("A pull request already exists for %s:%s.", r.Owner, head)
+		}
+	}
+
+	r.nextNumber++
+	number := r.nextNumber
+	now := time.Now()
+	r.Pulls[number] = &github.PullRequest{
+		Number:              github.Int(number),
+		NodeID:              github.String(r.nodeID(number)),
+		State:               github.String("open"),
+		Title:               newPR.Title,
+		Body:                newPR.Body,
+		Draft:               github.Bool(newPR.GetDraft()),
+		MaintainerCanModify: newPR.MaintainerCanModify,
+		User:                &github.User{Login: github.String(s.Login)},
+		HTMLURL:             github.String(fmt.Sprintf("https://github.com/%s/%s/pull/%d", r.Owner, r.Name, number)),
+		Head:                &github.PullRequestBranch{Ref: github.String(head), SHA: github.String(headSHA), Repo: r.repository()},
+		Base:                &github.PullRequestBranch{Ref: github.String(base), SHA: github.String(baseSHA), Repo: r.repository()},
+		CreatedAt:           &github.Timestamp{Time: now},
+		UpdatedAt:           &github.Timestamp{Time: now},
+	}
+	return http.StatusCreated, r.pull(number), nil
+}
+
+func (s *Server) mergePull(req *http.Request, r *Repo, pr *github.PullRequest) (int, any, *apiError) {
+	var options struct {
+		CommitTitle string `json:"commit_title"`
+		SHA         string `json:"sha"`
+	}
+	if err := decode(req, &options); err != nil {
+		return 0, nil, err
+	}
+
+	if pr.GetState() != "open" || pr.GetDraft() {
+		return 0, nil, &apiError{status: http.StatusMethodNotAllowed, message: "Pull Request is not mergeable"}
+	}
+
+	headSHA := r.Refs["heads/"+pr.GetHead().GetRef()]
+	if options.SHA != "" && options.SHA != headSHA {
+		return 0, nil, &apiError{status: http.StatusConflict, message: "Head branch was modified. Review and try the merge again."}
+	}
+
+	message := options.CommitTitle
+	if message == "" {
+		message = fmt.Sprintf("%s (#%d)", pr.GetTitle(), pr.GetNumber())
+	}
+
+	baseRef := "heads/" + pr.GetBase().GetRef()
+	commit := s.createCommit(r, message, r.Commits[headSHA].GetTree().GetSHA(), []*github.Commit{
+		{SHA: github.String(r.Refs[baseRef])},
+		{SHA: github.String(headSHA)},
+	})
+	s.setRef(r, baseRef, commit.GetSHA())
+
+	now := time.Now()
+	pr.State = github.String("closed")
+	pr.Merged = github.Bool(true)
+	pr.MergedAt = &github.Timestamp{Time: now}
+	pr.ClosedAt = &github.Timestamp{Time: now}
+	pr.MergedBy = &github.User{Login: github.String(s.Login)}
+	pr.MergeCommitSHA = commit.SHA
+
+	return http.StatusOK, &github.PullRequestMergeResult{
+		SHA:     commit.SHA,
+		Merged:  github.Bool(true),
+		Message: github.String("Pull Request successfully merged"),
+	}, nil
+}
+
+func (s *Server) serveGit(req *http.Request, r *Repo, path []string) (int, any, *apiError) {
+	if len(path) == 0 {
+		return 0, nil, notFound()
+	}
+
+	reference := func(ref string) *github.Reference {
+		return &github.Reference{
+			Ref:    github.String("refs/" + ref),
+			Object: &github.GitObject{Type: github.String("commit"), SHA: github.String(r.Refs[ref])},
+		}
+	}
+
+	switch {
+	case path[0] == "ref" && len(path) > 1 && req.Method == http.MethodGet:
+		ref := strings.Join(path[1:], "/")
+		if _, ok := r.Refs[ref]; !ok {
+			return 0, nil, notFound()
+		}
+		return http.StatusOK, reference(ref), nil
+	case path[0] == "matching-refs" && len(path) > 1 && req.Method == http.MethodGet:
+		prefix := strings.Join(path[1:], "/")
+		var refs []*github.Reference
+		for ref := range r.Refs {
+			if strings.HasPrefix(ref, prefix) {
+				refs = append(refs, reference(ref))
+			}
+		}
+		sort.Slice(refs, func(i, j int) bool { return refs[i].GetRef() < refs[j].GetRef() })
+		return http.StatusOK, paginate(req, refs), nil
+	case path[0] == "refs" && len(path) == 1 && req.Method == http.MethodPost:
+		var body struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		if err := decode(req, &body); err != nil {
+			return 0, nil, err
+		}
+
+		ref := strings.TrimPrefix(body.Ref, "refs/")
+		if _, ok := r.Refs[ref]; ok {
+			return 0, nil, unprocessable("Reference already exists")
+		}
+		s.setRef(r, ref, body.SHA)
+		return http.StatusCreated, reference(ref), nil
+	case path[0] == "refs" && len(path) > 1 && req.Method == http.MethodPatch:
+		var body struct {
+			SHA   string `json:"sha"`
+			Force bool   `json:"force"`
+		}
+		if err := decode(req, &body); err != nil {
+			return 0, nil, err
+		}
+
+		ref := strings.Join(path[1:], "/")
+		if _, ok := r.Refs[ref]; !ok {
+			return 0, nil, unprocessable("Reference does not exist")
+		}
+		s.setRef(r, ref, body.SHA)
+		return http.StatusOK, reference(ref), nil
+	case path[0] == "refs" && len(path) > 1 && req.Method == http.MethodDelete:
+		ref := strings.Join(path[1:], "/")
+		if _, ok := r.Refs[ref]; !ok {
+			return 0, nil, unprocessable("Reference does not exist")
+		}
+		s.setRef(r, ref, "")
+		return http.StatusNoContent, nil, nil
+	case path[0] == "blobs" && len(path) == 1 && req.Method == http.MethodPost:
+		var blob github.Blob
+		if err := decode(req, &blob); err != nil {
+			return 0, nil, err
+		}
+
+		content := blob.GetContent()
+		if blob.GetEncoding() == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(content)
+			if err != nil {
+				return 0, nil, unprocessable("Invalid base64 content")
+			}
+			content = string(decoded)
+		}
+		return http.StatusCreated, &github.Blob{SHA: github.String(s.createBlob(r, content))}, nil
+	case path[0] == "trees" && len(path) == 1 && req.Method == http.MethodPost:
+		var body struct {
+			BaseTree string              `json:"base_tree"`
+			Tree     []*github.TreeEntry `json:"tree"`
+		}
+		if err := decode(req, &body); err != nil {
+			return 0, nil, err
+		}
+
+		sha := s.createTree(r, body.BaseTree, body.Tree)
+		return http.StatusCreated, r.tree(sha), nil
+	case path[0] == "trees" && len(path) == 2 && req.Method == http.MethodGet:
+		if _, ok := r.Trees[path[1]]; !ok {
+			return 0, nil, notFound()
+		}
+		return http.StatusOK, r.tree(path[1]), nil
+	case path[0] == "commits" && len(path) == 1 && req.Method == http.MethodPost:
+		var body struct {
+			Message string   `json:"message"`
+			Tree    string   `json:"tree"`
+			Parents []string `json:"parents"`
+		}
+		if err := decode(req, &body); err != nil {
+			return 0, nil, err
+		}
+
+		if _, ok := r.Trees[body.Tree]; !ok {
+			return 0, nil, unprocessable("Tree SHA does not exist")
+		}
+		parents := make([]*github.Commit, 0, len(body.Parents))
+		for _, parent := range body.Parents {
+			parents = append(parents, &github.Commit{SHA: github.String(parent)})
+		}
+		return http.StatusCreated, s.createCommit(r, body.Message, body.Tree, parents), nil
+	case path[0] == "commits" && len(path) == 2 && req.Method == http.MethodGet:
+		commit, ok := r.Commits[path[1]]
+		if !ok {
+			return 0, nil, notFound()
+		}
+		return http.StatusOK, commit, nil
+	}
+	return 0, nil, notFound()
+}
+
+// setRef points ref to sha, or deletes it if sha is empty.
+func (s *Server) setRef(r *Repo, ref, sha string) {
+	if sha == "" {
+		delete(r.Refs, ref)
+	} else {
+		r.Refs[ref] = sha
+	}
+
+	if s.onRefUpdate != nil {
+		s.onRefUpdate(r.Owner, r.Name, "refs/"+ref, sha)
+	}
+}
+
+func (r *Repo) tree(sha string) *github.Tree {
+	files := r.Trees[sha]
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	tree := &github.Tree{SHA: github.String(sha), Truncated: github.Bool(false)}
+	for _, path := range paths {
+		tree.Entries = append(tree.Entries, files[path])
+	}
+	return tree
+}
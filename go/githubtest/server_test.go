@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package githubtest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullRequestLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer(t)
+	client := s.Client()
+
+	s.CreateBranch("vitessio", "vitess", "main", map[string]string{"README.md": "vitess"})
+	s.CreateBranch("vitessio", "vitess", "feature", map[string]string{"README.md": "vitess"})
+	s.CreateBranch("vitessio", "vitess", "feature", map[string]string{"feature.go": "package feature"})
+
+	_, resp, err := client.Repositories.GetBranch(ctx, "vitessio", "vitess", "missing", false)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	newPR := &github.NewPullRequest{
+		Title: github.String("Add a feature"),
+		Head:  github.String("vitessio:feature"),
+		Base:  github.String("main"),
+	}
+	pr, _, err := client.PullRequests.Create(ctx, "vitessio", "vitess", newPR)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pr.GetNumber())
+	assert.Equal(t, DefaultLogin, pr.GetUser().GetLogin())
+
+	_, _, err = client.PullRequests.Create(ctx, "vitessio", "vitess", newPR)
+	assert.ErrorContains(t, err, "A pull request already exists")
+
+	prs, _, err := client.PullRequests.List(ctx, "vitessio", "vitess", &github.PullRequestListOptions{Head: "vitessio:feature", Base: "main"})
+	require.NoError(t, err)
+	require.Len(t, prs, 1)
+
+	result, _, err := client.PullRequests.Merge(ctx, "vitessio", "vitess", pr.GetNumber(), "", nil)
+	require.NoError(t, err)
+	assert.True(t, result.GetMerged())
+
+	pr, _, err = client.PullRequests.Get(ctx, "vitessio", "vitess", pr.GetNumber())
+	require.NoError(t, err)
+	assert.True(t, pr.GetMerged())
+	assert.Equal(t, "closed", pr.GetState())
+
+	mainSHA, _ := s.Ref("vitessio", "vitess", "heads/main")
+	assert.Equal(t, result.GetSHA(), mainSHA)
+	content, ok := s.File("vitessio", "vitess", "main", "feature.go")
+	require.True(t, ok)
+	assert.Equal(t, "package feature", content)
+
+	prs, _, err = client.PullRequests.List(ctx, "vitessio", "vitess", nil)
+	require.NoError(t, err)
+	assert.Empty(t, prs)
+}
+
+func TestIssueLabels(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer(t)
+	client := s.Client()
+
+	_, _, err := client.Issues.AddLabelsToIssue(ctx, "vitessio", "vitess", 1, []string{"Backport to: release-18.0", "Type: Bug"})
+	require.NoError(t, err)
+	_, _, err = client.Issues.AddLabelsToIssue(ctx, "vitessio", "vitess", 1, []string{"Type: Bug"})
+	require.NoError(t, err)
+
+	_, err = client.Issues.RemoveLabelForIssue(ctx, "vitessio", "vitess", 1, "Backport to: release-18.0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Type: Bug"}, s.Labels("vitessio", "vitess", 1))
+
+	resp, err := client.Issues.RemoveLabelForIssue(ctx, "vitessio", "vitess", 1, "missing")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+)
+
+// tokenRefreshMargin is how long before their expiration installation tokens
+// are refreshed, so that a git command started with a token does not outlive
+// it.
+const tokenRefreshMargin = 10 * time.Minute
+
+// installationTokens mints installation access tokens of the GitHub App, so
+// that git authenticates over HTTPS with the permissions of the installation
+// of each repository instead of an SSH key.
+type installationTokens struct {
+	cc githubapp.ClientCreator
+
+	m sync.Mutex
+	// installations are the installation IDs of the repositories, by
+	// owner/name.
+	installations map[string]int64
+	tokens        map[int64]*github.InstallationToken
+}
+
+func newInstallationTokens(cc githubapp.ClientCreator) *installationTokens {
+	return &installationTokens{
+		cc:            cc,
+		installations: map[string]int64{},
+		tokens:        map[int64]*github.InstallationToken{},
+	}
+}
+
+// Token returns a token of the installation of the App on owner/name, minting
+// a new one if the cached one is about to expire. It is a git.TokenSource.
+func (t *installationTokens) Token(ctx context.Context, owner, name string) (string, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	key := owner + "/" + name
+	installationID, ok := t.installations[key]
+	if !ok {
+		client, err := t.cc.NewAppClient()
+		if err != nil {
+			return "", err
+		}
+
+		installation, _, err := client.Apps.FindRepositoryInstallation(ctx, owner, name)
+		if err != nil {
+			return "", errors.Wrapf(err, "Failed to find the installation of the App on %s", key)
+		}
+
+		installationID = installation.GetID()
+		t.installations[key] = installationID
+	}
+
+	token, ok := t.tokens[installationID]
+	if !ok || time.Until(token.GetExpiresAt().Time) < tokenRefreshMargin {
+		client, err := t.cc.NewAppClient()
+		if err != nil {
+			return "", err
+		}
+
+		token, _, err = client.Apps.CreateInstallationToken(ctx, installationID, nil)
+		if err != nil {
+			return "", errors.Wrapf(err, "Failed to create an access token for installation %d", installationID)
+		}
+
+		t.tokens[installationID] = token
+	}
+
+	return token.GetToken(), nil
+}
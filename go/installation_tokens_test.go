@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+)
+
+func TestInstallationTokens(t *testing.T) {
+	ctx := context.Background()
+
+	tcases := []struct {
+		name     string
+		ttl      time.Duration
+		expected []string
+	}{
+		{
+			name: "cached until close to expiration",
+			ttl:  time.Hour,
+			expected: []string{
+				"fake-installation-token-1-1",
+				"fake-installation-token-1-1",
+				"fake-installation-token-2-2",
+			},
+		},
+		{
+			name: "refreshed when close to expiration",
+			ttl:  tokenRefreshMargin / 2,
+			expected: []string{
+				"fake-installation-token-1-1",
+				"fake-installation-token-1-2",
+				"fake-installation-token-2-3",
+			},
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			gh := githubtest.NewServer(t)
+			gh.TokenTTL = tc.ttl
+			gh.Update("vitessio", "website", func(r *githubtest.Repo) {
+				r.InstallationID = 2
+			})
+
+			tokens := newInstallationTokens(gh.ClientCreator())
+
+			var got []string
+			for _, repo := range []string{"vitess", "vitess", "website"} {
+				token, err := tokens.Token(ctx, "vitessio", repo)
+				require.NoError(t, err)
+				got = append(got, token)
+			}
+			assert.Equal(t, tc.expected, got)
+
+			// Installations are only looked up once per repository.
+			var lookups int
+			for _, req := range gh.Requests() {
+				if req == "GET /repos/vitessio/vitess/installation" {
+					lookups++
+				}
+			}
+			assert.Equal(t, 1, lookups)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+const commandPrefix = "/vitess-bot"
+
+var (
+	// maintainers are the author associations allowed to run commands that
+	// mutate the repository.
+	maintainers = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+)
+
+// command is a slash-command that can be run by commenting
+// `/vitess-bot <name> [args]` on a Pull Request.
+type command struct {
+	name  string
+	usage string
+	help  string
+
+	// allowed is the list of author associations (see
+	// https://docs.github.com/en/graphql/reference/enums#commentauthorassociation)
+	// that may run this command. An empty list allows anyone.
+	allowed []string
+
+	run func(ctx context.Context, client *github.Client, event github.IssueCommentEvent, args []string) error
+}
+
+func (c *command) isAllowed(association string) bool {
+	return len(c.allowed) == 0 || slices.Contains(c.allowed, strings.ToUpper(association))
+}
+
+// parseCommands returns the commands found in a comment body, one per line
+// starting with the command prefix, as a list of fields.
+func parseCommands(body string) (cmds [][]string) {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != commandPrefix {
+			continue
+		}
+
+		cmds = append(cmds, fields[1:])
+	}
+
+	return cmds
+}
+
+type IssueCommentHandler struct {
+	githubapp.ClientCreator
+
+	botLogin string
+	commands map[string]*command
+}
+
+func NewIssueCommentHandler(cc githubapp.ClientCreator, botLogin string, commands ...*command) (*IssueCommentHandler, error) {
+	h := &IssueCommentHandler{
+		ClientCreator: cc,
+		botLogin:      botLogin,
+		commands:      map[string]*command{},
+	}
+
+	commands = append(commands, &command{
+		name:  "help",
+		usage: "help",
+		help:  "List the available commands.",
+		run:   h.help,
+	})
+	for _, cmd := range commands {
+		if _, ok := h.commands[cmd.name]; ok {
+			return nil, errors.Errorf("command %s registered more than once", cmd.name)
+		}
+
+		h.commands[cmd.name] = cmd
+	}
+
+	return h, nil
+}
+
+func (h *IssueCommentHandler) Handles() []string {
+	return []string{"issue_comment"}
+}
+
+func (h *IssueCommentHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) (err error) {
+	var event github.IssueCommentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "Failed to parse issue comment event payload")
+	}
+
+	ctx = queue.WithDelivery(ctx, eventType, deliveryID)
+
+	if event.GetAction() != "created" || !event.GetIssue().IsPullRequest() {
+		return nil
+	}
+
+	comment := event.GetComment()
+	if comment.GetUser().GetLogin() == h.botLogin {
+		return nil
+	}
+
+	cmds := parseCommands(comment.GetBody())
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	ctx, logger := githubapp.PreparePRContext(ctx, installationID, event.GetRepo(), event.GetIssue().GetNumber())
+	defer func() {
+		if e := panicHandler(logger); e != nil {
+			err = e
+		}
+	}()
+
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	num := event.GetIssue().GetNumber()
+
+	for _, args := range cmds {
+		var reply string
+
+		cmd, ok := h.commands[args[0]]
+		switch {
+		case !ok:
+			reply = fmt.Sprintf("Unknown command `%s`.\n\n%s", args[0], h.usage())
+		case !cmd.isAllowed(comment.GetAuthorAssociation()):
+			reply = fmt.Sprintf("@%s, you are not allowed to run `%s %s`.", comment.GetUser().GetLogin(), commandPrefix, cmd.name)
+		default:
+			logger.Debug().Msgf("Running command %q requested by %s on Pull Request %s/%s#%d", strings.Join(args, " "), comment.GetUser().GetLogin(), owner, repo, num)
+			if err := cmd.run(ctx, client, event, args[1:]); err != nil {
+				logger.Err(err).Msgf("Failed to run command %q on Pull Request %s/%s#%d", strings.Join(args, " "), owner, repo, num)
+				reply = fmt.Sprintf("Failed to run `%s %s`: %s", commandPrefix, strings.Join(args, " "), err.Error())
+			}
+		}
+
+		if reply == "" {
+			continue
+		}
+
+		if _, _, err := client.Issues.CreateComment(ctx, owner, repo, num, &github.IssueComment{Body: &reply}); err != nil {
+			logger.Error().Err(err).Msgf("Failed to reply to command on Pull Request %s/%s#%d", owner, repo, num)
+		}
+	}
+
+	return nil
+}
+
+func (h *IssueCommentHandler) usage() string {
+	names := make([]string, 0, len(h.commands))
+	for name := range h.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf strings.Builder
+	buf.WriteString("Available commands:\n")
+	for _, name := range names {
+		cmd := h.commands[name]
+		fmt.Fprintf(&buf, "- `%s %s`: %s\n", commandPrefix, cmd.usage, cmd.help)
+	}
+
+	return buf.String()
+}
+
+func (h *IssueCommentHandler) help(ctx context.Context, client *github.Client, event github.IssueCommentEvent, _ []string) error {
+	body := h.usage()
+	_, _, err := client.Issues.CreateComment(ctx, event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), event.GetIssue().GetNumber(), &github.IssueComment{
+		Body: &body,
+	})
+	return err
+}
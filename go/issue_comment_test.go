@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+)
+
+func TestParseCommands(t *testing.T) {
+	tcases := []struct {
+		name string
+		in   string
+		want [][]string
+	}{
+		{
+			name: "no command",
+			in:   "LGTM, thanks!",
+		},
+		{
+			name: "prefix only",
+			in:   "/vitess-bot",
+		},
+		{
+			name: "single command",
+			in:   "/vitess-bot backport release-18.0",
+			want: [][]string{{"backport", "release-18.0"}},
+		},
+		{
+			name: "multiple commands and prose",
+			in:   "Thanks!\r\n/vitess-bot help\n  /vitess-bot   backport release-17.0 \nnot /vitess-bot help",
+			want: [][]string{{"help"}, {"backport", "release-17.0"}},
+		},
+		{
+			name: "similar prefix",
+			in:   "/vitess-botx help",
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseCommands(tc.in))
+		})
+	}
+}
+
+func TestCommandIsAllowed(t *testing.T) {
+	cmd := &command{allowed: maintainers}
+	assert.True(t, cmd.isAllowed("MEMBER"))
+	assert.True(t, cmd.isAllowed("owner"))
+	assert.False(t, cmd.isAllowed("CONTRIBUTOR"))
+	assert.False(t, cmd.isAllowed(""))
+
+	cmd = &command{}
+	assert.True(t, cmd.isAllowed("NONE"))
+}
+
+func TestPortCommand(t *testing.T) {
+	gh := githubtest.NewServer(t)
+	for _, branch := range []string{"main", "release-17.0", "release-18.0", "release-19.0", "release-20.0"} {
+		gh.CreateBranch("vitessio", "vitess", branch, nil)
+	}
+
+	open := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{State: github.String("open")})
+	merged := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{State: github.String("closed"), Merged: github.Bool(true)})
+
+	prHandler, jobs := newTestPullRequestHandler(t, gh)
+	h, err := NewIssueCommentHandler(gh.ClientCreator(), githubtest.DefaultLogin, prHandler.portCommand(backport), prHandler.portCommand(forwardport))
+	require.NoError(t, err)
+
+	comment := func(number int, association, body string) {
+		payload, err := json.Marshal(github.IssueCommentEvent{
+			Action: github.String("created"),
+			Issue: &github.Issue{
+				Number:           github.Int(number),
+				PullRequestLinks: &github.PullRequestLinks{URL: github.String("https://api.github.com/repos/vitessio/vitess/pulls/1")},
+			},
+			Comment: &github.IssueComment{
+				Body:              github.String(body),
+				User:              &github.User{Login: github.String("maintainer")},
+				AuthorAssociation: github.String(association),
+			},
+			Repo:         &github.Repository{Name: github.String("vitess"), Owner: &github.User{Login: github.String("vitessio")}},
+			Installation: &github.Installation{ID: github.Int64(1)},
+		})
+		require.NoError(t, err)
+		require.NoError(t, h.Handle(context.Background(), "issue_comment", "delivery", payload))
+	}
+
+	comment(merged, "CONTRIBUTOR", "/vitess-bot backport release-18.0")
+	comment(open, "MEMBER", "/vitess-bot backport release-18.0")
+	comment(merged, "MEMBER", "/vitess-bot backport")
+	comment(merged, "MEMBER", "/vitess-bot backport release-18.0 release-18.1")
+	comment(merged, "MEMBER", "/vitess-bot backport release-17.0")
+	assert.Equal(t, []string{
+		"Pull Request #1 is not merged yet, it will be ported once merged if it has the right `Backport to` labels",
+	}, trimReplies(gh.Comments("vitessio", "vitess", open)))
+	assert.Equal(t, []string{
+		"@maintainer, you are not allowed to run `/vitess-bot backport`.",
+		"missing branch, usage: `/vitess-bot backport <branch>`",
+		"cannot backport to `release-18.1`: branch `release-18.1` does not exist",
+		"cannot backport to `release-17.0`: `release-17.0` is no longer supported, the supported release branches are `release-20.0`, `release-19.0`, `release-18.0`",
+	}, trimReplies(gh.Comments("vitessio", "vitess", merged)))
+	assert.Empty(t, jobs.Jobs())
+
+	comment(merged, "MEMBER", "/vitess-bot backport release-18.0 release-19.0\n/vitess-bot forwardport release-20.0")
+	assert.Len(t, gh.Comments("vitessio", "vitess", merged), 4)
+	assert.Equal(t, []string{
+		portOperation + " backport release-18.0",
+		portOperation + " backport release-19.0",
+		portOperation + " forwardport release-20.0",
+	}, jobSummaries(jobs))
+	for _, job := range jobs.Jobs() {
+		assert.Equal(t, "true", job.Args["notify"])
+	}
+}
+
+// trimReplies removes the "Failed to run" prefix of the replies to commands.
+func trimReplies(replies []string) []string {
+	trimmed := make([]string, 0, len(replies))
+	for _, reply := range replies {
+		if _, err, ok := strings.Cut(reply, "`: "); ok && strings.HasPrefix(reply, "Failed to run") {
+			reply = err
+		}
+		trimmed = append(trimmed, reply)
+	}
+	return trimmed
+}
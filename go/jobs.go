@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+// Operations run through the job queue. They are stored along with each job,
+// so they must not be renamed.
+const (
+	portOperation             = "port"
+	rebuildPortOperation      = "rebuild port"
+	cobraDocsPreviewOperation = "cobradocs preview"
+	errorDocsOperation        = "error code docs"
+	releaseCobraDocsOperation = "release cobradocs"
+	portStatusOperation       = "port status"
+	revertPortsOperation      = "revert ports"
+	autoMergeOperation        = "auto merge port"
+)
+
+// enqueuePREvent enqueues a job running the given operation against a
+// pull_request event.
+func (h *PullRequestHandler) enqueuePREvent(ctx context.Context, operation string, event github.PullRequestEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal event to %s on Pull Request %d", operation, event.GetNumber())
+	}
+
+	return h.jobs.Enqueue(ctx, &queue.Job{
+		Operation:      operation,
+		InstallationID: githubapp.GetInstallationIDFromEvent(&event),
+		Owner:          event.GetRepo().GetOwner().GetLogin(),
+		Repo:           event.GetRepo().GetName(),
+		Number:         event.GetNumber(),
+		Payload:        payload,
+	})
+}
+
+// runPREventJob returns a job function decoding the pull_request event stored
+// in the job and passing it to f.
+func (h *PullRequestHandler) runPREventJob(f func(ctx context.Context, event github.PullRequestEvent, prInfo prInformation) error) queue.Func {
+	return func(ctx context.Context, job *queue.Job) error {
+		var event github.PullRequestEvent
+		if err := json.Unmarshal(job.Payload, &event); err != nil {
+			return errors.Wrapf(err, "Failed to parse pull request event payload of job %s", job.ID)
+		}
+
+		return f(ctx, event, getPRInformation(event))
+	}
+}
+
+// enqueuePort enqueues a job porting a merged Pull Request to a single branch.
+// If notify is set, a comment listing the new Pull Request is added to the
+// original Pull Request.
+func (h *PullRequestHandler) enqueuePort(ctx context.Context, installationID int64, prInfo prInformation, branch, portType string, notify bool) error {
+	args := map[string]string{
+		"branch":   branch,
+		"portType": portType,
+	}
+	if notify {
+		args["notify"] = "true"
+	}
+
+	return h.jobs.Enqueue(ctx, &queue.Job{
+		Operation:      portOperation,
+		InstallationID: installationID,
+		Owner:          prInfo.repoOwner,
+		Repo:           prInfo.repoName,
+		Number:         prInfo.num,
+		Args:           args,
+	})
+}
+
+func (h *PullRequestHandler) runPortJob(ctx context.Context, job *queue.Job) (err error) {
+	client, err := h.NewInstallationClient(job.InstallationID)
+	if err != nil {
+		return err
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, job.Owner, job.Repo, job.Number)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get Pull Request %s/%s#%d", job.Owner, job.Repo, job.Number)
+	}
+
+	prInfo := getPRInformationFromPR(pr.GetBase().GetRepo(), pr)
+	ctx, logger := githubapp.PreparePRContext(ctx, job.InstallationID, prInfo.repo, prInfo.num)
+	defer func() {
+		if e := panicHandler(logger); e != nil {
+			err = e
+		}
+	}()
+
+	settings, err := h.settings.get(ctx, client, job.InstallationID, job.Owner, job.Repo)
+	if err != nil {
+		return err
+	}
+
+	branch, portType := job.Args["branch"], job.Args["portType"]
+	_, _, otherLabels := portBranchesFromLabels(pr, settings)
+
+	newPRID, err := h.portMergedPR(ctx, client, prInfo, pr, branch, portType, otherLabels)
+	if err != nil {
+		return err
+	}
+	logger.Debug().Msgf("Opened %s Pull Request %s/%s#%d", portType, prInfo.repoOwner, prInfo.repoName, newPRID)
+
+	if job.Args["notify"] == "true" {
+		body := fmt.Sprintf("Opened %s #%d to `%s`.", portType, newPRID, branch)
+		if _, _, err := client.Issues.CreateComment(ctx, prInfo.repoOwner, prInfo.repoName, prInfo.num, &github.IssueComment{Body: &body}); err != nil {
+			logger.Error().Err(err).Msgf("Failed to comment %s notice on Pull Request %s/%s#%d", portType, prInfo.repoOwner, prInfo.repoName, prInfo.num)
+		}
+	}
+
+	if err := h.updatePortStatus(ctx, client, job.InstallationID, prInfo.repoOwner, prInfo.repoName, prInfo.num, portTarget{portType: portType, branch: branch}); err != nil {
+		logger.Error().Err(err).Msgf("Failed to update the port status of Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
+	}
+
+	return nil
+}
+
+func (h *ReleaseHandler) runReleaseJob(ctx context.Context, job *queue.Job) error {
+	var event github.ReleaseEvent
+	if err := json.Unmarshal(job.Payload, &event); err != nil {
+		return errors.Wrapf(err, "Failed to parse release event payload of job %s", job.ID)
+	}
+
+	return h.updateReleasedCobraDocsForEvent(ctx, event)
+}
@@ -17,17 +17,27 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/gregjones/httpcache"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/rcrowley/go-metrics"
 	"github.com/rs/zerolog"
+
+	"github.com/vitess.io/vitess-bot/go/dryrun"
+	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/queue"
+	"github.com/vitess.io/vitess-bot/go/stats"
 )
 
+// jobWorkers is the number of jobs run concurrently.
+const jobWorkers = 4
+
 func main() {
 	cfg, err := readConfig()
 	if err != nil {
@@ -47,40 +57,58 @@ func main() {
 	logger := zerolog.New(f).With().Timestamp().Logger()
 	zerolog.DefaultContextLogger = &logger
 
+	ctx := logger.WithContext(context.Background())
+
+	if len(os.Args) > 1 && os.Args[1] == replayCommand {
+		if err := replay(ctx, cfg, os.Args[2:]); err != nil {
+			logger.Fatal().Err(err).Msg("Replay failed")
+		}
+		return
+	}
+
 	metricsRegistry := metrics.DefaultRegistry
 
-	cc, err := githubapp.NewDefaultCachingClientCreator(
-		cfg.Github,
-		githubapp.WithClientUserAgent("vitess-bot/1.0.0"),
-		githubapp.WithClientTimeout(5*time.Second),
-		githubapp.WithClientCaching(false, func() httpcache.Cache { return httpcache.NewMemoryCache() }),
-		githubapp.WithClientMiddleware(
-			githubapp.ClientMetrics(metricsRegistry),
-		),
-	)
-	if err != nil {
-		panic(err)
+	var dryRun *dryrun.Recorder
+	if cfg.dryRun {
+		logger.Warn().Msg("Running in dry-run mode, mutations are logged instead of performed")
+		dryRun = dryrun.New()
 	}
 
-	prCommentHandler, err := NewPullRequestHandler(cc, cfg.reviewChecklist, cfg.botLogin)
+	jobs, err := queue.New(cfg.jobsDir)
 	if err != nil {
 		panic(err)
 	}
+	jobs.RegisterMetrics(metricsRegistry)
 
-	releaseHandler, err := NewReleaseHandler(cc, cfg.botLogin)
+	worktrees := git.NewWorktrees(filepath.Join("/", "tmp", "vitess-bot")).
+		WithRemoteURLTemplate(cfg.remoteURLTemplate).
+		WithDryRun(dryRun)
+
+	webhookHandler, err := newWebhookHandler(cfg, dryRun, jobs, worktrees)
 	if err != nil {
 		panic(err)
 	}
 
-	webhookHandler := githubapp.NewEventDispatcher(
-		[]githubapp.EventHandler{prCommentHandler, releaseHandler},
-		cfg.Github.App.WebhookSecret,
-		githubapp.WithScheduler(
-			githubapp.AsyncScheduler(),
-		),
-	)
+	if cfg.deliveriesDir != "" {
+		webhookHandler, err = recordDeliveries(ctx, cfg.deliveriesDir, cfg.Github.App.WebhookSecret, webhookHandler)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	jobs.Run(ctx, jobWorkers)
 
 	http.Handle(githubapp.DefaultWebhookRoute, webhookHandler)
+	http.Handle(metricsRoute, stats.Handler(metricsRegistry))
+
+	if cfg.adminToken != "" {
+		adminHandler, err := NewAdminHandler(jobs, cfg.adminToken)
+		if err != nil {
+			panic(err)
+		}
+		adminHandler.WithDryRun(dryRun)
+		adminHandler.Register(http.DefaultServeMux)
+	}
 
 	addr := cfg.address + ":8080"
 	logger.Info().Msgf("Starting server on %s...", addr)
@@ -89,3 +117,70 @@ func main() {
 		panic(err)
 	}
 }
+
+// newWebhookHandler returns the handler of the webhook deliveries, which
+// dispatches them to the event handlers of the bot.
+func newWebhookHandler(cfg *config, dryRun *dryrun.Recorder, jobs *queue.Queue, worktrees *git.Worktrees) (http.Handler, error) {
+	middleware := []githubapp.ClientMiddleware{
+		githubapp.ClientMetrics(metrics.DefaultRegistry),
+	}
+	if dryRun != nil {
+		middleware = append(middleware, dryRun.Middleware())
+	}
+
+	cc, err := githubapp.NewDefaultCachingClientCreator(
+		cfg.Github,
+		githubapp.WithClientUserAgent("vitess-bot/1.0.0"),
+		githubapp.WithClientTimeout(5*time.Second),
+		githubapp.WithClientCaching(false, func() httpcache.Cache { return httpcache.NewMemoryCache() }),
+		githubapp.WithClientMiddleware(middleware...),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.gitCredentials == gitCredentialsApp {
+		worktrees.WithTokenSource(newInstallationTokens(cc).Token)
+	}
+
+	prCommentHandler, err := NewPullRequestHandler(cc, cfg.Bot, jobs, worktrees, cfg.reviewChecklist, cfg.botLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseHandler, err := NewReleaseHandler(cc, cfg.Bot, jobs, worktrees, cfg.botLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	branchHandler, err := NewBranchHandler(cc, cfg.Bot, prCommentHandler.settings)
+	if err != nil {
+		return nil, err
+	}
+
+	autoMergeHandler, err := NewAutoMergeHandler(cc, cfg.Bot, prCommentHandler.settings, jobs, cfg.botLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	issueCommentHandler, err := NewIssueCommentHandler(
+		cc,
+		cfg.botLogin,
+		prCommentHandler.portCommand(backport),
+		prCommentHandler.portCommand(forwardport),
+		prCommentHandler.rebuildCommand(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return githubapp.NewEventDispatcher(
+		timed(prCommentHandler, releaseHandler, branchHandler, autoMergeHandler, issueCommentHandler),
+		cfg.Github.App.WebhookSecret,
+		// Handlers only enqueue long-running operations, so that they are
+		// persisted before the webhook delivery is acknowledged.
+		githubapp.WithScheduler(
+			githubapp.DefaultScheduler(),
+		),
+	), nil
+}
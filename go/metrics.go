@@ -0,0 +1,51 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+
+	"github.com/vitess.io/vitess-bot/go/stats"
+)
+
+// metricsRoute serves the metrics in the Prometheus text format.
+const metricsRoute = "/metrics"
+
+// timedHandler records the duration and result of the events handled by the
+// wrapped handler.
+type timedHandler struct {
+	githubapp.EventHandler
+}
+
+func (h timedHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	start := time.Now()
+	err := h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+	stats.Time(start, "handler.duration", "event", eventType, "result", stats.Result(err))
+	return err
+}
+
+// timed wraps each handler in a timedHandler.
+func timed(handlers ...githubapp.EventHandler) []githubapp.EventHandler {
+	wrapped := make([]githubapp.EventHandler, 0, len(handlers))
+	for _, h := range handlers {
+		wrapped = append(wrapped, timedHandler{h})
+	}
+	return wrapped
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+)
+
+// supportedReleases is the default number of release branches that are still
+// supported, and so can receive ports: Vitess supports each major release
+// for about a year, during which two more are released.
+const supportedReleases = 3
+
+// releaseBranchNameRegexp matches the names of the release branches, e.g.
+// release-18.0.
+var releaseBranchNameRegexp = regexp.MustCompile(`^release-(\d+)\.(\d+)$`)
+
+// releaseVersion is the version of a release branch.
+type releaseVersion struct {
+	major, minor int
+}
+
+func (v releaseVersion) less(o releaseVersion) bool {
+	if v.major != o.major {
+		return v.major < o.major
+	}
+	return v.minor < o.minor
+}
+
+func parseReleaseBranch(branch string) (releaseVersion, bool) {
+	m := releaseBranchNameRegexp.FindStringSubmatch(branch)
+	if m == nil {
+		return releaseVersion{}, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return releaseVersion{major: major, minor: minor}, true
+}
+
+// checkPortBranch checks that Pull Requests of owner/name can be ported to
+// branch: it must be an existing release branch, among the
+// settings.SupportedReleases most recent ones. It returns the reason why it
+// cannot, or "" if it can.
+func checkPortBranch(ctx context.Context, client *github.Client, owner, name, branch string, settings *repoSettings) (string, error) {
+	version, ok := parseReleaseBranch(branch)
+	if !ok {
+		return fmt.Sprintf("`%s` is not a release branch, release branches are named like `release-18.0`", branch), nil
+	}
+
+	_, resp, err := client.Git.GetRef(ctx, owner, name, "heads/"+branch)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return fmt.Sprintf("branch `%s` does not exist", branch), nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get reference of branch %s on repository %s/%s", branch, owner, name)
+	}
+
+	if settings.SupportedReleases == 0 {
+		return "", nil
+	}
+
+	supported, err := latestReleaseBranches(ctx, client, owner, name, settings.SupportedReleases)
+	if err != nil {
+		return "", err
+	}
+	if len(supported) == 0 {
+		return "", nil
+	}
+	if oldest, _ := parseReleaseBranch(supported[len(supported)-1]); version.less(oldest) {
+		return fmt.Sprintf("`%s` is no longer supported, the supported release branches are `%s`", branch, strings.Join(supported, "`, `")), nil
+	}
+	return "", nil
+}
+
+// latestReleaseBranches returns the n most recent release branches of
+// owner/name, most recent first.
+func latestReleaseBranches(ctx context.Context, client *github.Client, owner, name string, n int) ([]string, error) {
+	var (
+		branches []string
+		versions = map[string]releaseVersion{}
+	)
+	perPage := 100
+	for page := 1; true; page++ {
+		refs, _, err := client.Git.ListMatchingRefs(ctx, owner, name, &github.ReferenceListOptions{
+			Ref: "heads/release-",
+			ListOptions: github.ListOptions{
+				Page:    page,
+				PerPage: perPage,
+			},
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list the release branches of repository %s/%s", owner, name)
+		}
+
+		for _, ref := range refs {
+			branch := strings.TrimPrefix(ref.GetRef(), "refs/heads/")
+			if version, ok := parseReleaseBranch(branch); ok {
+				branches = append(branches, branch)
+				versions[branch] = version
+			}
+		}
+		if len(refs) < perPage {
+			break
+		}
+	}
+
+	sort.Slice(branches, func(i, j int) bool {
+		return versions[branches[j]].less(versions[branches[i]])
+	})
+	if len(branches) > n {
+		branches = branches[:n]
+	}
+	return branches, nil
+}
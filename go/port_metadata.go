@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// closingKeywordRegexp matches the keywords linking a Pull Request to the
+// issues it closes, see
+// https://docs.github.com/en/issues/tracking-your-work-with-issues/linking-a-pull-request-to-an-issue.
+var closingKeywordRegexp = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s*:?\s+((?:[\w.-]+/[\w.-]+)?#\d+|https://github\.com/[\w.-]+/[\w.-]+/issues/\d+)`)
+
+// portPRBody returns the description of the port of originalPR: a reference
+// to originalPR followed by its own description, whose closing keywords are
+// rewritten as plain references so that merging the port does not close the
+// issues again.
+func portPRBody(originalPR *github.PullRequest, portType string) string {
+	body := fmt.Sprintf("## Description\nThis is a %s of #%d", portType, originalPR.GetNumber())
+
+	original := strings.TrimSpace(originalPR.GetBody())
+	if original == "" {
+		return body
+	}
+	original = closingKeywordRegexp.ReplaceAllString(original, "Related to $1")
+	return body + fmt.Sprintf("\n\n### Description of #%d\n\n%s", originalPR.GetNumber(), original)
+}
+
+// coAuthorTrailer returns the trailer crediting user as co-author of the
+// commits of a port, using their GitHub noreply address.
+func coAuthorTrailer(user *github.User) string {
+	login := user.GetLogin()
+	if login == "" {
+		return ""
+	}
+
+	email := fmt.Sprintf("%s@users.noreply.github.com", login)
+	if user.GetID() != 0 {
+		email = fmt.Sprintf("%d+%s", user.GetID(), email)
+	}
+	return fmt.Sprintf("Co-authored-by: %s <%s>", login, email)
+}
+
+// setPortMilestone sets the milestone of the port newPRNumber to the next
+// release of branch: the open milestone "vX.Y.Z" of release-X.Y with the
+// lowest Z. Ports to other branches, or to releases without such milestone,
+// are left without milestone.
+func setPortMilestone(ctx context.Context, client *github.Client, originalPRInfo prInformation, branch string, newPRNumber int) error {
+	version, ok := parseReleaseBranch(branch)
+	if !ok {
+		return nil
+	}
+	titleRegexp := regexp.MustCompile(fmt.Sprintf(`^v%d\.%d\.(\d+)$`, version.major, version.minor))
+
+	var milestone *github.Milestone
+	patch := -1
+	perPage := 100
+	for page := 1; true; page++ {
+		milestones, _, err := client.Issues.ListMilestones(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, &github.MilestoneListOptions{
+			State: "open",
+			ListOptions: github.ListOptions{
+				Page:    page,
+				PerPage: perPage,
+			},
+		})
+		if err != nil {
+			return errors.Wrapf(err, "Failed to list the milestones of %s/%s", originalPRInfo.repoOwner, originalPRInfo.repoName)
+		}
+
+		for _, m := range milestones {
+			match := titleRegexp.FindStringSubmatch(m.GetTitle())
+			if match == nil {
+				continue
+			}
+			if p, _ := strconv.Atoi(match[1]); milestone == nil || p < patch {
+				milestone, patch = m, p
+			}
+		}
+		if len(milestones) < perPage {
+			break
+		}
+	}
+
+	if milestone == nil {
+		zerolog.Ctx(ctx).Debug().Msgf("No open milestone for %s on %s/%s", branch, originalPRInfo.repoOwner, originalPRInfo.repoName)
+		return nil
+	}
+
+	if _, _, err := client.Issues.Edit(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, newPRNumber, &github.IssueRequest{Milestone: milestone.Number}); err != nil {
+		return errors.Wrapf(err, "Failed to set milestone %s on Pull Request %s/%s#%d", milestone.GetTitle(), originalPRInfo.repoOwner, originalPRInfo.repoName, newPRNumber)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortPRBody(t *testing.T) {
+	tcases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "no description",
+			want: "## Description\nThis is a forwardport of #7",
+		},
+		{
+			name: "description",
+			body: "Fixes a bug.\n",
+			want: "## Description\nThis is a forwardport of #7\n\n### Description of #7\n\nFixes a bug.",
+		},
+		{
+			name: "linked issues",
+			body: "Fixes #1, closes: vitessio/website#2\nResolved https://github.com/vitessio/vitess/issues/3\nFixed in #4 by fixing #5",
+			want: "## Description\nThis is a forwardport of #7\n\n### Description of #7\n\nRelated to #1, Related to vitessio/website#2\nRelated to https://github.com/vitessio/vitess/issues/3\nFixed in #4 by fixing #5",
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pr := &github.PullRequest{Number: github.Int(7), Body: github.String(tc.body)}
+			assert.Equal(t, tc.want, portPRBody(pr, forwardport))
+		})
+	}
+}
+
+func TestCoAuthorTrailer(t *testing.T) {
+	assert.Equal(t, "Co-authored-by: author <42+author@users.noreply.github.com>", coAuthorTrailer(&github.User{Login: github.String("author"), ID: github.Int64(42)}))
+	assert.Equal(t, "Co-authored-by: author <author@users.noreply.github.com>", coAuthorTrailer(&github.User{Login: github.String("author")}))
+	assert.Empty(t, coAuthorTrailer(nil))
+}
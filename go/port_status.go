@@ -0,0 +1,440 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+// portStatusMarker starts the hidden header of the comment listing the ports
+// of a Pull Request. The header also lists the ports, so that those requested
+// with a command are kept when the comment is updated.
+const portStatusMarker = "<!-- vitess-bot:port-status"
+
+var (
+	// portBranchRegexp matches the branches of the ports, see
+	// cherryPickAndPortPR.
+	portBranchRegexp = regexp.MustCompile(`^(` + backport + `|` + forwardport + `)-(\d+)-to-(.+)$`)
+
+	portStatusHeaderRegexp = regexp.MustCompile(regexp.QuoteMeta(portStatusMarker) + `((?: [a-z]+:\S+)*) -->`)
+)
+
+// portTarget is a branch a Pull Request is ported to.
+type portTarget struct {
+	portType string
+	branch   string
+}
+
+func (t portTarget) headBranch(number int) string {
+	return fmt.Sprintf("%s-%d-to-%s", t.portType, number, t.branch)
+}
+
+// portStatus is the status of the port of a Pull Request to a branch.
+type portStatus struct {
+	portTarget
+
+	// pr is the Pull Request of the port, nil until it is opened.
+	pr *github.PullRequest
+	// ci is the combined state of the checks of the port.
+	ci string
+}
+
+const (
+	ciNone    = ""
+	ciPending = "pending"
+	ciSuccess = "success"
+	ciFailure = "failure"
+)
+
+// trackPort enqueues the update of the port status of the original Pull
+// Request of a port, when the port changes.
+func (h *PullRequestHandler) trackPort(ctx context.Context, event github.PullRequestEvent) error {
+	prInfo := getPRInformation(event)
+	if prInfo.repoName != h.cfg.Vitess.Name {
+		return nil
+	}
+
+	return enqueuePortStatus(ctx, h.jobs, githubapp.GetInstallationIDFromEvent(&event), prInfo.repoOwner, prInfo.repoName, prInfo.head.GetRef())
+}
+
+// enqueuePortStatus enqueues the update of the port status of the original
+// Pull Request of the port whose branch is headBranch. Other branches are
+// ignored.
+func enqueuePortStatus(ctx context.Context, jobs *queue.Queue, installationID int64, owner, name, headBranch string) error {
+	m := portBranchRegexp.FindStringSubmatch(headBranch)
+	if m == nil {
+		return nil
+	}
+	original, _ := strconv.Atoi(m[2])
+
+	return jobs.Enqueue(ctx, &queue.Job{
+		Operation:      portStatusOperation,
+		InstallationID: installationID,
+		Owner:          owner,
+		Repo:           name,
+		Number:         original,
+		Args:           map[string]string{"portType": m[1], "branch": m[3]},
+		Key:            fmt.Sprintf("%s/%s#%d", owner, name, original),
+	})
+}
+
+func (h *PullRequestHandler) runPortStatusJob(ctx context.Context, job *queue.Job) (err error) {
+	client, err := h.NewInstallationClient(job.InstallationID)
+	if err != nil {
+		return err
+	}
+
+	ctx, logger := githubapp.PrepareRepoContext(ctx, job.InstallationID, &github.Repository{
+		Owner: &github.User{Login: &job.Owner},
+		Name:  &job.Repo,
+	})
+	defer func() {
+		if e := panicHandler(logger); e != nil {
+			err = e
+		}
+	}()
+
+	target := portTarget{portType: job.Args["portType"], branch: job.Args["branch"]}
+	logger.Debug().Msgf("Updating the port status of Pull Request %s/%s#%d after %s", job.Owner, job.Repo, job.Number, target.headBranch(job.Number))
+	return h.updatePortStatus(ctx, client, job.InstallationID, job.Owner, job.Repo, job.Number, target)
+}
+
+// updatePortStatus creates or updates the comment of the Pull Request
+// owner/name#number listing the state of each of its ports. The ports are
+// those of its port labels, those already listed by the comment, and targets.
+func (h *PullRequestHandler) updatePortStatus(ctx context.Context, client *github.Client, installationID int64, owner, name string, number int, targets ...portTarget) error {
+	settings, err := h.settings.get(ctx, client, installationID, owner, name)
+	if err != nil {
+		return err
+	}
+	if !settings.Features.Ports || !settings.Features.PortStatus {
+		return nil
+	}
+
+	// Ports finishing concurrently must not both create the comment.
+	h.portStatusMu.Lock()
+	defer h.portStatusMu.Unlock()
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, name, number)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get Pull Request %s/%s#%d", owner, name, number)
+	}
+
+	known, comment, err := portTargets(ctx, client, owner, name, pr, settings)
+	if err != nil {
+		return err
+	}
+	targets = uniquePortTargets(append(targets, known...))
+	if len(targets) == 0 {
+		return nil
+	}
+
+	var statuses []portStatus
+	for _, target := range targets {
+		status, err := getPortStatus(ctx, client, owner, name, number, target)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, status)
+	}
+
+	body := portStatusComment(statuses)
+	if comment == nil {
+		if _, _, err := client.Issues.CreateComment(ctx, owner, name, number, &github.IssueComment{Body: &body}); err != nil {
+			return errors.Wrapf(err, "Failed to comment the port status on Pull Request %s/%s#%d", owner, name, number)
+		}
+		return nil
+	}
+
+	if comment.GetBody() == body {
+		return nil
+	}
+	if _, _, err := client.Issues.EditComment(ctx, owner, name, comment.GetID(), &github.IssueComment{Body: &body}); err != nil {
+		return errors.Wrapf(err, "Failed to update the port status on Pull Request %s/%s#%d", owner, name, number)
+	}
+	return nil
+}
+
+// portTargets returns the ports of pr: those of its port labels, and those
+// listed by its port status comment, which is returned if there is one.
+func portTargets(ctx context.Context, client *github.Client, owner, name string, pr *github.PullRequest, settings *repoSettings) ([]portTarget, *github.IssueComment, error) {
+	var targets []portTarget
+	backportBranches, forwardportBranches, _ := portBranchesFromLabels(pr, settings)
+	for _, branch := range backportBranches {
+		targets = append(targets, portTarget{portType: backport, branch: branch})
+	}
+	for _, branch := range forwardportBranches {
+		targets = append(targets, portTarget{portType: forwardport, branch: branch})
+	}
+
+	comment, err := findPortStatusComment(ctx, client, owner, name, pr.GetNumber())
+	if err != nil {
+		return nil, nil, err
+	}
+	if comment != nil {
+		targets = append(targets, parsePortStatusTargets(comment.GetBody())...)
+	}
+	return uniquePortTargets(targets), comment, nil
+}
+
+// findPortStatusComment returns the comment listing the ports of a Pull
+// Request, or nil if there is none yet.
+func findPortStatusComment(ctx context.Context, client *github.Client, owner, name string, number int) (*github.IssueComment, error) {
+	perPage := 100
+	for page := 1; true; page++ {
+		comments, _, err := client.Issues.ListComments(ctx, owner, name, number, &github.IssueListCommentsOptions{
+			ListOptions: github.ListOptions{
+				Page:    page,
+				PerPage: perPage,
+			},
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list the comments of Pull Request %s/%s#%d", owner, name, number)
+		}
+
+		for _, comment := range comments {
+			if strings.HasPrefix(comment.GetBody(), portStatusMarker) {
+				return comment, nil
+			}
+		}
+		if len(comments) < perPage {
+			break
+		}
+	}
+
+	return nil, nil
+}
+
+// parsePortStatusTargets returns the ports listed in the header of a port
+// status comment.
+func parsePortStatusTargets(body string) []portTarget {
+	m := portStatusHeaderRegexp.FindStringSubmatch(body)
+	if m == nil {
+		return nil
+	}
+
+	var targets []portTarget
+	for _, field := range strings.Fields(m[1]) {
+		portType, branch, _ := strings.Cut(field, ":")
+		targets = append(targets, portTarget{portType: portType, branch: branch})
+	}
+	return targets
+}
+
+// uniquePortTargets sorts the targets, backports first, and removes the
+// duplicates.
+func uniquePortTargets(targets []portTarget) []portTarget {
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].portType != targets[j].portType {
+			return targets[i].portType == backport
+		}
+		return targets[i].branch < targets[j].branch
+	})
+
+	var unique []portTarget
+	for i, target := range targets {
+		if i == 0 || target != targets[i-1] {
+			unique = append(unique, target)
+		}
+	}
+	return unique
+}
+
+// getPortStatus returns the status of the port of owner/name#number to target,
+// from its most recent Pull Request.
+func getPortStatus(ctx context.Context, client *github.Client, owner, name string, number int, target portTarget) (portStatus, error) {
+	status := portStatus{portTarget: target}
+
+	var err error
+	status.pr, err = findPortPR(ctx, client, owner, name, number, target)
+	if err != nil || status.pr == nil {
+		return status, err
+	}
+
+	status.ci, err = getCIState(ctx, client, owner, name, status.pr.GetHead().GetSHA())
+	return status, err
+}
+
+// findPortPR returns the most recent Pull Request of the port of
+// owner/name#number to target, or nil if it was not opened yet.
+func findPortPR(ctx context.Context, client *github.Client, owner, name string, number int, target portTarget) (*github.PullRequest, error) {
+	prs, _, err := client.PullRequests.List(ctx, owner, name, &github.PullRequestListOptions{
+		State: "all",
+		Head:  fmt.Sprintf("%s:%s", owner, target.headBranch(number)),
+		Base:  target.branch,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list the Pull Requests of branch %s on %s/%s", target.headBranch(number), owner, name)
+	}
+
+	var port *github.PullRequest
+	for _, pr := range prs {
+		if port == nil || pr.GetNumber() > port.GetNumber() {
+			port = pr
+		}
+	}
+	return port, nil
+}
+
+// getCIState combines the check runs and the commit statuses of sha.
+func getCIState(ctx context.Context, client *github.Client, owner, name, sha string) (string, error) {
+	if sha == "" {
+		return ciNone, nil
+	}
+
+	state := ciNone
+	runs, err := listCheckRuns(ctx, client, owner, name, sha)
+	if err != nil {
+		return ciNone, err
+	}
+	for _, run := range runs {
+		state = combineCIStates(state, checkRunState(run))
+	}
+
+	combined, _, err := client.Repositories.GetCombinedStatus(ctx, owner, name, sha, nil)
+	if err != nil {
+		return ciNone, errors.Wrapf(err, "Failed to get the status of %s on %s/%s", sha, owner, name)
+	}
+	if combined.GetTotalCount() > 0 {
+		state = combineCIStates(state, statusState(combined.GetState()))
+	}
+
+	return state, nil
+}
+
+// combineCIStates combines two CI states: failing if either fails, pending if
+// either is pending, successful otherwise. ciNone is ignored.
+func combineCIStates(a, b string) string {
+	switch {
+	case a == ciFailure || b == ciNone:
+		return a
+	case b == ciFailure, a == ciNone, b == ciPending:
+		return b
+	}
+	return a
+}
+
+// checkRunState returns the CI state of a check run.
+func checkRunState(run *github.CheckRun) string {
+	switch {
+	case run.GetStatus() != "completed":
+		return ciPending
+	case run.GetConclusion() == "failure", run.GetConclusion() == "timed_out", run.GetConclusion() == "cancelled", run.GetConclusion() == "action_required":
+		return ciFailure
+	default:
+		return ciSuccess
+	}
+}
+
+// statusState returns the CI state of a commit status, or of a combined
+// status.
+func statusState(state string) string {
+	switch state {
+	case "success":
+		return ciSuccess
+	case "pending":
+		return ciPending
+	default:
+		return ciFailure
+	}
+}
+
+// listCheckRuns returns all the check runs of sha.
+func listCheckRuns(ctx context.Context, client *github.Client, owner, name, sha string) ([]*github.CheckRun, error) {
+	var runs []*github.CheckRun
+	perPage := 100
+	for page := 1; true; page++ {
+		result, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, name, sha, &github.ListCheckRunsOptions{
+			ListOptions: github.ListOptions{
+				Page:    page,
+				PerPage: perPage,
+			},
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list the check runs of %s on %s/%s", sha, owner, name)
+		}
+
+		runs = append(runs, result.CheckRuns...)
+		if len(result.CheckRuns) < perPage {
+			break
+		}
+	}
+
+	return runs, nil
+}
+
+// portStatusComment renders the comment listing the ports of a Pull Request.
+func portStatusComment(statuses []portStatus) string {
+	var header []string
+	for _, status := range statuses {
+		header = append(header, status.portType+":"+status.branch)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s -->\n", portStatusMarker, strings.Join(header, " "))
+	b.WriteString("### Ports\n\n")
+	b.WriteString("| Branch | Pull Request | Conflicts | CI | State |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, status := range statuses {
+		fmt.Fprintf(&b, "| `%s` (%s) | ", status.branch, status.portType)
+		if status.pr == nil {
+			b.WriteString("Not opened yet | | | |\n")
+			continue
+		}
+
+		conflicts := "No"
+		for _, label := range status.pr.Labels {
+			if label.GetName() == mergeConflictLabel {
+				conflicts = ":warning: Yes"
+			}
+		}
+
+		ci := map[string]string{
+			ciNone:    "",
+			ciPending: ":hourglass: Pending",
+			ciSuccess: ":white_check_mark: Passing",
+			ciFailure: ":x: Failing",
+		}[status.ci]
+
+		var state string
+		switch {
+		case status.pr.GetMerged() || status.pr.MergedAt != nil:
+			state = "Merged"
+		case status.pr.GetState() == "closed":
+			state = "Closed"
+		case status.pr.GetDraft():
+			state = "Draft"
+		default:
+			state = "Open"
+		}
+
+		fmt.Fprintf(&b, "#%d | %s | %s | %s |\n", status.pr.GetNumber(), conflicts, ci, state)
+	}
+
+	return b.String()
+}
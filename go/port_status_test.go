@@ -0,0 +1,177 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+)
+
+func TestTrackPort(t *testing.T) {
+	ctx := context.Background()
+	gh := githubtest.NewServer(t)
+	h, jobs := newTestPullRequestHandler(t, gh)
+
+	original := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Title:  github.String("Fix a bug"),
+		State:  github.String("closed"),
+		Merged: github.Bool(true),
+		Base:   &github.PullRequestBranch{Ref: github.String("main")},
+		Labels: []*github.Label{{Name: github.String("Backport to: release-18.0")}, {Name: github.String("Backport to: release-17.0")}},
+	})
+	// The forwardport was requested with a command, so only the comment
+	// remembers it.
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.Comments[original] = append(r.Comments[original], &github.IssueComment{
+			ID:   github.Int64(100),
+			Body: github.String(portStatusMarker + " forwardport:release-19.0 -->\n"),
+		})
+	})
+
+	port := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Title:  github.String("[release-18.0] Fix a bug (#1)"),
+		Draft:  github.Bool(true),
+		Base:   &github.PullRequestBranch{Ref: github.String("release-18.0")},
+		Head:   &github.PullRequestBranch{Ref: github.String("backport-1-to-release-18.0"), SHA: github.String("c0ffee")},
+		Labels: []*github.Label{{Name: github.String("Merge Conflict")}},
+	})
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.CheckRuns["c0ffee"] = []*github.CheckRun{
+			{Name: github.String("unit"), Status: github.String("completed"), Conclusion: github.String("success")},
+			{Name: github.String("e2e"), Status: github.String("in_progress")},
+		}
+	})
+
+	require.NoError(t, h.Handle(ctx, "pull_request", "delivery-1", testPullRequestEvent(t, gh, "opened", port)))
+	runJobs(t, jobs)
+
+	comments := gh.Comments("vitessio", "vitess", original)
+	require.Len(t, comments, 1)
+	assert.Equal(t, `<!-- vitess-bot:port-status backport:release-17.0 backport:release-18.0 forwardport:release-19.0 -->
+### Ports
+
+| Branch | Pull Request | Conflicts | CI | State |
+| --- | --- | --- | --- | --- |
+| `+"`release-17.0`"+` (backport) | Not opened yet | | | |
+| `+"`release-18.0`"+` (backport) | #2 | :warning: Yes | :hourglass: Pending | Draft |
+| `+"`release-19.0`"+` (forwardport) | Not opened yet | | | |
+`, comments[0])
+
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.CheckRuns["c0ffee"][1].Status = github.String("completed")
+		r.CheckRuns["c0ffee"][1].Conclusion = github.String("failure")
+		r.Statuses["c0ffee"] = []*github.RepoStatus{{Context: github.String("ci"), State: github.String("success")}}
+		r.Labels[port] = nil
+		r.Pulls[port].Draft = github.Bool(false)
+	})
+	require.NoError(t, h.Handle(ctx, "pull_request", "delivery-2", testPullRequestEvent(t, gh, "unlabeled", port)))
+	runJobs(t, jobs)
+
+	comments = gh.Comments("vitessio", "vitess", original)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0], "| `release-18.0` (backport) | #2 | No | :x: Failing | Open |\n")
+
+	// Checks completing refresh the CI state.
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.CheckRuns["c0ffee"][1].Conclusion = github.String("success")
+	})
+	cfg := defaultBotConfig()
+	autoMerge, err := NewAutoMergeHandler(gh.ClientCreator(), cfg, newRepoSettingsCache(cfg, testChecklist), jobs, githubtest.DefaultLogin)
+	require.NoError(t, err)
+	payload, err := json.Marshal(github.CheckSuiteEvent{
+		Action:       github.String("completed"),
+		CheckSuite:   &github.CheckSuite{HeadBranch: github.String("backport-1-to-release-18.0"), Conclusion: github.String("success")},
+		Repo:         &github.Repository{Name: github.String("vitess"), Owner: &github.User{Login: github.String("vitessio")}},
+		Installation: &github.Installation{ID: github.Int64(1)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, autoMerge.Handle(ctx, "check_suite", "delivery-3", payload))
+	runJobs(t, jobs)
+
+	comments = gh.Comments("vitessio", "vitess", original)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0], "| `release-18.0` (backport) | #2 | No | :white_check_mark: Passing | Open |\n")
+
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.Pulls[port].State = github.String("closed")
+		r.Pulls[port].Merged = github.Bool(true)
+		r.Pulls[port].MergedAt = &github.Timestamp{Time: time.Now()}
+	})
+	require.NoError(t, h.Handle(ctx, "pull_request", "delivery-4", testPullRequestEvent(t, gh, "closed", port)))
+	runJobs(t, jobs)
+
+	comments = gh.Comments("vitessio", "vitess", original)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0], "| `release-18.0` (backport) | #2 | No | :white_check_mark: Passing | Merged |\n")
+}
+
+func TestParsePortStatusTargets(t *testing.T) {
+	tcases := []struct {
+		name string
+		body string
+		want []portTarget
+	}{
+		{
+			name: "ports",
+			body: portStatusMarker + " backport:release-18.0 forwardport:release-19.0 -->\n### Ports\n",
+			want: []portTarget{{portType: backport, branch: "release-18.0"}, {portType: forwardport, branch: "release-19.0"}},
+		},
+		{
+			name: "no ports",
+			body: portStatusMarker + " -->\n",
+		},
+		{
+			name: "other comment",
+			body: "Opened backport #2 to `release-18.0`.",
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parsePortStatusTargets(tc.body))
+		})
+	}
+}
+
+func TestGetCIState(t *testing.T) {
+	gh := githubtest.NewServer(t)
+
+	// More check runs than fit in a page, the failing one past the first
+	// page.
+	var runs []*github.CheckRun
+	for i := 0; i < 150; i++ {
+		runs = append(runs, &github.CheckRun{Name: github.String(fmt.Sprintf("check-%d", i)), Status: github.String("completed"), Conclusion: github.String("success")})
+	}
+	runs[120].Conclusion = github.String("failure")
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.CheckRuns["c0ffee"] = runs
+	})
+
+	state, err := getCIState(context.Background(), gh.Client(), "vitessio", "vitess", "c0ffee")
+	require.NoError(t, err)
+	assert.Equal(t, ciFailure, state)
+}
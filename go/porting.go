@@ -23,11 +23,20 @@ import (
 
 	"github.com/google/go-github/v53/github"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
 	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/stats"
 )
 
 const botCommitAuthor = "vitess-bot[bot] <108069721+vitess-bot[bot]@users.noreply.github.com>"
 
+// mergeConflictLabel and skipCILabel are added to the ports with conflicts.
+const (
+	mergeConflictLabel = "Merge Conflict"
+	skipCILabel        = "Skip CI"
+)
+
 func portPR(
 	ctx context.Context,
 	client *github.Client,
@@ -37,29 +46,57 @@ func portPR(
 	mergedCommitSHA, branch, portType string,
 	labels []string,
 ) (int, error) {
-	newPRCreated, conflict, err := cherryPickAndPortPR(ctx, client, repo, originalPRInfo, originalPR, mergedCommitSHA, branch, portType)
-	if err != nil {
+	newPRCreated, commits, conflicts, err := cherryPickAndPortPR(ctx, client, repo, originalPRInfo, originalPR, mergedCommitSHA, branch, portType)
+	conflict := len(conflicts) > 0
+	switch {
+	case err != nil:
+		stats.Inc("ports", "type", portType, "result", "error")
 		return 0, err
+	case conflict:
+		stats.Inc("ports", "type", portType, "result", "conflict")
+	default:
+		stats.Inc("ports", "type", portType, "result", "created")
 	}
 
+	// The port exists from now on: failing the job would run it again, and
+	// repeat the follow-ups that succeeded, e.g. the comments. Their failures
+	// are only logged instead.
+	logger := zerolog.Ctx(ctx)
 	newPRNumber := newPRCreated.GetNumber()
-	if err = addLabelsToPortedPR(ctx, client, originalPRInfo, labels, conflict, portType, newPRNumber); err != nil {
-		return 0, err
+	if err := addLabelsToPortedPR(ctx, client, originalPRInfo, labels, conflict, portType, newPRNumber); err != nil {
+		logger.Error().Err(err).Msgf("Failed to label the %s of Pull Request %d to %s", portType, originalPRInfo.num, branch)
+	}
+
+	if err := setPortMilestone(ctx, client, originalPRInfo, branch, newPRNumber); err != nil {
+		logger.Error().Err(err).Msgf("Failed to set the milestone of the %s of Pull Request %d to %s", portType, originalPRInfo.num, branch)
 	}
 
 	originalPRAuthor := originalPR.GetUser().GetLogin()
 	if conflict {
-		if err = addConflictCommentToPortedPR(ctx, client, originalPRInfo, newPRNumber, originalPRAuthor, portType, branch, mergedCommitSHA); err != nil {
-			return 0, err
+		prerequisites, err := findPrerequisites(ctx, client, repo, originalPRInfo, originalPR, branch, conflicts)
+		if err != nil {
+			// The prerequisites are only a hint, the conflicts are still worth reporting.
+			logger.Error().Err(err).Msgf("Failed to find the prerequisites of the %s of Pull Request %d to %s", portType, originalPRInfo.num, branch)
+		}
+
+		if err := addConflictCommentToPortedPR(ctx, client, originalPRInfo, newPRNumber, originalPRAuthor, portType, branch, commits, conflicts, prerequisites); err != nil {
+			logger.Error().Err(err).Msgf("Failed to report the conflicts of the %s of Pull Request %d to %s", portType, originalPRInfo.num, branch)
 		}
 	}
 
-	if err = addReviewersToPortedPR(ctx, client, originalPRInfo, originalPRAuthor, newPRNumber); err != nil {
-		return 0, err
+	if err := addReviewersToPortedPR(ctx, client, originalPRInfo, originalPRAuthor, newPRCreated); err != nil {
+		logger.Error().Err(err).Msgf("Failed to request reviewers on the %s of Pull Request %d to %s", portType, originalPRInfo.num, branch)
 	}
 	return newPRNumber, nil
 }
 
+// portConflict is a commit whose cherry-pick conflicted when porting a Pull
+// Request.
+type portConflict struct {
+	sha   string
+	files []git.Conflict
+}
+
 func cherryPickAndPortPR(
 	ctx context.Context,
 	client *github.Client,
@@ -67,95 +104,227 @@ func cherryPickAndPortPR(
 	originalPRInfo prInformation,
 	originalPR *github.PullRequest,
 	mergedCommitSHA, branch, portType string,
-) (*github.PullRequest, bool, error) {
+) (*github.PullRequest, []string, []portConflict, error) {
 	// Get a reference to the release branch
 	releaseRef, _, err := client.Git.GetRef(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, fmt.Sprintf("heads/%s", branch))
 	if err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to get reference on repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
+		return nil, nil, nil, errors.Wrapf(err, "Failed to get reference on repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
 	}
 
 	// Create a new branch from the release branch
 	newBranch := fmt.Sprintf("%s-%d-to-%s", portType, originalPR.GetNumber(), branch)
 	_, err = repo.CreateBranch(ctx, client, releaseRef, newBranch)
 	if err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to create git ref %s on repository %s/%s to backport Pull Request %d", newBranch, originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
+		return nil, nil, nil, errors.Wrapf(err, "Failed to create git ref %s on repository %s/%s to backport Pull Request %d", newBranch, originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
+	}
+
+	commits, conflicts, err := cherryPickOnBranch(ctx, client, repo, originalPRInfo, originalPR, mergedCommitSHA, releaseRef, newBranch)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	conflict := len(conflicts) > 0
+
+	// Push the changes
+	if err := repo.Push(ctx, git.PushOpts{
+		Remote: "origin",
+		Refs:   []string{newBranch},
+		Force:  true,
+	}); err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "Failed to push %s to backport Pull Request %d", newBranch, originalPRInfo.num)
+	}
+
+	// Create a Pull Request for the new branch
+	newPR := &github.NewPullRequest{
+		Title:               github.String(fmt.Sprintf("[%s] %s (#%d)", branch, originalPR.GetTitle(), originalPR.GetNumber())),
+		Head:                github.String(newBranch),
+		Base:                github.String(branch),
+		Body:                github.String(portPRBody(originalPR, portType)),
+		MaintainerCanModify: github.Bool(true),
+		Draft:               &conflict,
+	}
+	newPRCreated, _, err := client.PullRequests.Create(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, newPR)
+	if err != nil && strings.Contains(err.Error(), "A pull request already exists") {
+		// A previous attempt already opened the Pull Request, we only updated its branch.
+		prs, findErr := repo.FindPRs(ctx, client, github.PullRequestListOptions{
+			State: "open",
+			Head:  fmt.Sprintf("%s:%s", originalPRInfo.repoOwner, newBranch),
+			Base:  branch,
+		}, func(*github.PullRequest) bool { return true }, 1)
+		if findErr == nil && len(prs) == 1 {
+			return prs[0], commits, conflicts, nil
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "Failed to create Pull Request using branch %s on %s/%s", newBranch, originalPRInfo.repoOwner, originalPRInfo.repoName)
 	}
+	return newPRCreated, commits, conflicts, nil
+}
 
+// cherryPickOnBranch resets the local branch newBranch to releaseRef and
+// cherry-picks the commits of the Pull Request merged as mergedCommitSHA on it.
+// It returns the cherry-picked commits, and those that conflicted.
+func cherryPickOnBranch(
+	ctx context.Context,
+	client *github.Client,
+	repo *git.Repo,
+	originalPRInfo prInformation,
+	originalPR *github.PullRequest,
+	mergedCommitSHA string,
+	releaseRef *github.Reference,
+	newBranch string,
+) ([]string, []portConflict, error) {
 	// Clone the repository
 	if err := repo.Clone(ctx); err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to clone repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
+		return nil, nil, errors.Wrapf(err, "Failed to clone repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
 	}
 
 	// Clean the repository
 	if err := repo.Clean(ctx); err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to clean the repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
+		return nil, nil, errors.Wrapf(err, "Failed to clean the repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
 	}
 
 	// Fetch origin
 	if err := repo.Fetch(ctx, "origin"); err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to fetch origin on repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
+		return nil, nil, errors.Wrapf(err, "Failed to fetch origin on repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
 	}
 
 	// Reset the repository
 	if err := repo.ResetHard(ctx, "HEAD"); err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to reset the repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
+		return nil, nil, errors.Wrapf(err, "Failed to reset the repository %s/%s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num)
+	}
+
+	// Checkout the new branch, starting over from the release branch in case
+	// it already existed, e.g. when a previous attempt of this job was
+	// interrupted or when the port is rebuilt. The local branch does not depend
+	// on the one created through the API, which does not exist in dry-run mode.
+	if err := repo.CheckoutNewBranch(ctx, newBranch, releaseRef.GetObject().GetSHA()); err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to checkout repository %s/%s to branch %s at %s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, newBranch, releaseRef.GetRef(), originalPRInfo.num)
+	}
+
+	commits, err := commitsToPort(ctx, client, repo, originalPRInfo, originalPR, mergedCommitSHA)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Credit the original author, as the bot authors the cherry-picks.
+	var trailers []string
+	if trailer := coAuthorTrailer(originalPR.GetUser()); trailer != "" {
+		trailers = append(trailers, trailer)
+	}
+
+	// Cherry-pick the commits
+	var conflicts []portConflict
+	for _, sha := range commits {
+		conflicted, files, err := cherryPickCommit(ctx, repo, sha, trailers)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Failed to cherry-pick %s to branch %s to backport Pull Request %d", sha, newBranch, originalPRInfo.num)
+		}
+		if conflicted {
+			conflicts = append(conflicts, portConflict{sha: sha, files: files})
+		}
+	}
+
+	return commits, conflicts, nil
+}
+
+// commitsToPort returns the commits to cherry-pick, oldest first, to port the
+// Pull Request merged as mergedCommitSHA.
+//
+// Merging or squashing a Pull Request creates a single commit holding all its
+// changes. Rebasing it instead adds one commit per commit of the Pull Request
+// to the base branch, the last one being mergedCommitSHA. These are recognized
+// by their messages, which the rebase keeps as is.
+func commitsToPort(
+	ctx context.Context,
+	client *github.Client,
+	repo *git.Repo,
+	originalPRInfo prInformation,
+	originalPR *github.PullRequest,
+	mergedCommitSHA string,
+) ([]string, error) {
+	parents, err := repo.Parents(ctx, mergedCommitSHA)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get the parents of %s to port Pull Request %d", mergedCommitSHA, originalPRInfo.num)
+	}
+	if len(parents) > 1 {
+		return []string{mergedCommitSHA}, nil
 	}
 
-	// Checkout the new branch
-	if err := repo.Checkout(ctx, newBranch); err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to checkout repository %s/%s to branch %s to backport Pull Request %d", originalPRInfo.repoOwner, originalPRInfo.repoName, newBranch, originalPRInfo.num)
+	prCommits, err := repo.ListPRCommits(ctx, client, originalPR.GetNumber())
+	if err != nil {
+		return nil, err
+	}
+	if len(prCommits) <= 1 {
+		return []string{mergedCommitSHA}, nil
 	}
 
-	conflict := false
+	rebased, err := repo.RevList(ctx, "--first-parent", fmt.Sprintf("--max-count=%d", len(prCommits)), mergedCommitSHA)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list the commits before %s to port Pull Request %d", mergedCommitSHA, originalPRInfo.num)
+	}
+	if len(rebased) < len(prCommits) {
+		return []string{mergedCommitSHA}, nil
+	}
+
+	// rev-list lists the most recent commits first.
+	commits := make([]string, 0, len(rebased))
+	for i, prCommit := range prCommits {
+		sha := rebased[len(rebased)-1-i]
+		message, err := repo.CommitMessage(ctx, sha)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to get the message of %s to port Pull Request %d", sha, originalPRInfo.num)
+		}
+
+		if message != strings.TrimSpace(prCommit.GetCommit().GetMessage()) {
+			// The commits were squashed into mergedCommitSHA.
+			return []string{mergedCommitSHA}, nil
+		}
+		commits = append(commits, sha)
+	}
+
+	return commits, nil
+}
+
+// cherryPickCommit cherry-picks sha on the current branch, taking its changes
+// relative to its first parent if it is a merge commit, and makes the bot the
+// author of the new commit, with the given trailers. Conflicts are committed as
+// is, so that the following commits can still be cherry-picked, and reported
+// along with the conflicting files.
+func cherryPickCommit(ctx context.Context, repo *git.Repo, sha string, trailers []string) (bool, []git.Conflict, error) {
+	err := repo.CherryPickMerge(ctx, sha)
+	switch {
+	case err != nil && strings.Contains(err.Error(), "conflicts"):
+		conflicts, err := repo.Conflicts(ctx)
+		if err != nil {
+			return false, nil, err
+		}
 
-	// Cherry-pick the commit
-	if err := repo.CherryPickMerge(ctx, mergedCommitSHA); err != nil && strings.Contains(err.Error(), "conflicts") {
 		if err := repo.Add(ctx, "."); err != nil {
-			return nil, false, errors.Wrapf(err, "Failed to do 'git add' on branch %s to backport Pull Request %d", newBranch, originalPRInfo.num)
+			return false, nil, errors.Wrapf(err, "Failed to do 'git add' after cherry-picking %s with conflicts", sha)
 		}
 
-		if err := repo.Commit(ctx, fmt.Sprintf("Cherry-pick %s with conflicts", mergedCommitSHA), git.CommitOpts{
-			Author: botCommitAuthor,
+		if err := repo.Commit(ctx, fmt.Sprintf("Cherry-pick %s with conflicts", sha), git.CommitOpts{
+			Author:   botCommitAuthor,
+			Trailers: trailers,
 		}); err != nil {
-			return nil, false, errors.Wrapf(err, "Failed to do 'git commit' on branch %s to backport Pull Request %d", newBranch, originalPRInfo.num)
+			return false, nil, errors.Wrapf(err, "Failed to do 'git commit' after cherry-picking %s with conflicts", sha)
 		}
 
-		conflict = true
-	} else if err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to cherry-pick %s to branch %s to backport Pull Request %d", mergedCommitSHA, newBranch, originalPRInfo.num)
-	} else {
+		return true, conflicts, nil
+	case err != nil:
+		return false, nil, err
+	default:
 		if err := repo.Commit(ctx, "", git.CommitOpts{
-			Author: botCommitAuthor,
-			Amend:  true,
-			NoEdit: true,
+			Author:   botCommitAuthor,
+			Trailers: trailers,
+			Amend:    true,
+			NoEdit:   true,
 		}); err != nil {
-			return nil, false, errors.Wrapf(err, "Failed to do 'git commit --amend' on branch %s to backport Pull Request %d", newBranch, originalPRInfo.num)
+			return false, nil, errors.Wrapf(err, "Failed to do 'git commit --amend' after cherry-picking %s", sha)
 		}
 	}
 
-	// Push the changes
-	if err := repo.Push(ctx, git.PushOpts{
-		Remote: "origin",
-		Refs:   []string{newBranch},
-		Force:  true,
-	}); err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to push %s to backport Pull Request %s", newBranch, originalPRInfo.num)
-	}
-
-	// Create a Pull Request for the new branch
-	newPR := &github.NewPullRequest{
-		Title:               github.String(fmt.Sprintf("[%s] %s (#%d)", branch, originalPR.GetTitle(), originalPR.GetNumber())),
-		Head:                github.String(newBranch),
-		Base:                github.String(branch),
-		Body:                github.String(fmt.Sprintf("## Description\nThis is a %s of #%d", portType, originalPR.GetNumber())),
-		MaintainerCanModify: github.Bool(true),
-		Draft:               &conflict,
-	}
-	newPRCreated, _, err := client.PullRequests.Create(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, newPR)
-	if err != nil {
-		return nil, false, errors.Wrapf(err, "Failed to create Pull Request using branch %s on %s/%s", newBranch, originalPRInfo.repoOwner, originalPRInfo.repoName)
-	}
-	return newPRCreated, conflict, nil
+	return false, nil, nil
 }
 
 func addLabelsToPortedPR(
@@ -169,7 +338,7 @@ func addLabelsToPortedPR(
 ) error {
 	labelsToAdd := labels
 	if conflict {
-		labelsToAdd = append(labelsToAdd, "Merge Conflict", "Skip CI")
+		labelsToAdd = append(labelsToAdd, mergeConflictLabel, skipCILabel)
 	}
 	switch portType {
 	case backport:
@@ -189,9 +358,12 @@ func addConflictCommentToPortedPR(
 	client *github.Client,
 	originalPRInfo prInformation,
 	newPRNumber int,
-	originalPRAuthor, portType, branch, mergedCommitSHA string,
+	originalPRAuthor, portType, branch string,
+	commits []string,
+	conflicts []portConflict,
+	prerequisites []prerequisite,
 ) error {
-	str := "Hello @%s, there are conflicts in this %s.\n\nPlease address them in order to merge this Pull Request. You can execute the snippet below to reset your branch and resolve the conflict manually.\n\nMake sure you replace `origin` by the name of the %s/%s remote \n```\ngit fetch --all\ngh pr checkout %d -R %s/%s\ngit reset --hard origin/%s\ngit cherry-pick -m 1 %s\n"
+	str := "Hello @%s, there are conflicts in this %s.\n\nPlease address them in order to merge this Pull Request. You can execute the snippet below to reset your branch and resolve the conflict manually.\n\nMake sure you replace `origin` by the name of the %s/%s remote \n```\ngit fetch --all\ngh pr checkout %d -R %s/%s\ngit reset --hard origin/%s\ngit cherry-pick -m 1 %s\n```\n"
 	conflictCommentBody := fmt.Sprintf(
 		str,
 		originalPRAuthor,
@@ -202,8 +374,10 @@ func addConflictCommentToPortedPR(
 		originalPRInfo.repoOwner,
 		originalPRInfo.repoName,
 		branch,
-		mergedCommitSHA,
+		strings.Join(commits, " "),
 	)
+	conflictCommentBody += conflictReport(branch, conflicts)
+	conflictCommentBody += prerequisitesReport(prerequisites, originalPRInfo.num, branch, portType)
 	prCommentConflict := github.IssueComment{
 		Body: &conflictCommentBody,
 	}
@@ -213,25 +387,92 @@ func addConflictCommentToPortedPR(
 	return nil
 }
 
-func addReviewersToPortedPR(ctx context.Context, client *github.Client, originalPRInfo prInformation, originalPRAuthor string, newPRNumber int) error {
+// conflictReport lists the conflicting files of each commit, and the commits of
+// branch that last changed their conflicting regions, so that the conflicts can
+// be understood without cherry-picking again.
+func conflictReport(branch string, conflicts []portConflict) string {
+	if len(conflicts) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n### Conflicts\n")
+	for _, conflict := range conflicts {
+		fmt.Fprintf(&b, "\nCherry-picking %s conflicted in:\n", conflict.sha)
+		for _, file := range conflict.files {
+			fmt.Fprintf(&b, "- `%s`: ", file.Path)
+			switch file.Hunks {
+			case 0:
+				b.WriteString("deleted on one side and modified on the other")
+			case 1:
+				b.WriteString("1 conflicting hunk")
+			default:
+				fmt.Fprintf(&b, "%d conflicting hunks", file.Hunks)
+			}
+
+			if len(file.Commits) > 0 {
+				var commits []string
+				for _, commit := range file.Commits {
+					commits = append(commits, fmt.Sprintf("%s (%s)", commit.SHA, commit.Summary))
+				}
+				fmt.Fprintf(&b, ", last changed on `%s` by %s", branch, strings.Join(commits, ", "))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+// addReviewersToPortedPR requests reviews on newPR from the reviewers of the
+// original Pull Request, users and teams by slug. The author of the original
+// Pull Request and the author of newPR are skipped, as GitHub refuses to
+// request their reviews. If GitHub refuses the whole request, each reviewer is
+// requested on its own so that a single invalid reviewer does not leave the
+// port without any.
+func addReviewersToPortedPR(ctx context.Context, client *github.Client, originalPRInfo prInformation, originalPRAuthor string, newPR *github.PullRequest) error {
 	oldReviewers, _, err := client.PullRequests.ListReviewers(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, originalPRInfo.num, nil)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to get the list of reviewers on Pull Request %d", originalPRInfo.num)
 	}
 
-	var reviewers []string
+	var request github.ReviewersRequest
+	seen := map[string]bool{}
+	addUser := func(login string) {
+		if login == "" || seen[login] || strings.EqualFold(login, originalPRAuthor) || strings.EqualFold(login, newPR.GetUser().GetLogin()) {
+			return
+		}
+		seen[login] = true
+		request.Reviewers = append(request.Reviewers, login)
+	}
 	for _, user := range oldReviewers.Users {
-		reviewers = append(reviewers, user.GetLogin())
+		addUser(user.GetLogin())
 	}
 	for _, team := range oldReviewers.Teams {
-		reviewers = append(reviewers, team.GetName())
+		request.TeamReviewers = append(request.TeamReviewers, team.GetSlug())
 	}
-	reviewers = append(reviewers, originalPRAuthor)
-	_, _, err = client.PullRequests.RequestReviewers(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, newPRNumber, github.ReviewersRequest{
-		Reviewers: reviewers,
-	})
-	if err != nil {
-		return errors.Wrapf(err, "Failed to request reviewers on Pull Request %s/%s#%d", originalPRInfo.repoOwner, originalPRInfo.repoName, newPRNumber)
+	if len(request.Reviewers) == 0 && len(request.TeamReviewers) == 0 {
+		return nil
+	}
+
+	newPRNumber := newPR.GetNumber()
+	_, _, err = client.PullRequests.RequestReviewers(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, newPRNumber, request)
+	if err == nil {
+		return nil
+	}
+
+	logger := zerolog.Ctx(ctx)
+	logger.Warn().Err(err).Msgf("Failed to request reviewers on Pull Request %s/%s#%d, requesting them one by one", originalPRInfo.repoOwner, originalPRInfo.repoName, newPRNumber)
+	requestOne := func(reviewer string, r github.ReviewersRequest) {
+		if _, _, err := client.PullRequests.RequestReviewers(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, newPRNumber, r); err != nil {
+			logger.Error().Err(err).Msgf("Failed to request a review from %s on Pull Request %s/%s#%d", reviewer, originalPRInfo.repoOwner, originalPRInfo.repoName, newPRNumber)
+		}
+	}
+	for _, login := range request.Reviewers {
+		requestOne(login, github.ReviewersRequest{Reviewers: []string{login}})
+	}
+	for _, slug := range request.TeamReviewers {
+		requestOne("team "+slug, github.ReviewersRequest{TeamReviewers: []string{slug}})
 	}
 	return nil
 }
@@ -0,0 +1,527 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/dryrun"
+	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/git/gittest"
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+func TestPortedPRFollowUps(t *testing.T) {
+	ctx := context.Background()
+	gh := githubtest.NewServer(t)
+	client := gh.Client()
+
+	original := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		User:   &github.User{Login: github.String("author")},
+		Merged: github.Bool(true),
+	})
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.Reviewers[original] = &github.Reviewers{
+			Users: []*github.User{{Login: github.String("reviewer")}, {Login: github.String("author")}},
+		}
+	})
+	ported := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		User: &github.User{Login: github.String(githubtest.DefaultLogin)},
+	})
+
+	prInfo := prInformation{num: original, repoOwner: "vitessio", repoName: "vitess"}
+
+	require.NoError(t, addLabelsToPortedPR(ctx, client, prInfo, []string{"Type: Bug"}, true, backport, ported))
+	assert.Equal(t, []string{"Type: Bug", "Merge Conflict", "Skip CI", "Backport"}, gh.Labels("vitessio", "vitess", ported))
+
+	require.NoError(t, addConflictCommentToPortedPR(ctx, client, prInfo, ported, "author", backport, "release-18.0", []string{"abc123"}, nil, nil))
+	comments := gh.Comments("vitessio", "vitess", ported)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0], "Hello @author, there are conflicts in this backport.")
+	assert.Contains(t, comments[0], "gh pr checkout 2 -R vitessio/vitess\ngit reset --hard origin/release-18.0\ngit cherry-pick -m 1 abc123")
+
+	require.NoError(t, addReviewersToPortedPR(ctx, client, prInfo, "author", gh.PullRequest("vitessio", "vitess", ported)))
+	reviewers, _, err := client.PullRequests.ListReviewers(ctx, "vitessio", "vitess", ported, nil)
+	require.NoError(t, err)
+	var logins []string
+	for _, user := range reviewers.Users {
+		logins = append(logins, user.GetLogin())
+	}
+	assert.Equal(t, []string{"reviewer"}, logins)
+}
+
+func TestAddReviewersToPortedPR(t *testing.T) {
+	queryServing := &github.Team{Name: github.String("Query Serving"), Slug: github.String("query-serving")}
+	releases := &github.Team{Name: github.String("Releases"), Slug: github.String("releases")}
+
+	tcases := []struct {
+		name          string
+		author        string
+		collaborators []string
+		// teams are the teams of vitessio, the original Pull Request requests
+		// reviews from Query Serving and Releases.
+		teams     []*github.Team
+		wantUsers []string
+		wantTeams []string
+	}{
+		{
+			name:      "users and teams",
+			author:    "author",
+			teams:     []*github.Team{queryServing, releases},
+			wantUsers: []string{"reviewer", "outsider"},
+			wantTeams: []string{"query-serving", "releases"},
+		},
+		{
+			name:      "author is the bot",
+			author:    githubtest.DefaultLogin,
+			teams:     []*github.Team{queryServing, releases},
+			wantUsers: []string{"reviewer", "outsider"},
+			wantTeams: []string{"query-serving", "releases"},
+		},
+		{
+			name:          "invalid reviewer",
+			author:        "author",
+			collaborators: []string{"reviewer", "author"},
+			teams:         []*github.Team{queryServing, releases},
+			wantUsers:     []string{"reviewer"},
+			wantTeams:     []string{"query-serving", "releases"},
+		},
+		{
+			name:      "invalid team",
+			author:    "author",
+			teams:     []*github.Team{queryServing},
+			wantUsers: []string{"reviewer", "outsider"},
+			wantTeams: []string{"query-serving"},
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			gh := githubtest.NewServer(t)
+			client := gh.Client()
+
+			original := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				User:   &github.User{Login: github.String(tc.author)},
+				Merged: github.Bool(true),
+			})
+			ported := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				User: &github.User{Login: github.String(githubtest.DefaultLogin)},
+			})
+			gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+				r.Reviewers[original] = &github.Reviewers{
+					Users: []*github.User{{Login: github.String("reviewer")}, {Login: github.String("outsider")}, {Login: github.String(tc.author)}},
+					Teams: []*github.Team{queryServing, releases},
+				}
+				r.Collaborators = tc.collaborators
+				r.Teams = tc.teams
+			})
+
+			prInfo := prInformation{num: original, repoOwner: "vitessio", repoName: "vitess"}
+			require.NoError(t, addReviewersToPortedPR(ctx, client, prInfo, tc.author, gh.PullRequest("vitessio", "vitess", ported)))
+
+			reviewers, _, err := client.PullRequests.ListReviewers(ctx, "vitessio", "vitess", ported, nil)
+			require.NoError(t, err)
+			var users, teams []string
+			for _, user := range reviewers.Users {
+				users = append(users, user.GetLogin())
+			}
+			for _, team := range reviewers.Teams {
+				teams = append(teams, team.GetSlug())
+			}
+			assert.Equal(t, tc.wantUsers, users)
+			assert.Equal(t, tc.wantTeams, teams)
+		})
+	}
+}
+
+// newTestOrigin returns a local origin of vitessio/vitess under root, whose
+// release-18.0 branch changes config.go. The refs created through the fake API
+// gh are mirrored to it.
+func newTestOrigin(t *testing.T, gh *githubtest.Server, root string) *gittest.Origin {
+	t.Helper()
+
+	origin := gittest.NewOrigin(t, root, "vitessio", "vitess", "main")
+	origin.Commit("main", "Add the config", map[string]string{"config.go": "package config\n\nconst Version = 18\n"})
+	origin.Branch("release-18.0", "main")
+	origin.Commit("release-18.0", "Patch the version", map[string]string{"config.go": "package config\n\nconst Version = 18.1\n"})
+
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.Refs["heads/release-18.0"] = origin.Rev("release-18.0")
+	})
+	gh.OnRefUpdate(func(owner, name, ref, sha string) {
+		origin.SetRef(ref, sha)
+	})
+
+	return origin
+}
+
+func TestRunPortJob(t *testing.T) {
+	ctx := context.Background()
+
+	tcases := []struct {
+		name     string
+		files    map[string]string
+		conflict bool
+	}{
+		{
+			name:  "clean",
+			files: map[string]string{"feature.go": "package feature\n"},
+		},
+		{
+			name:     "conflict",
+			files:    map[string]string{"config.go": "package config\n\nconst Version = 19\n"},
+			conflict: true,
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			gh := githubtest.NewServer(t)
+			origin := newTestOrigin(t, gh, root)
+			mergeSHA := origin.MergePR("main", "fix", "Fix a bug", tc.files)
+
+			number := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				Title:          github.String("Fix a bug"),
+				Body:           github.String("Fixes the config.\n\n## Related Issue(s)\nFixes #10"),
+				User:           &github.User{Login: github.String("author"), ID: github.Int64(42)},
+				State:          github.String("closed"),
+				Merged:         github.Bool(true),
+				MergeCommitSHA: github.String(mergeSHA),
+				Base:           &github.PullRequestBranch{Ref: github.String("main")},
+				Labels:         []*github.Label{{Name: github.String("Backport to: release-18.0")}, {Name: github.String("Type: Bug")}},
+			})
+			gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+				for i, title := range []string{"v18.0.1", "v18.0.3", "v18.0.2", "v19.0.0"} {
+					state := "open"
+					if title == "v18.0.1" {
+						state = "closed"
+					}
+					r.Milestones = append(r.Milestones, &github.Milestone{Number: github.Int(i + 1), Title: github.String(title), State: github.String(state)})
+				}
+			})
+
+			h, _ := newTestPullRequestHandler(t, gh)
+			h.worktrees = git.NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+
+			require.NoError(t, h.runPortJob(ctx, &queue.Job{
+				InstallationID: 1,
+				Owner:          "vitessio",
+				Repo:           "vitess",
+				Number:         number,
+				Args:           map[string]string{"branch": "release-18.0", "portType": backport, "notify": "true"},
+			}))
+
+			pulls := gh.PullRequests("vitessio", "vitess")
+			require.Len(t, pulls, 2)
+			ported := pulls[1]
+			assert.Equal(t, "[release-18.0] Fix a bug (#1)", ported.GetTitle())
+			assert.Equal(t, "backport-1-to-release-18.0", ported.GetHead().GetRef())
+			assert.Equal(t, "release-18.0", ported.GetBase().GetRef())
+			assert.Equal(t, tc.conflict, ported.GetDraft())
+			assert.Equal(t, "## Description\nThis is a backport of #1\n\n### Description of #1\n\nFixes the config.\n\n## Related Issue(s)\nRelated to #10", ported.GetBody())
+			assert.Equal(t, "v18.0.2", ported.GetMilestone().GetTitle())
+			assert.True(t, strings.HasSuffix(origin.Git("--git-dir", origin.Dir, "log", "-1", "--format=%B", "backport-1-to-release-18.0"), "\n\nCo-authored-by: author <42+author@users.noreply.github.com>"))
+			originalComments := gh.Comments("vitessio", "vitess", number)
+			require.Len(t, originalComments, 2)
+			assert.Equal(t, fmt.Sprintf("Opened backport #%d to `release-18.0`.", ported.GetNumber()), originalComments[0])
+			assert.Contains(t, originalComments[1], fmt.Sprintf("| `release-18.0` (backport) | #%d |", ported.GetNumber()))
+
+			comments := gh.Comments("vitessio", "vitess", ported.GetNumber())
+			log := origin.Log("backport-1-to-release-18.0", "release-18.0")
+			require.Len(t, log, 1)
+			if tc.conflict {
+				assert.Equal(t, []string{"Type: Bug", "Merge Conflict", "Skip CI", "Backport"}, gh.Labels("vitessio", "vitess", ported.GetNumber()))
+				require.Len(t, comments, 1)
+				assert.Contains(t, comments[0], "there are conflicts in this backport")
+				assert.Contains(t, comments[0], fmt.Sprintf("### Conflicts\n\nCherry-picking %s conflicted in:\n- `config.go`: 1 conflicting hunk, last changed on `release-18.0` by %s (Patch the version)\n", mergeSHA, origin.Rev("release-18.0")))
+				assert.Equal(t, fmt.Sprintf("Cherry-pick %s with conflicts", mergeSHA), log[0])
+				assert.Contains(t, origin.File("backport-1-to-release-18.0", "config.go"), "<<<<<<<")
+			} else {
+				assert.Equal(t, []string{"Type: Bug", "Backport"}, gh.Labels("vitessio", "vitess", ported.GetNumber()))
+				assert.Empty(t, comments)
+				assert.Equal(t, "Merge branch 'fix'", log[0])
+				assert.Equal(t, "package feature", origin.File("backport-1-to-release-18.0", "feature.go"))
+			}
+		})
+	}
+}
+
+func TestRunPortJobFailingFollowUps(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	gh := githubtest.NewServer(t)
+	origin := newTestOrigin(t, gh, root)
+	mergeSHA := origin.MergePR("main", "fix", "Fix a bug", map[string]string{"config.go": "package config\n\nconst Version = 19\n"})
+
+	number := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Title:          github.String("Fix a bug"),
+		User:           &github.User{Login: github.String("author")},
+		State:          github.String("closed"),
+		Merged:         github.Bool(true),
+		MergeCommitSHA: github.String(mergeSHA),
+		Base:           &github.PullRequestBranch{Ref: github.String("main")},
+		Labels:         []*github.Label{{Name: github.String("Backport to: release-18.0")}},
+	})
+	gh.Fail(http.MethodPost, "/repos/vitessio/vitess/issues/2/labels")
+	gh.Fail(http.MethodGet, "/repos/vitessio/vitess/milestones")
+	gh.Fail(http.MethodGet, fmt.Sprintf("/repos/vitessio/vitess/pulls/%d/requested_reviewers", number))
+
+	h, _ := newTestPullRequestHandler(t, gh)
+	h.worktrees = git.NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+
+	// The port was opened, so the job succeeds rather than being retried and
+	// commenting again.
+	require.NoError(t, h.runPortJob(ctx, &queue.Job{
+		InstallationID: 1,
+		Owner:          "vitessio",
+		Repo:           "vitess",
+		Number:         number,
+		Args:           map[string]string{"branch": "release-18.0", "portType": backport, "notify": "true"},
+	}))
+
+	pulls := gh.PullRequests("vitessio", "vitess")
+	require.Len(t, pulls, 2)
+	assert.Empty(t, gh.Labels("vitessio", "vitess", pulls[1].GetNumber()))
+	comments := gh.Comments("vitessio", "vitess", pulls[1].GetNumber())
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0], "there are conflicts in this backport")
+	assert.Equal(t, fmt.Sprintf("Opened backport #%d to `release-18.0`.", pulls[1].GetNumber()), gh.Comments("vitessio", "vitess", number)[0])
+}
+
+func TestRunPortJobDryRun(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	gh := githubtest.NewServer(t)
+	origin := newTestOrigin(t, gh, root)
+	mergeSHA := origin.MergePR("main", "fix", "Fix a bug", map[string]string{"feature.go": "package feature\n"})
+
+	number := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Title:          github.String("Fix a bug"),
+		User:           &github.User{Login: github.String("author")},
+		State:          github.String("closed"),
+		Merged:         github.Bool(true),
+		MergeCommitSHA: github.String(mergeSHA),
+		Base:           &github.PullRequestBranch{Ref: github.String("main")},
+		Labels:         []*github.Label{{Name: github.String("Backport to: release-18.0")}},
+	})
+
+	rec := dryrun.New()
+	h, _ := newTestPullRequestHandler(t, gh)
+	h.ClientCreator = gh.ClientCreator(rec.Middleware())
+	h.worktrees = git.NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root)).WithDryRun(rec)
+
+	require.NoError(t, h.runPortJob(ctx, &queue.Job{
+		InstallationID: 1,
+		Owner:          "vitessio",
+		Repo:           "vitess",
+		Number:         number,
+		Args:           map[string]string{"branch": "release-18.0", "portType": backport, "notify": "true"},
+	}))
+
+	// Nothing changed, neither through the API nor on origin.
+	assert.Len(t, gh.PullRequests("vitessio", "vitess"), 1)
+	assert.Empty(t, gh.Comments("vitessio", "vitess", number))
+	assert.Empty(t, origin.Git("ls-remote", "--heads", "origin", "backport-1-to-release-18.0"))
+
+	var mutations []string
+	for _, m := range rec.Mutations() {
+		if m.Command != nil {
+			mutations = append(mutations, strings.Join(m.Command, " "))
+		} else {
+			mutations = append(mutations, m.Method+" "+strings.TrimPrefix(m.URL, gh.URL))
+		}
+	}
+	assert.Contains(t, mutations, "POST /repos/vitessio/vitess/git/refs")
+	assert.Contains(t, mutations, "git push --force origin backport-1-to-release-18.0")
+	assert.Contains(t, mutations, "POST /repos/vitessio/vitess/pulls")
+}
+
+// prCommits returns the commits of a Pull Request made of changes, as listed by
+// the API.
+func prCommits(changes []gittest.Change) []*github.RepositoryCommit {
+	var commits []*github.RepositoryCommit
+	for _, change := range changes {
+		commits = append(commits, &github.RepositoryCommit{
+			Commit: &github.Commit{Message: github.String(change.Message + "\n")},
+		})
+	}
+	return commits
+}
+
+func TestCommitsToPort(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	gh := githubtest.NewServer(t)
+	origin := newTestOrigin(t, gh, root)
+
+	changes := []gittest.Change{
+		{Message: "Add a feature", Files: map[string]string{"feature.go": "package feature\n"}},
+		{Message: "Test the feature\n\nWith a body.", Files: map[string]string{"feature_test.go": "package feature\n"}},
+	}
+
+	merged := origin.MergePR("main", "merged", "Fix a bug", map[string]string{"fix.go": "package fix\n"})
+	squashed := origin.SquashPR("main", "squashed", "Add a feature (#2)", changes)
+	rebased := origin.RebasePR("main", "rebased", changes)
+	rebasedOnce := origin.RebasePR("main", "rebased-once", changes[:1])
+
+	tcases := []struct {
+		name     string
+		sha      string
+		changes  []gittest.Change
+		expected []string
+	}{
+		{name: "merge commit", sha: merged, changes: changes[:1], expected: []string{merged}},
+		{name: "squashed", sha: squashed, changes: changes, expected: []string{squashed}},
+		{name: "rebased", sha: rebased[1], changes: changes, expected: rebased},
+		{name: "rebased single commit", sha: rebasedOnce[0], changes: changes[:1], expected: rebasedOnce},
+	}
+
+	worktrees := git.NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+	repo, err := worktrees.Acquire(ctx, "vitessio", "vitess", "main", "commits-to-port")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, worktrees.Release(ctx, repo))
+	}()
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			number := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{Merged: github.Bool(true)})
+			gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+				r.PullCommits[number] = prCommits(tc.changes)
+			})
+			prInfo := prInformation{num: number, repoOwner: "vitessio", repoName: "vitess"}
+
+			commits, err := commitsToPort(ctx, gh.Client(), repo, prInfo, gh.PullRequest("vitessio", "vitess", number), tc.sha)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, commits)
+		})
+	}
+}
+
+func TestPortRebasedPR(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	gh := githubtest.NewServer(t)
+	origin := newTestOrigin(t, gh, root)
+
+	changes := []gittest.Change{
+		{Message: "Add a feature", Files: map[string]string{"feature.go": "package feature\n"}},
+		{Message: "Bump the version", Files: map[string]string{"config.go": "package config\n\nconst Version = 19\n"}},
+		{Message: "Test the feature", Files: map[string]string{"feature_test.go": "package feature\n"}},
+	}
+	rebased := origin.RebasePR("main", "feature", changes)
+
+	number := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Title:          github.String("Add a feature"),
+		User:           &github.User{Login: github.String("author")},
+		State:          github.String("closed"),
+		Merged:         github.Bool(true),
+		MergeCommitSHA: github.String(rebased[2]),
+		Base:           &github.PullRequestBranch{Ref: github.String("main")},
+	})
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.PullCommits[number] = prCommits(changes)
+	})
+
+	h, _ := newTestPullRequestHandler(t, gh)
+	h.worktrees = git.NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+
+	require.NoError(t, h.runPortJob(ctx, &queue.Job{
+		InstallationID: 1,
+		Owner:          "vitessio",
+		Repo:           "vitess",
+		Number:         number,
+		Args:           map[string]string{"branch": "release-18.0", "portType": backport},
+	}))
+
+	// Each commit is cherry-picked, and the conflicts of the second one do not
+	// prevent the third one from being cherry-picked.
+	assert.Equal(t, []string{
+		"Test the feature",
+		fmt.Sprintf("Cherry-pick %s with conflicts", rebased[1]),
+		"Add a feature",
+	}, origin.Log("backport-1-to-release-18.0", "release-18.0"))
+	assert.Equal(t, "package feature", origin.File("backport-1-to-release-18.0", "feature_test.go"))
+
+	ported := gh.PullRequests("vitessio", "vitess")[1]
+	assert.True(t, ported.GetDraft())
+	comments := gh.Comments("vitessio", "vitess", ported.GetNumber())
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0], fmt.Sprintf("git cherry-pick -m 1 %s %s %s\n", rebased[0], rebased[1], rebased[2]))
+}
+
+func TestConflictReport(t *testing.T) {
+	tcases := []struct {
+		name      string
+		conflicts []portConflict
+		expected  string
+	}{
+		{name: "no conflicts"},
+		{
+			name: "conflicts",
+			conflicts: []portConflict{
+				{
+					sha: "abc123",
+					files: []git.Conflict{
+						{
+							Path:  "go/config.go",
+							Hunks: 2,
+							Commits: []git.BlamedCommit{
+								{SHA: "def456", Summary: "Patch the version"},
+								{SHA: "789abc", Summary: "Rename the release"},
+							},
+						},
+						{Path: "go/main.go", Hunks: 1},
+						{Path: "docs.md"},
+					},
+				},
+				{
+					sha:   "cba987",
+					files: []git.Conflict{{Path: "go/config.go", Hunks: 1, Commits: []git.BlamedCommit{{SHA: "def456", Summary: "Patch the version"}}}},
+				},
+			},
+			expected: "\n### Conflicts\n" +
+				"\nCherry-picking abc123 conflicted in:\n" +
+				"- `go/config.go`: 2 conflicting hunks, last changed on `release-18.0` by def456 (Patch the version), 789abc (Rename the release)\n" +
+				"- `go/main.go`: 1 conflicting hunk\n" +
+				"- `docs.md`: deleted on one side and modified on the other\n" +
+				"\nCherry-picking cba987 conflicted in:\n" +
+				"- `go/config.go`: 1 conflicting hunk, last changed on `release-18.0` by def456 (Patch the version)\n",
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, conflictReport("release-18.0", tc.conflicts))
+		})
+	}
+}
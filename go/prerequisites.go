@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+
+	"github.com/vitess.io/vitess-bot/go/git"
+)
+
+// prerequisite is a Pull Request that was merged before the one being ported,
+// changed the same lines, and was not ported to the same branch: porting it
+// first likely avoids the conflicts.
+type prerequisite struct {
+	number int
+	title  string
+}
+
+// findPrerequisites returns the likely prerequisites of the port of
+// originalPR to branch, given the conflicts of its commits.
+//
+// For each conflicting file, the lines changed by the conflicting commit are
+// blamed on the base branch of originalPR, down to where branch forked from
+// it. The Pull Requests of the blamed commits are prerequisites, unless a
+// commit of branch mentions them, as ported Pull Requests do in their title.
+func findPrerequisites(
+	ctx context.Context,
+	client *github.Client,
+	repo *git.Repo,
+	originalPRInfo prInformation,
+	originalPR *github.PullRequest,
+	branch string,
+	conflicts []portConflict,
+) ([]prerequisite, error) {
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+
+	forkPoint, err := repo.MergeBase(ctx, "origin/"+branch, conflicts[0].sha)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to find where %s forked from %s", branch, originalPR.GetBase().GetRef())
+	}
+
+	ported, err := repo.Log(ctx, forkPoint+"..origin/"+branch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list the commits of %s", branch)
+	}
+	isPorted := func(number int) bool {
+		for _, subject := range ported {
+			if strings.Contains(subject, fmt.Sprintf("(#%d)", number)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var (
+		prerequisites []prerequisite
+		seenCommits   = map[string]bool{}
+		seenPRs       = map[int]bool{originalPR.GetNumber(): true}
+	)
+	for _, conflict := range conflicts {
+		parent := conflict.sha + "^1"
+		for _, file := range conflict.files {
+			lines, err := repo.ChangedLines(ctx, parent, conflict.sha, file.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			commits, err := repo.Blame(ctx, parent, file.Path, lines, forkPoint)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, commit := range commits {
+				if seenCommits[commit.SHA] {
+					continue
+				}
+				seenCommits[commit.SHA] = true
+
+				prs, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, originalPRInfo.repoOwner, originalPRInfo.repoName, commit.SHA, nil)
+				if err != nil {
+					return nil, errors.Wrapf(err, "Failed to list the Pull Requests of commit %s on %s/%s", commit.SHA, originalPRInfo.repoOwner, originalPRInfo.repoName)
+				}
+
+				for _, pr := range prs {
+					if seenPRs[pr.GetNumber()] || pr.MergedAt == nil || pr.GetBase().GetRef() != originalPR.GetBase().GetRef() {
+						continue
+					}
+					seenPRs[pr.GetNumber()] = true
+
+					if !isPorted(pr.GetNumber()) {
+						prerequisites = append(prerequisites, prerequisite{number: pr.GetNumber(), title: pr.GetTitle()})
+					}
+				}
+			}
+		}
+	}
+
+	return prerequisites, nil
+}
+
+// prerequisitesReport lists the prerequisites of a port, and how to port them.
+func prerequisitesReport(prerequisites []prerequisite, originalPRNumber int, branch, portType string) string {
+	if len(prerequisites) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n### Likely prerequisites\n\nThese Pull Requests changed the same lines before #%d, but were not ported to `%s`:\n", originalPRNumber, branch)
+	for _, p := range prerequisites {
+		fmt.Fprintf(&b, "- #%d %s\n", p.number, p.title)
+	}
+	fmt.Fprintf(&b, "\nTo port them first, comment `%s %s %s` on each of them.\n", commandPrefix, portType, branch)
+
+	return b.String()
+}
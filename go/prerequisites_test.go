@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/git/gittest"
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+func TestFindPrerequisites(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	gh := githubtest.NewServer(t)
+	origin := newTestOrigin(t, gh, root)
+
+	config := func(version, name string) map[string]string {
+		return map[string]string{
+			"config.go": fmt.Sprintf("package config\n\nconst Version = %s\n%sconst Name = %q\n", version, strings.Repeat("\n// Filler.\n", 5), name),
+		}
+	}
+
+	// #1 was backported as #3, #2 was not, and both changed lines that #4
+	// changes too.
+	merged := map[int]string{
+		1: origin.SquashPR("main", "add-name", "Add the name (#1)", []gittest.Change{{Message: "Add the name", Files: config("18", "vitess")}}),
+	}
+	origin.Commit("release-18.0", "[release-18.0] Add the name (#1) (#3)", config("18.1", "vitess"))
+	merged[2] = origin.SquashPR("main", "bump", "Bump the version (#2)", []gittest.Change{{Message: "Bump the version", Files: config("18.5", "vitess")}})
+	merged[4] = origin.SquashPR("main", "release", "Prepare the release (#4)", []gittest.Change{{Message: "Prepare the release", Files: config("19", "vitess-19")}})
+	gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+		r.Refs["heads/release-18.0"] = origin.Rev("release-18.0")
+	})
+
+	titles := map[int]string{1: "Add the name", 2: "Bump the version", 4: "Prepare the release"}
+	for _, number := range []int{1, 2, 4} {
+		gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+			Number:         github.Int(number),
+			Title:          github.String(titles[number]),
+			User:           &github.User{Login: github.String("author")},
+			State:          github.String("closed"),
+			Merged:         github.Bool(true),
+			MergeCommitSHA: github.String(merged[number]),
+			Base:           &github.PullRequestBranch{Ref: github.String("main")},
+		})
+	}
+
+	h, _ := newTestPullRequestHandler(t, gh)
+	h.worktrees = git.NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+
+	require.NoError(t, h.runPortJob(ctx, &queue.Job{
+		InstallationID: 1,
+		Owner:          "vitessio",
+		Repo:           "vitess",
+		Number:         4,
+		Args:           map[string]string{"branch": "release-18.0", "portType": backport},
+	}))
+
+	ported := gh.PullRequests("vitessio", "vitess")[3]
+	assert.Equal(t, "[release-18.0] Prepare the release (#4)", ported.GetTitle())
+	comments := gh.Comments("vitessio", "vitess", ported.GetNumber())
+	require.Len(t, comments, 1)
+	assert.True(t, strings.HasSuffix(comments[0], "\n### Likely prerequisites\n\n"+
+		"These Pull Requests changed the same lines before #4, but were not ported to `release-18.0`:\n"+
+		"- #2 Bump the version\n\n"+
+		"To port them first, comment `/vitess-bot backport release-18.0` on each of them.\n"), comments[0])
+}
@@ -21,7 +21,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
@@ -35,7 +34,9 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/queue"
 	"github.com/vitess.io/vitess-bot/go/shell"
+	"github.com/vitess.io/vitess-bot/go/stats"
 )
 
 const (
@@ -44,37 +45,37 @@ const (
 
 	backport    = "backport"
 	forwardport = "forwardport"
-
-	doNotMergeLabel = "do-not-merge"
-)
-
-var (
-	// these labels are added to PRs that are opened on vitess/vitess, and are not backports or forwardports
-	alwaysAddLabels = []string{
-		"NeedsWebsiteDocsUpdate",
-		"NeedsDescriptionUpdate",
-		"NeedsIssue",
-		"NeedsBackportReason",
-	}
 )
 
 type PullRequestHandler struct {
 	githubapp.ClientCreator
 
-	botLogin        string
-	reviewChecklist string
+	cfg       *botConfig
+	settings  *repoSettingsCache
+	botLogin  string
+	jobs      *queue.Queue
+	worktrees *git.Worktrees
 
-	vitessRepoLock  sync.Mutex
-	websiteRepoLock sync.Mutex
+	// portStatusMu serializes the updates of the port status comments.
+	portStatusMu sync.Mutex
 }
 
-func NewPullRequestHandler(cc githubapp.ClientCreator, reviewChecklist, botLogin string) (h *PullRequestHandler, err error) {
+func NewPullRequestHandler(cc githubapp.ClientCreator, cfg *botConfig, jobs *queue.Queue, worktrees *git.Worktrees, reviewChecklist, botLogin string) (h *PullRequestHandler, err error) {
 	h = &PullRequestHandler{
-		ClientCreator:   cc,
-		botLogin:        botLogin,
-		reviewChecklist: reviewChecklist,
+		ClientCreator: cc,
+		cfg:           cfg,
+		settings:      newRepoSettingsCache(cfg, reviewChecklist),
+		botLogin:      botLogin,
+		jobs:          jobs,
+		worktrees:     worktrees,
 	}
-	err = os.MkdirAll(h.Workdir(), 0777|os.ModeDir)
+
+	jobs.Register(portOperation, h.runPortJob)
+	jobs.Register(rebuildPortOperation, h.runRebuildPortJob)
+	jobs.Register(cobraDocsPreviewOperation, h.runPREventJob(h.createDocsPreview))
+	jobs.Register(errorDocsOperation, h.runPREventJob(h.createErrorDocumentation))
+	jobs.Register(portStatusOperation, h.runPortStatusJob)
+	jobs.Register(revertPortsOperation, h.runPREventJob(h.portRevert))
 
 	return h, err
 }
@@ -91,14 +92,14 @@ type prInformation struct {
 }
 
 func getPRInformation(event github.PullRequestEvent) prInformation {
-	repo := event.GetRepo()
-	merged := false
-	pr := event.GetPullRequest()
-	if pr != nil {
-		merged = pr.GetMerged()
-	}
+	prInfo := getPRInformationFromPR(event.GetRepo(), event.GetPullRequest())
+	prInfo.num = event.GetNumber()
+	return prInfo
+}
+
+func getPRInformationFromPR(repo *github.Repository, pr *github.PullRequest) prInformation {
 	var labels []string
-	for _, label := range event.GetPullRequest().Labels {
+	for _, label := range pr.Labels {
 		if label == nil {
 			continue
 		}
@@ -106,20 +107,16 @@ func getPRInformation(event github.PullRequestEvent) prInformation {
 	}
 	return prInformation{
 		repo:      repo,
-		num:       event.GetNumber(),
+		num:       pr.GetNumber(),
 		repoOwner: repo.GetOwner().GetLogin(),
 		repoName:  repo.GetName(),
-		merged:    merged,
+		merged:    pr.GetMerged(),
 		labels:    labels,
-		base:      event.GetPullRequest().GetBase(),
-		head:      event.GetPullRequest().GetHead(),
+		base:      pr.GetBase(),
+		head:      pr.GetHead(),
 	}
 }
 
-func (h *PullRequestHandler) Workdir() string {
-	return filepath.Join("/", "tmp", "pull_request_handler")
-}
-
 func (h *PullRequestHandler) Handles() []string {
 	return []string{"pull_request"}
 }
@@ -130,6 +127,8 @@ func (h *PullRequestHandler) Handle(ctx context.Context, eventType, deliveryID s
 		return errors.Wrap(err, "failed to parse issue comment event payload")
 	}
 
+	ctx = queue.WithDelivery(ctx, eventType, deliveryID)
+
 	var err error
 	switch event.GetAction() {
 	case "opened":
@@ -141,77 +140,134 @@ func (h *PullRequestHandler) Handle(ctx context.Context, eventType, deliveryID s
 	case "synchronize":
 		err = h.synchronizePullRequest(ctx, event)
 	}
+	if err != nil {
+		return err
+	}
+
+	switch event.GetAction() {
+	case "opened", "closed", "reopened", "labeled", "unlabeled", "synchronize", "ready_for_review", "converted_to_draft":
+		err = h.trackPort(ctx, event)
+	}
 	return err
 }
 
 func (h *PullRequestHandler) openedPullRequest(ctx context.Context, event github.PullRequestEvent) error {
 	prInfo := getPRInformation(event)
-	if prInfo.repoName != "vitess" {
+	if prInfo.repoName != h.cfg.Vitess.Name {
 		return nil
 	}
 
-	err := h.addReviewChecklist(ctx, event, prInfo)
+	settings, err := h.getRepoSettings(ctx, event)
 	if err != nil {
 		return err
 	}
-	err = h.addLabels(ctx, event, prInfo)
-	if err != nil {
-		return err
-	}
-	err = h.createDocsPreview(ctx, event, prInfo)
-	if err != nil {
-		return err
+
+	if settings.Features.ReviewChecklist {
+		err = h.addReviewChecklist(ctx, event, prInfo, settings)
+		if err != nil {
+			return err
+		}
 	}
-	err = h.createErrorDocumentation(ctx, event, prInfo)
-	if err != nil {
-		return err
+	if settings.Features.Labels {
+		err = h.addLabels(ctx, event, prInfo, settings)
+		if err != nil {
+			return err
+		}
 	}
-	return nil
+	return h.enqueueDocsJobs(ctx, event, settings)
 }
 
 func (h *PullRequestHandler) closedPullRequest(ctx context.Context, event github.PullRequestEvent) error {
 	prInfo := getPRInformation(event)
-	if prInfo.repoName != "vitess" || !prInfo.merged {
+	if prInfo.repoName != h.cfg.Vitess.Name || !prInfo.merged {
 		return nil
 	}
 
-	err := h.backportPR(ctx, event, prInfo)
+	settings, err := h.getRepoSettings(ctx, event)
 	if err != nil {
 		return err
 	}
+	if !settings.Features.Ports {
+		return nil
+	}
+
+	err = h.backportPR(ctx, event, prInfo, settings)
+	if err != nil {
+		return err
+	}
+
+	if prInfo.base.GetRef() == h.cfg.Vitess.DefaultBranch && isRevert(event.GetPullRequest()) {
+		return h.enqueuePREvent(ctx, revertPortsOperation, event)
+	}
 	return nil
 }
 
 func (h *PullRequestHandler) labeledPullRequest(ctx context.Context, event github.PullRequestEvent) error {
 	prInfo := getPRInformation(event)
-	if prInfo.repoName != "vitess" {
+	if prInfo.repoName != h.cfg.Vitess.Name {
 		return nil
 	}
 
-	err := h.addArewefastyetComment(ctx, event, prInfo)
+	settings, err := h.getRepoSettings(ctx, event)
 	if err != nil {
 		return err
 	}
+
+	if settings.Features.Benchmark {
+		err = h.addArewefastyetComment(ctx, event, prInfo)
+		if err != nil {
+			return err
+		}
+	}
+	if settings.Features.Ports {
+		err = h.portLabeledPR(ctx, event, prInfo, settings)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (h *PullRequestHandler) synchronizePullRequest(ctx context.Context, event github.PullRequestEvent) error {
 	prInfo := getPRInformation(event)
-	if prInfo.repoName != "vitess" {
+	if prInfo.repoName != h.cfg.Vitess.Name {
 		return nil
 	}
 
-	err := h.createDocsPreview(ctx, event, prInfo)
+	settings, err := h.getRepoSettings(ctx, event)
 	if err != nil {
 		return err
 	}
-	err = h.createErrorDocumentation(ctx, event, prInfo)
-	if err != nil {
-		return err
+	return h.enqueueDocsJobs(ctx, event, settings)
+}
+
+// enqueueDocsJobs enqueues the jobs updating the documentation previews of a
+// Pull Request, as enabled by the repository settings.
+func (h *PullRequestHandler) enqueueDocsJobs(ctx context.Context, event github.PullRequestEvent, settings *repoSettings) error {
+	if settings.Features.CobraDocs {
+		if err := h.enqueuePREvent(ctx, cobraDocsPreviewOperation, event); err != nil {
+			return err
+		}
+	}
+	if settings.Features.ErrorCodeDocs {
+		if err := h.enqueuePREvent(ctx, errorDocsOperation, event); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// getRepoSettings returns the settings of the repository that sent the event.
+func (h *PullRequestHandler) getRepoSettings(ctx context.Context, event github.PullRequestEvent) (*repoSettings, error) {
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.settings.get(ctx, client, installationID, event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName())
+}
+
 func panicHandler(logger zerolog.Logger) error {
 	if err := recover(); err != nil {
 		logger.Error().Msgf("%v\n%s\n", err, debug.Stack())
@@ -223,7 +279,7 @@ func panicHandler(logger zerolog.Logger) error {
 	return nil
 }
 
-func (h *PullRequestHandler) addReviewChecklist(ctx context.Context, event github.PullRequestEvent, prInfo prInformation) (err error) {
+func (h *PullRequestHandler) addReviewChecklist(ctx context.Context, event github.PullRequestEvent, prInfo prInformation, settings *repoSettings) (err error) {
 	installationID := githubapp.GetInstallationIDFromEvent(&event)
 
 	client, err := h.NewInstallationClient(installationID)
@@ -239,7 +295,7 @@ func (h *PullRequestHandler) addReviewChecklist(ctx context.Context, event githu
 	}()
 
 	prComment := github.IssueComment{
-		Body: &h.reviewChecklist,
+		Body: &settings.reviewChecklist,
 	}
 
 	logger.Debug().Msgf("Adding review checklist to Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
@@ -249,7 +305,7 @@ func (h *PullRequestHandler) addReviewChecklist(ctx context.Context, event githu
 	return nil
 }
 
-func (h *PullRequestHandler) addLabels(ctx context.Context, event github.PullRequestEvent, prInfo prInformation) (err error) {
+func (h *PullRequestHandler) addLabels(ctx context.Context, event github.PullRequestEvent, prInfo prInformation, settings *repoSettings) (err error) {
 	installationID := githubapp.GetInstallationIDFromEvent(&event)
 	ctx, logger := githubapp.PreparePRContext(ctx, installationID, prInfo.repo, event.GetNumber())
 	defer func() {
@@ -272,7 +328,7 @@ func (h *PullRequestHandler) addLabels(ctx context.Context, event github.PullReq
 	}
 
 	logger.Debug().Msgf("Adding initial labels to Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
-	if _, _, err := client.Issues.AddLabelsToIssue(ctx, prInfo.repoOwner, prInfo.repoName, prInfo.num, alwaysAddLabels); err != nil {
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, prInfo.repoOwner, prInfo.repoName, prInfo.num, settings.Labels); err != nil {
 		logger.Error().Err(err).Msgf("Failed to add initial labels to Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
 	}
 	return nil
@@ -293,55 +349,50 @@ func (h *PullRequestHandler) createErrorDocumentation(ctx context.Context, event
 		}
 	}()
 
-	if prInfo.repoName != "vitess" {
+	if prInfo.repoName != h.cfg.Vitess.Name {
 		logger.Debug().Msgf("Pull Request %s/%s#%d is not on a vitess repo, skipping error generation", prInfo.repoOwner, prInfo.repoName, prInfo.num)
 		return nil
 	}
 
-	vitess := git.NewRepo(
-		prInfo.repoOwner,
-		prInfo.repoName,
-	).WithLocalDir(filepath.Join(h.Workdir(), "vitess"))
+	vitess := h.cfg.Vitess.repo(prInfo.repoOwner)
 
 	logger.Debug().Msgf("Listing changed files in Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
-	changeDetected, err := detectErrorCodeChanges(ctx, vitess, prInfo, client)
+	changeDetected, err := detectErrorCodeChanges(ctx, vitess, prInfo, client, h.cfg.ErrorCodes.File)
 	if err != nil {
-		logger.Err(err).Msg(err.Error())
-		return nil
+		return err
 	}
 	if !changeDetected {
-		logger.Debug().Msgf("No change detect to 'go/vt/vterrors/code.go' in Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
+		logger.Debug().Msgf("No change detect to '%s' in Pull Request %s/%s#%d", h.cfg.ErrorCodes.File, prInfo.repoOwner, prInfo.repoName, prInfo.num)
 		return nil
 	}
-	logger.Debug().Msgf("Change detect to 'go/vt/vterrors/code.go' in Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
+	logger.Debug().Msgf("Change detect to '%s' in Pull Request %s/%s#%d", h.cfg.ErrorCodes.File, prInfo.repoOwner, prInfo.repoName, prInfo.num)
 
-	h.vitessRepoLock.Lock()
-	vterrorsgenVitess, err := cloneVitessAndGenerateErrors(ctx, vitess, prInfo)
-	h.vitessRepoLock.Unlock()
+	job := fmt.Sprintf("error-code-%d", prInfo.num)
+	vitess, err = h.worktrees.Acquire(ctx, vitess.Owner, vitess.Name, vitess.DefaultBranch, job)
 	if err != nil {
-		logger.Err(err).Msg(err.Error())
-		return nil
+		return err
 	}
+	defer releaseRepo(ctx, h.worktrees, vitess)
 
-	website := git.NewRepo(
-		prInfo.repoOwner,
-		"website",
-	).WithLocalDir(filepath.Join(h.Workdir(), "website"))
+	vterrorsgenVitess, err := cloneVitessAndGenerateErrors(ctx, vitess, prInfo, h.cfg.ErrorCodes.Generator)
+	if err != nil {
+		return err
+	}
 
-	h.websiteRepoLock.Lock()
-	currentVersionDocs, err := cloneWebsiteAndGetCurrentVersionOfDocs(ctx, website, prInfo)
-	h.websiteRepoLock.Unlock()
+	website, err := h.worktrees.Acquire(ctx, prInfo.repoOwner, h.cfg.Website.Name, h.cfg.Website.DefaultBranch, job)
 	if err != nil {
-		logger.Err(err).Msg(err.Error())
-		return nil
+		return err
+	}
+	defer releaseRepo(ctx, h.worktrees, website)
+
+	currentVersionDocs, err := cloneWebsiteAndGetCurrentVersionOfDocs(ctx, website, prInfo, vitess.DefaultBranch)
+	if err != nil {
+		return err
 	}
 
-	h.websiteRepoLock.Lock()
 	errorDocContent, docPath, err := generateErrorCodeDocumentation(ctx, client, website, prInfo, currentVersionDocs, vterrorsgenVitess)
-	h.websiteRepoLock.Unlock()
 	if err != nil {
-		logger.Err(err).Msg(err.Error())
-		return nil
+		return err
 	}
 	if errorDocContent == "" {
 		logger.Debug().Msgf("No change detected in error code in Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
@@ -349,14 +400,12 @@ func (h *PullRequestHandler) createErrorDocumentation(ctx context.Context, event
 	}
 
 	err = createCommitAndPullRequestForErrorCode(ctx, website, prInfo, client, errorDocContent, docPath)
-	if err != nil {
-		logger.Err(err).Msg(err.Error())
-	}
-	return nil
+	stats.Inc("errordocs.prs", "result", stats.Result(err))
+	return err
 }
 
 func (h *PullRequestHandler) addArewefastyetComment(ctx context.Context, event github.PullRequestEvent, prInfo prInformation) (err error) {
-	if event.GetLabel().GetName() != "Benchmark me" {
+	if h.cfg.Labels.Benchmark == "" || event.GetLabel().GetName() != h.cfg.Labels.Benchmark {
 		return nil
 	}
 
@@ -417,14 +466,56 @@ func (h *PullRequestHandler) addArewefastyetComment(ctx context.Context, event g
 	return nil
 }
 
-func (h *PullRequestHandler) backportPR(ctx context.Context, event github.PullRequestEvent, prInfo prInformation) (err error) {
+func (h *PullRequestHandler) backportPR(ctx context.Context, event github.PullRequestEvent, prInfo prInformation, settings *repoSettings) (err error) {
 	installationID := githubapp.GetInstallationIDFromEvent(&event)
 
-	client, err := h.NewInstallationClient(installationID)
-	if err != nil {
-		return err
+	ctx, logger := githubapp.PreparePRContext(ctx, installationID, prInfo.repo, event.GetNumber())
+	defer func() {
+		if e := panicHandler(logger); e != nil {
+			err = e
+		}
+	}()
+
+	backportBranches, forwardportBranches, _ := portBranchesFromLabels(event.GetPullRequest(), settings)
+	if len(backportBranches) > 0 {
+		logger.Debug().Msgf("Will backport Pull Request %s/%s#%d to branches %v", prInfo.repoOwner, prInfo.repoName, prInfo.num, backportBranches)
+	}
+	if len(forwardportBranches) > 0 {
+		logger.Debug().Msgf("Will forwardport Pull Request %s/%s#%d to branches %v", prInfo.repoOwner, prInfo.repoName, prInfo.num, forwardportBranches)
 	}
 
+	for _, branch := range backportBranches {
+		if err := h.enqueuePort(ctx, installationID, prInfo, branch, backport, false); err != nil {
+			return err
+		}
+	}
+	for _, branch := range forwardportBranches {
+		if err := h.enqueuePort(ctx, installationID, prInfo, branch, forwardport, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// portLabeledPR checks the branch of the "Backport to: " or "Forwardport to: "
+// label that was just added to a Pull Request, and ports it right away if it is
+// already merged. Labels present at merge time are handled by backportPR
+// instead.
+func (h *PullRequestHandler) portLabeledPR(ctx context.Context, event github.PullRequestEvent, prInfo prInformation, settings *repoSettings) (err error) {
+	var branch, portType string
+	label := event.GetLabel().GetName()
+	switch {
+	case strings.HasPrefix(label, settings.BackportLabelPrefix):
+		branch, portType = strings.TrimPrefix(label, settings.BackportLabelPrefix), backport
+	case strings.HasPrefix(label, settings.ForwardportLabelPrefix):
+		branch, portType = strings.TrimPrefix(label, settings.ForwardportLabelPrefix), forwardport
+	default:
+		return nil
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+
 	ctx, logger := githubapp.PreparePRContext(ctx, installationID, prInfo.repo, event.GetNumber())
 	defer func() {
 		if e := panicHandler(logger); e != nil {
@@ -432,65 +523,128 @@ func (h *PullRequestHandler) backportPR(ctx context.Context, event github.PullRe
 		}
 	}()
 
-	pr, _, err := client.PullRequests.Get(ctx, prInfo.repoOwner, prInfo.repoName, prInfo.num)
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	reason, err := checkPortBranch(ctx, client, prInfo.repoOwner, prInfo.repoName, branch, settings)
 	if err != nil {
-		logger.Error().Err(err).Msgf("Failed to get Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
+		return err
+	}
+	if reason != "" {
+		logger.Debug().Msgf("Label %q of Pull Request %s/%s#%d is invalid: %s", label, prInfo.repoOwner, prInfo.repoName, prInfo.num, reason)
+		body := fmt.Sprintf("The label `%s` is invalid: %s. This Pull Request will not be %sed to it, please fix the label.", label, reason, portType)
+		if _, _, err := client.Issues.CreateComment(ctx, prInfo.repoOwner, prInfo.repoName, prInfo.num, &github.IssueComment{Body: &body}); err != nil {
+			return errors.Wrapf(err, "Failed to comment on invalid label %q of Pull Request %s/%s#%d", label, prInfo.repoOwner, prInfo.repoName, prInfo.num)
+		}
 		return nil
 	}
 
-	var (
-		backportBranches    []string // list of branches to which we must backport
-		forwardportBranches []string // list of branches to which we must forward-port
-		otherLabels         []string // will be used to apply the original PR's labels to the new PRs
-	)
+	if !prInfo.merged {
+		return nil
+	}
+
+	logger.Debug().Msgf("Will %s merged Pull Request %s/%s#%d to branch %s after label %q was added", portType, prInfo.repoOwner, prInfo.repoName, prInfo.num, branch, label)
+	return h.enqueuePort(ctx, installationID, prInfo, branch, portType, false)
+}
+
+// portBranchesFromLabels returns the branches to which a Pull Request must be
+// backported and forwardported according to its labels, along with its other
+// labels, which are applied to the new Pull Requests.
+func portBranchesFromLabels(pr *github.PullRequest, settings *repoSettings) (backportBranches, forwardportBranches, otherLabels []string) {
 	for _, label := range pr.Labels {
 		if label == nil {
 			continue
 		}
-		if strings.HasPrefix(label.GetName(), backportLabelPrefix) {
-			backportBranches = append(backportBranches, strings.Split(label.GetName(), backportLabelPrefix)[1])
-		} else if strings.HasPrefix(label.GetName(), forwardportLabelPrefix) {
-			forwardportBranches = append(forwardportBranches, strings.Split(label.GetName(), forwardportLabelPrefix)[1])
+		if strings.HasPrefix(label.GetName(), settings.BackportLabelPrefix) {
+			backportBranches = append(backportBranches, strings.TrimPrefix(label.GetName(), settings.BackportLabelPrefix))
+		} else if strings.HasPrefix(label.GetName(), settings.ForwardportLabelPrefix) {
+			forwardportBranches = append(forwardportBranches, strings.TrimPrefix(label.GetName(), settings.ForwardportLabelPrefix))
 		} else {
 			otherLabels = append(otherLabels, label.GetName())
 		}
 	}
 
-	if len(backportBranches) > 0 {
-		logger.Debug().Msgf("Will backport Pull Request %s/%s#%d to branches %v", prInfo.repoOwner, prInfo.repoName, prInfo.num, backportBranches)
-	}
-	if len(forwardportBranches) > 0 {
-		logger.Debug().Msgf("Will forwardport Pull Request %s/%s#%d to branches %v", prInfo.repoOwner, prInfo.repoName, prInfo.num, forwardportBranches)
+	return backportBranches, forwardportBranches, otherLabels
+}
+
+// portMergedPR ports the merged Pull Request pr to a single branch and returns
+// the number of the new Pull Request.
+func (h *PullRequestHandler) portMergedPR(
+	ctx context.Context,
+	client *github.Client,
+	prInfo prInformation,
+	pr *github.PullRequest,
+	branch, portType string,
+	labels []string,
+) (int, error) {
+	// The job is named after the branch of the port, so that ports and
+	// rebuilds of the same branch run one at a time.
+	vitessRepo, err := h.worktrees.Acquire(ctx, prInfo.repoOwner, prInfo.repoName, h.cfg.Vitess.DefaultBranch, portTarget{portType: portType, branch: branch}.headBranch(pr.GetNumber()))
+	if err != nil {
+		return 0, err
 	}
+	defer releaseRepo(ctx, h.worktrees, vitessRepo)
 
-	vitessRepo := git.NewRepo(
-		prInfo.repoOwner,
-		prInfo.repoName,
-	).WithLocalDir(filepath.Join(h.Workdir(), "vitess"))
-	mergedCommitSHA := pr.GetMergeCommitSHA()
+	return portPR(ctx, client, vitessRepo, prInfo, pr, pr.GetMergeCommitSHA(), branch, portType, labels)
+}
 
-	for _, branch := range backportBranches {
-		h.vitessRepoLock.Lock()
-		newPRID, err := portPR(ctx, client, vitessRepo, prInfo, pr, mergedCommitSHA, branch, backport, otherLabels)
-		h.vitessRepoLock.Unlock()
-		if err != nil {
-			logger.Err(err).Msg(err.Error())
-			continue
-		}
-		logger.Debug().Msgf("Opened backport Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, newPRID)
-	}
-	for _, branch := range forwardportBranches {
-		h.vitessRepoLock.Lock()
-		newPRID, err := portPR(ctx, client, vitessRepo, prInfo, pr, mergedCommitSHA, branch, forwardport, otherLabels)
-		h.vitessRepoLock.Unlock()
-		if err != nil {
-			logger.Err(err).Msg(err.Error())
-			continue
-		}
-		logger.Debug().Msgf("Opened forward Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, newPRID)
-	}
+// portCommand returns the slash-command used to backport or forwardport an
+// already merged Pull Request on demand.
+func (h *PullRequestHandler) portCommand(portType string) *command {
+	return &command{
+		name:    portType,
+		usage:   fmt.Sprintf("%s <branch> [<branch> ...]", portType),
+		help:    fmt.Sprintf("Create a %s of this merged Pull Request to each of the given branches.", portType),
+		allowed: maintainers,
+		run: func(ctx context.Context, client *github.Client, event github.IssueCommentEvent, args []string) error {
+			if len(args) == 0 {
+				return errors.Errorf("missing branch, usage: `%s %s <branch>`", commandPrefix, portType)
+			}
+
+			repo := event.GetRepo()
+			if repo.GetName() != h.cfg.Vitess.Name {
+				return errors.Errorf("%ss are only supported on %s", portType, h.cfg.Vitess.Name)
+			}
+
+			installationID := githubapp.GetInstallationIDFromEvent(&event)
+			settings, err := h.settings.get(ctx, client, installationID, repo.GetOwner().GetLogin(), repo.GetName())
+			if err != nil {
+				return err
+			}
+			if !settings.Features.Ports {
+				return errors.Errorf("%ss are disabled on %s/%s", portType, repo.GetOwner().GetLogin(), repo.GetName())
+			}
+
+			pr, _, err := client.PullRequests.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName(), event.GetIssue().GetNumber())
+			if err != nil {
+				return errors.Wrapf(err, "Failed to get Pull Request %s/%s#%d", repo.GetOwner().GetLogin(), repo.GetName(), event.GetIssue().GetNumber())
+			}
+
+			if !pr.GetMerged() {
+				return errors.Errorf("Pull Request #%d is not merged yet, it will be ported once merged if it has the right `%s` labels", pr.GetNumber(), strings.TrimSuffix(settings.BackportLabelPrefix, ": "))
+			}
+
+			prInfo := getPRInformationFromPR(repo, pr)
+			for _, branch := range args {
+				reason, err := checkPortBranch(ctx, client, repo.GetOwner().GetLogin(), repo.GetName(), branch, settings)
+				if err != nil {
+					return err
+				}
+				if reason != "" {
+					return errors.Errorf("cannot %s to `%s`: %s", portType, branch, reason)
+				}
+			}
+			for _, branch := range args {
+				if err := h.enqueuePort(ctx, installationID, prInfo, branch, portType, true); err != nil {
+					return err
+				}
+			}
 
-	return nil
+			return nil
+		},
+	}
 }
 
 var releaseBranchRegexp = regexp.MustCompile(`release-(\d+\.\d+)`)
@@ -501,7 +655,7 @@ func (h *PullRequestHandler) createDocsPreview(ctx context.Context, event github
 	// 	- vitessio/vitess:main
 	//	- vitessio/vitess:release-\d+\.\d+
 	// 2. PR contains changes to either `go/cmd/**/*.go` OR `go/flags/endtoend/*.txt`
-	if prInfo.base.GetRef() == "main" {
+	if prInfo.base.GetRef() == h.cfg.Vitess.DefaultBranch {
 		return h.previewCobraDocs(ctx, event, "main", prInfo)
 	} else if m := releaseBranchRegexp.FindStringSubmatch(prInfo.base.GetRef()); m != nil {
 		return h.previewCobraDocs(ctx, event, m[1], prInfo)
@@ -524,10 +678,7 @@ func (h *PullRequestHandler) previewCobraDocs(ctx context.Context, event github.
 		}
 	}()
 
-	vitess := git.NewRepo(
-		prInfo.repoOwner,
-		prInfo.repoName,
-	).WithLocalDir(filepath.Join(h.Workdir(), "vitess"))
+	vitess := h.cfg.Vitess.repo(prInfo.repoOwner)
 
 	docChanges, err := detectCobraDocChanges(ctx, vitess, client, prInfo)
 	if err != nil {
@@ -539,14 +690,22 @@ func (h *PullRequestHandler) previewCobraDocs(ctx context.Context, event github.
 		return nil
 	}
 
-	website := git.NewRepo(
-		prInfo.repoOwner,
-		"website",
-	).WithDefaultBranch("prod").WithLocalDir(
-		filepath.Join(h.Workdir(), "website"),
-	)
+	// Previews and synchronizations of the Pull Request share their branch.
+	job := cobraDocsSyncBranchName(prInfo.num)
+	vitess, err = h.worktrees.Acquire(ctx, vitess.Owner, vitess.Name, vitess.DefaultBranch, job)
+	if err != nil {
+		return err
+	}
+	defer releaseRepo(ctx, h.worktrees, vitess)
+
+	website, err := h.worktrees.Acquire(ctx, prInfo.repoOwner, h.cfg.Website.Name, h.cfg.Website.DefaultBranch, job)
+	if err != nil {
+		return err
+	}
+	defer releaseRepo(ctx, h.worktrees, website)
 
 	_, err = h.createCobraDocsPreviewPR(ctx, client, vitess, website, event.GetPullRequest(), docsVersion, prInfo)
+	stats.Inc("cobradocs.previews", "result", stats.Result(err))
 	return err
 }
 
@@ -562,7 +721,7 @@ func (h *PullRequestHandler) createCobraDocsPreviewPR(
 	logger := zerolog.Ctx(ctx)
 	// 1. Find an existing PR and switch to its branch, or create a new branch
 	// based on `prod`.
-	branch := "prod"
+	branch := website.DefaultBranch
 	headBranch := cobraDocsSyncBranchName(prInfo.num)
 	headRef := fmt.Sprintf("refs/heads/%s", headBranch)
 
@@ -634,7 +793,7 @@ func (h *PullRequestHandler) createCobraDocsPreviewPR(
 		logger.Debug().Msgf("Using existing PR #%d (%s/%s:%s)", openPR.GetNumber(), baseRepo.GetOwner().GetLogin(), baseRepo.GetName(), headBranch)
 
 		// 1a. If branch already existed, hard reset to `prod`.
-		if err := website.ResetHard(ctx, branch); err != nil {
+		if err := website.ResetHard(ctx, "origin/"+branch); err != nil {
 			return nil, errors.Wrapf(err, "Failed to reset %s to %s to %s for %s", headBranch, branch, op, pr.GetHTMLURL())
 		}
 	}
@@ -685,7 +844,7 @@ func (h *PullRequestHandler) createCobraDocsPreviewPR(
 			client,
 			website,
 			pr,
-			branch,
+			"origin/"+branch,
 			"HEAD",
 			baseTree,
 			parent,
@@ -777,8 +936,8 @@ func (h *PullRequestHandler) createCobraDocsPreviewPR(
 	}
 
 	// 8. In either case, make sure a do-not-merge label is on the website PR.
-	if _, _, err = client.Issues.AddLabelsToIssue(ctx, website.Owner, website.Name, openPR.GetNumber(), []string{doNotMergeLabel}); err != nil {
-		return nil, errors.Wrapf(err, "Failed to add %s label to %s", doNotMergeLabel, openPR.GetHTMLURL())
+	if _, _, err = client.Issues.AddLabelsToIssue(ctx, website.Owner, website.Name, openPR.GetNumber(), []string{h.cfg.Labels.DoNotMerge}); err != nil {
+		return nil, errors.Wrapf(err, "Failed to add %s label to %s", h.cfg.Labels.DoNotMerge, openPR.GetHTMLURL())
 	}
 
 	return openPR, nil
@@ -853,18 +1012,13 @@ func (h *PullRequestHandler) updateDocs(ctx context.Context, event github.PullRe
 		}
 	}()
 
-	website := git.NewRepo(
-		prInfo.repoOwner,
-		"website",
-	).WithDefaultBranch("prod").WithLocalDir(
-		filepath.Join(h.Workdir(), "website"),
-	)
+	website := h.cfg.Website.repo(prInfo.repoOwner)
 
 	// Checks:
 	// - is vitessio/vitess:main branch
 	// - PR contains changes to either `go/cmd/**/*.go` OR `go/flags/endtoend/*.txt` (TODO)
-	if prInfo.base.GetRef() != "main" {
-		logger.Debug().Msgf("PR %d is merged to %s, not main, skipping website cobradocs sync", prInfo.num, prInfo.base.GetRef())
+	if prInfo.base.GetRef() != h.cfg.Vitess.DefaultBranch {
+		logger.Debug().Msgf("PR %d is merged to %s, not the default branch, skipping website cobradocs sync", prInfo.num, prInfo.base.GetRef())
 		// Close any potentially open PR against website.
 		// (see https://github.com/vitessio/vitess-bot/issues/76).
 		prs, err := website.FindPRs(ctx, client, github.PullRequestListOptions{
@@ -896,10 +1050,7 @@ func (h *PullRequestHandler) updateDocs(ctx context.Context, event github.PullRe
 		return nil
 	}
 
-	vitess := git.NewRepo(
-		prInfo.repoOwner,
-		prInfo.repoName,
-	).WithLocalDir(filepath.Join(h.Workdir(), "vitess"))
+	vitess := h.cfg.Vitess.repo(prInfo.repoOwner)
 
 	docChanges, err := detectCobraDocChanges(ctx, vitess, client, prInfo)
 	if err != nil {
@@ -911,6 +1062,19 @@ func (h *PullRequestHandler) updateDocs(ctx context.Context, event github.PullRe
 		return nil
 	}
 
+	job := cobraDocsSyncBranchName(prInfo.num)
+	vitess, err = h.worktrees.Acquire(ctx, vitess.Owner, vitess.Name, vitess.DefaultBranch, job)
+	if err != nil {
+		return err
+	}
+	defer releaseRepo(ctx, h.worktrees, vitess)
+
+	website, err = h.worktrees.Acquire(ctx, website.Owner, website.Name, website.DefaultBranch, job)
+	if err != nil {
+		return err
+	}
+	defer releaseRepo(ctx, h.worktrees, website)
+
 	pr, err := h.synchronizeCobraDocs(ctx, client, vitess, website, event.GetPullRequest(), prInfo)
 	if err != nil {
 		return err
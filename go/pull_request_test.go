@@ -0,0 +1,262 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+const testChecklist = "## Review Checklist"
+
+// newTestPullRequestHandler returns a handler talking to the fake API, whose
+// jobs are enqueued, and only run by runJobs.
+func newTestPullRequestHandler(t *testing.T, gh *githubtest.Server) (*PullRequestHandler, *queue.Queue) {
+	t.Helper()
+
+	jobs, err := queue.New(t.TempDir())
+	require.NoError(t, err)
+	jobs.WithMaxAttempts(1)
+
+	h, err := NewPullRequestHandler(gh.ClientCreator(), defaultBotConfig(), jobs, git.NewWorktrees(t.TempDir()), testChecklist, githubtest.DefaultLogin)
+	require.NoError(t, err)
+
+	return h, jobs
+}
+
+// testPullRequestEvent returns a pull_request event for the Pull Request number
+// of the fake API.
+func testPullRequestEvent(t *testing.T, gh *githubtest.Server, action string, number int) []byte {
+	t.Helper()
+
+	pr := gh.PullRequest("vitessio", "vitess", number)
+	require.NotNil(t, pr)
+
+	payload, err := json.Marshal(github.PullRequestEvent{
+		Action:       github.String(action),
+		Number:       github.Int(number),
+		PullRequest:  pr,
+		Repo:         pr.GetBase().GetRepo(),
+		Installation: &github.Installation{ID: github.Int64(1)},
+	})
+	require.NoError(t, err)
+	return payload
+}
+
+// runJobs runs the jobs of the queue until none is pending or running.
+func runJobs(t *testing.T, jobs *queue.Queue) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	jobs.Run(ctx, 1)
+	require.NoError(t, jobs.Wait(ctx))
+}
+
+// jobSummaries describes the jobs of the queue as "operation args", sorted.
+func jobSummaries(jobs *queue.Queue) []string {
+	var summaries []string
+	for _, job := range jobs.Jobs() {
+		summary := job.Operation
+		if job.Args != nil {
+			summary += " " + job.Args["portType"] + " " + job.Args["branch"]
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Strings(summaries)
+	return summaries
+}
+
+func TestOpenedPullRequest(t *testing.T) {
+	tcases := []struct {
+		name     string
+		files    map[string]string
+		labels   []string
+		comments []string
+		added    []string
+		jobs     []string
+	}{
+		{
+			name:     "defaults",
+			comments: []string{testChecklist},
+			added:    defaultBotConfig().Labels.Always,
+			jobs:     []string{cobraDocsPreviewOperation, errorDocsOperation},
+		},
+		{
+			name:     "port",
+			labels:   []string{"Backport"},
+			comments: []string{testChecklist},
+			added:    []string{"Backport"},
+			jobs:     []string{cobraDocsPreviewOperation, errorDocsOperation},
+		},
+		{
+			name: "repository settings",
+			files: map[string]string{
+				repoSettingsPath:    "review_checklist: checklist.md\nlabels: [NeedsIssue]\nfeatures:\n  cobradocs: false\n",
+				"checklist.md":      "Custom checklist",
+				"unrelated/file.go": "package unrelated",
+			},
+			comments: []string{"Custom checklist"},
+			added:    []string{"NeedsIssue"},
+			jobs:     []string{errorDocsOperation},
+		},
+		{
+			name: "disabled features",
+			files: map[string]string{
+				repoSettingsPath: "features:\n  review_checklist: false\n  labels: false\n  cobradocs: false\n  error_code_docs: false\n",
+			},
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			gh := githubtest.NewServer(t)
+			gh.CreateBranch("vitessio", "vitess", "main", tc.files)
+
+			var labels []*github.Label
+			for _, label := range tc.labels {
+				labels = append(labels, &github.Label{Name: github.String(label)})
+			}
+			number := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				Title:  github.String("Add a feature"),
+				User:   &github.User{Login: github.String("contributor")},
+				Base:   &github.PullRequestBranch{Ref: github.String("main")},
+				Head:   &github.PullRequestBranch{Ref: github.String("feature")},
+				Labels: labels,
+			})
+
+			h, jobs := newTestPullRequestHandler(t, gh)
+			require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery", testPullRequestEvent(t, gh, "opened", number)))
+
+			assert.Equal(t, tc.comments, gh.Comments("vitessio", "vitess", number))
+			assert.ElementsMatch(t, tc.added, gh.Labels("vitessio", "vitess", number))
+			assert.Equal(t, tc.jobs, jobSummaries(jobs))
+		})
+	}
+}
+
+func TestLabeledPullRequest(t *testing.T) {
+	gh := githubtest.NewServer(t)
+	for _, branch := range []string{"main", "release-17.0", "release-18.0", "release-19.0", "release-20.0"} {
+		gh.CreateBranch("vitessio", "vitess", branch, nil)
+	}
+
+	number := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Title:  github.String("Fix a bug"),
+		Merged: github.Bool(true),
+		State:  github.String("closed"),
+		Base:   &github.PullRequestBranch{Ref: github.String("main")},
+		Head:   &github.PullRequestBranch{Ref: github.String("fix")},
+	})
+
+	h, jobs := newTestPullRequestHandler(t, gh)
+
+	label := func(name string) []byte {
+		gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+			r.Labels[number] = append(r.Labels[number], name)
+		})
+
+		var event github.PullRequestEvent
+		require.NoError(t, json.Unmarshal(testPullRequestEvent(t, gh, "labeled", number), &event))
+		event.Label = &github.Label{Name: github.String(name)}
+
+		payload, err := json.Marshal(event)
+		require.NoError(t, err)
+		return payload
+	}
+
+	// The benchmark comment is only added once.
+	payload := label("Benchmark me")
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-1", payload))
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-2", payload))
+	comments := gh.Comments("vitessio", "vitess", number)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0], "arewefastyet")
+
+	// Port labels added after the merge port the Pull Request right away.
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-3", label("Backport to: release-18.0")))
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-4", label("Forwardport to: release-20.0")))
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-5", label("Component: VTGate")))
+	assert.Equal(t, []string{
+		portOperation + " backport release-18.0",
+		portOperation + " forwardport release-20.0",
+	}, jobSummaries(jobs))
+
+	// Invalid port labels are reported instead of ported.
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-6", label("Backport to: release-18.1")))
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-7", label("Backport to: release-17.0")))
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-8", label("Forwardport to: main")))
+	assert.Len(t, jobs.Jobs(), 2)
+	assert.Equal(t, []string{
+		"The label `Backport to: release-18.1` is invalid: branch `release-18.1` does not exist. This Pull Request will not be backported to it, please fix the label.",
+		"The label `Backport to: release-17.0` is invalid: `release-17.0` is no longer supported, the supported release branches are `release-20.0`, `release-19.0`, `release-18.0`. This Pull Request will not be backported to it, please fix the label.",
+		"The label `Forwardport to: main` is invalid: `main` is not a release branch, release branches are named like `release-18.0`. This Pull Request will not be forwardported to it, please fix the label.",
+	}, gh.Comments("vitessio", "vitess", number)[1:])
+
+	for _, job := range jobs.Jobs() {
+		assert.Equal(t, "pull_request", job.EventType)
+		assert.Equal(t, number, job.Number)
+	}
+}
+
+func TestClosedPullRequest(t *testing.T) {
+	gh := githubtest.NewServer(t)
+	gh.CreateBranch("vitessio", "vitess", "main", nil)
+
+	labels := []*github.Label{
+		{Name: github.String("Backport to: release-18.0")},
+		{Name: github.String("Backport to: release-19.0")},
+		{Name: github.String("Forwardport to: release-20.0")},
+		{Name: github.String("Type: Bug")},
+	}
+	merged := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Merged: github.Bool(true),
+		State:  github.String("closed"),
+		Base:   &github.PullRequestBranch{Ref: github.String("main")},
+		Labels: labels,
+	})
+	closed := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		State:  github.String("closed"),
+		Base:   &github.PullRequestBranch{Ref: github.String("main")},
+		Labels: labels,
+	})
+
+	h, jobs := newTestPullRequestHandler(t, gh)
+
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-1", testPullRequestEvent(t, gh, "closed", closed)))
+	assert.Empty(t, jobs.Jobs())
+
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery-2", testPullRequestEvent(t, gh, "closed", merged)))
+	assert.Equal(t, []string{
+		portOperation + " backport release-18.0",
+		portOperation + " backport release-19.0",
+		portOperation + " forwardport release-20.0",
+	}, jobSummaries(jobs))
+}
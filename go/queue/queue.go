@@ -0,0 +1,602 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+
+	"github.com/vitess.io/vitess-bot/go/stats"
+)
+
+type Status string
+
+const (
+	Pending  Status = "pending"
+	Running  Status = "running"
+	Done     Status = "done"
+	Failed   Status = "failed"
+	Canceled Status = "canceled"
+)
+
+var (
+	// ErrNotFound is returned when acting on a job that is not in the queue.
+	ErrNotFound = errors.New("job not found")
+	// ErrInvalidStatus is returned when acting on a job whose status does not
+	// allow it, e.g. retrying a job that is still pending.
+	ErrInvalidStatus = errors.New("invalid job status")
+)
+
+// finished reports whether the job will not be run again unless retried.
+func (s Status) finished() bool {
+	return s == Done || s == Failed || s == Canceled
+}
+
+// Job is a unit of work derived from a webhook event, such as porting a Pull
+// Request to a branch.
+type Job struct {
+	ID        string `json:"id"`
+	Operation string `json:"operation"`
+
+	EventType      string            `json:"event_type,omitempty"`
+	DeliveryID     string            `json:"delivery_id,omitempty"`
+	InstallationID int64             `json:"installation_id,omitempty"`
+	Owner          string            `json:"owner,omitempty"`
+	Repo           string            `json:"repo,omitempty"`
+	Number         int               `json:"number,omitempty"`
+	Args           map[string]string `json:"args,omitempty"`
+	Payload        json.RawMessage   `json:"payload,omitempty"`
+	// Key, if set, makes the job run one at a time with the other jobs of the
+	// same key, e.g. the jobs merging the same Pull Request.
+	Key string `json:"key,omitempty"`
+
+	Status        Status    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+type deliveryKey struct{}
+
+type delivery struct {
+	eventType  string
+	deliveryID string
+}
+
+// WithDelivery returns a context carrying the webhook delivery being handled,
+// which is recorded on the jobs enqueued with it.
+func WithDelivery(ctx context.Context, eventType, deliveryID string) context.Context {
+	return context.WithValue(ctx, deliveryKey{}, delivery{eventType: eventType, deliveryID: deliveryID})
+}
+
+// Func runs a job. A non-nil error schedules a retry until the maximum number
+// of attempts is reached.
+type Func func(ctx context.Context, job *Job) error
+
+// Queue is a job queue persisted on disk, with one JSON file per job, so that
+// jobs survive restarts of the bot. Jobs that were running when the bot was
+// stopped are run again.
+type Queue struct {
+	dir string
+
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	retention   time.Duration
+
+	m      sync.Mutex
+	funcs  map[string]Func
+	jobs   map[string]*Job
+	lastID int64
+	wake   chan struct{}
+
+	// running holds the functions canceling the context of the running jobs.
+	running map[string]context.CancelFunc
+	// canceled holds the running jobs that were canceled.
+	canceled map[string]bool
+}
+
+// New returns a queue persisted in dir, loading any job already stored there.
+func New(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0777|os.ModeDir); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		dir:         dir,
+		maxAttempts: 5,
+		backoff:     30 * time.Second,
+		maxBackoff:  30 * time.Minute,
+		retention:   7 * 24 * time.Hour,
+		funcs:       map[string]Func{},
+		jobs:        map[string]*Job{},
+		wake:        make(chan struct{}, 1),
+		running:     map[string]context.CancelFunc{},
+		canceled:    map[string]bool{},
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read job file %s", file)
+		}
+
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse job file %s", file)
+		}
+
+		if job.Status == Running {
+			// The bot was stopped while running this job.
+			job.Status = Pending
+		}
+
+		q.jobs[job.ID] = &job
+	}
+
+	return q, nil
+}
+
+// WithMaxAttempts sets the number of times a job is run before being marked
+// as failed.
+func (q *Queue) WithMaxAttempts(n int) *Queue {
+	q.maxAttempts = n
+	return q
+}
+
+// WithBackoff sets the delay before the first retry of a failed job. The delay
+// doubles on each retry, up to max.
+func (q *Queue) WithBackoff(base, max time.Duration) *Queue {
+	q.backoff = base
+	q.maxBackoff = max
+	return q
+}
+
+// WithRetention sets how long finished jobs are kept on disk.
+func (q *Queue) WithRetention(retention time.Duration) *Queue {
+	q.retention = retention
+	return q
+}
+
+// Register sets the function used to run jobs of the given operation.
+//
+// Must be called before Run.
+func (q *Queue) Register(operation string, f Func) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.funcs[operation] = f
+}
+
+// Enqueue persists the job and schedules it to run as soon as possible.
+//
+// A job with a key is dropped if a job of the same operation, key and
+// arguments is pending and was not attempted yet, since that job is still to
+// run and does the same work.
+func (q *Queue) Enqueue(ctx context.Context, job *Job) error {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if job.Key != "" {
+		for _, pending := range q.jobs {
+			if pending.Status == Pending && pending.Attempts == 0 && pending.Operation == job.Operation && pending.Key == job.Key && maps.Equal(pending.Args, job.Args) {
+				zerolog.Ctx(ctx).Debug().Msgf("Job %s (%s) is already pending for %s", pending.ID, pending.Operation, pending.Key)
+				return nil
+			}
+		}
+	}
+
+	if d, ok := ctx.Value(deliveryKey{}).(delivery); ok {
+		if job.EventType == "" {
+			job.EventType = d.eventType
+		}
+		if job.DeliveryID == "" {
+			job.DeliveryID = d.deliveryID
+		}
+	}
+
+	now := time.Now()
+	id := now.UnixNano()
+	if id <= q.lastID {
+		id = q.lastID + 1
+	}
+	q.lastID = id
+
+	job.ID = fmt.Sprintf("%d", id)
+	job.Status = Pending
+	job.Attempts = 0
+	job.Error = ""
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	job.NextAttemptAt = now
+
+	if err := q.save(job); err != nil {
+		return err
+	}
+
+	q.jobs[job.ID] = job
+	q.notify()
+
+	return nil
+}
+
+// Run starts the given number of workers, which run jobs until ctx is done.
+func (q *Queue) Run(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		job, f, wait := q.next()
+		if job == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-q.wake:
+				timer.Stop()
+			case <-timer.C:
+			}
+
+			continue
+		}
+
+		// Let another worker pick up the next job, if any.
+		q.notify()
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		q.m.Lock()
+		q.running[job.ID] = cancel
+		if q.canceled[job.ID] {
+			// Canceled before it started.
+			cancel()
+		}
+		q.m.Unlock()
+
+		start := time.Now()
+		var err error
+		if f == nil {
+			err = errors.Errorf("no function registered for operation %s", job.Operation)
+		} else {
+			err = run(jobCtx, f, job)
+		}
+		cancel()
+		stats.Time(start, "jobs.duration", "operation", job.Operation, "result", stats.Result(err))
+
+		q.finish(ctx, job, err)
+	}
+}
+
+// run calls f, turning panics into errors so that a single job cannot take down
+// the worker.
+func run(ctx context.Context, f Func, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panic: %v", r)
+		}
+	}()
+
+	return f(ctx, job)
+}
+
+// next marks the next due job as running and returns a copy of it along with
+// its function. If no job is due, it returns how long to wait for the next one.
+func (q *Queue) next() (*Job, Func, time.Duration) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	now := time.Now()
+	wait := time.Minute
+
+	// Keys held by running jobs.
+	held := map[string]bool{}
+	for _, job := range q.jobs {
+		if job.Status == Running && job.Key != "" {
+			held[job.Key] = true
+		}
+	}
+
+	var next *Job
+	for _, job := range q.jobs {
+		if job.Status != Pending || held[job.Key] {
+			continue
+		}
+
+		if d := job.NextAttemptAt.Sub(now); d > 0 {
+			if d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		if next == nil || job.NextAttemptAt.Before(next.NextAttemptAt) || (job.NextAttemptAt.Equal(next.NextAttemptAt) && job.ID < next.ID) {
+			next = job
+		}
+	}
+
+	if next == nil {
+		return nil, nil, wait
+	}
+
+	next.Status = Running
+	next.Attempts++
+	next.UpdatedAt = now
+	_ = q.save(next)
+
+	job := *next
+	return &job, q.funcs[next.Operation], 0
+}
+
+func (q *Queue) finish(ctx context.Context, job *Job, err error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	stored, ok := q.jobs[job.ID]
+	if !ok {
+		return
+	}
+
+	delete(q.running, job.ID)
+	canceled := q.canceled[job.ID]
+	delete(q.canceled, job.ID)
+
+	logger := zerolog.Ctx(ctx)
+	now := time.Now()
+	stored.UpdatedAt = now
+
+	switch {
+	case canceled:
+		stored.Status = Canceled
+		if err != nil {
+			stored.Error = err.Error()
+		}
+	case err == nil:
+		stored.Status = Done
+		stored.Error = ""
+	case stored.Attempts >= q.maxAttempts:
+		stored.Status = Failed
+		stored.Error = err.Error()
+		logger.Error().Err(err).Msgf("Job %s (%s) failed after %d attempts", stored.ID, stored.Operation, stored.Attempts)
+	default:
+		backoff := q.backoff << (stored.Attempts - 1)
+		if backoff > q.maxBackoff || backoff <= 0 {
+			backoff = q.maxBackoff
+		}
+
+		stored.Status = Pending
+		stored.Error = err.Error()
+		stored.NextAttemptAt = now.Add(backoff)
+		logger.Warn().Err(err).Msgf("Job %s (%s) failed on attempt %d, retrying in %s", stored.ID, stored.Operation, stored.Attempts, backoff)
+	}
+
+	if err := q.save(stored); err != nil {
+		logger.Error().Err(err).Msgf("Failed to persist job %s", stored.ID)
+	}
+
+	if stored.Key != "" {
+		// Jobs of the same key may be waiting for this one.
+		q.notify()
+	}
+
+	q.prune(now)
+}
+
+// prune removes finished jobs older than the retention period.
+func (q *Queue) prune(now time.Time) {
+	for id, job := range q.jobs {
+		if !job.Status.finished() {
+			continue
+		}
+
+		if now.Sub(job.UpdatedAt) < q.retention {
+			continue
+		}
+
+		if err := os.Remove(q.path(id)); err != nil && !os.IsNotExist(err) {
+			continue
+		}
+
+		delete(q.jobs, id)
+	}
+}
+
+// Jobs returns a copy of all the jobs in the queue, most recent first.
+func (q *Queue) Jobs() []*Job {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		job := *job
+		jobs = append(jobs, &job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return strings.Compare(jobs[i].ID, jobs[j].ID) > 0
+	})
+
+	return jobs
+}
+
+// Wait blocks until no job is pending or running, or until ctx is done.
+func (q *Queue) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for q.count(Pending)+q.count(Running) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// RegisterMetrics adds gauges of the number of jobs in each status to r.
+func (q *Queue) RegisterMetrics(r metrics.Registry) {
+	for _, status := range []Status{Pending, Running, Done, Failed, Canceled} {
+		status := status
+		_ = r.Register(stats.Name("jobs", "status", string(status)), metrics.NewFunctionalGauge(func() int64 {
+			return q.count(status)
+		}))
+	}
+}
+
+func (q *Queue) count(status Status) (n int64) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for _, job := range q.jobs {
+		if job.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Job returns a copy of the job with the given ID.
+func (q *Queue) Job(id string) (*Job, error) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	stored, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	job := *stored
+	return &job, nil
+}
+
+// Retry schedules a finished job to run again as soon as possible, with a
+// fresh count of attempts.
+func (q *Queue) Retry(id string) error {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if !job.Status.finished() {
+		return errors.Wrapf(ErrInvalidStatus, "cannot retry %s job %s", job.Status, id)
+	}
+
+	now := time.Now()
+	job.Status = Pending
+	job.Attempts = 0
+	job.UpdatedAt = now
+	job.NextAttemptAt = now
+
+	if err := q.save(job); err != nil {
+		return err
+	}
+
+	q.notify()
+	return nil
+}
+
+// Cancel stops a job from being run again. If the job is running, its context
+// is canceled, and it is marked as canceled once its function returns.
+func (q *Queue) Cancel(id string) error {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	switch job.Status {
+	case Pending:
+		job.Status = Canceled
+		job.UpdatedAt = time.Now()
+		return q.save(job)
+	case Running:
+		q.canceled[id] = true
+		if cancel, ok := q.running[id]; ok {
+			cancel()
+		}
+		return nil
+	default:
+		return errors.Wrapf(ErrInvalidStatus, "cannot cancel %s job %s", job.Status, id)
+	}
+}
+
+func (q *Queue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+// save atomically writes the job to disk. Must be called with q.m held.
+func (q *Queue) save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal job %s", job.ID)
+	}
+
+	tmp, err := os.CreateTemp(q.dir, job.ID+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create file for job %s", job.ID)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "Failed to write job %s", job.ID)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "Failed to sync job %s", job.ID)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to close file for job %s", job.ID)
+	}
+
+	return os.Rename(tmp.Name(), q.path(job.ID))
+}
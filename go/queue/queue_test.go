@@ -0,0 +1,248 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitForStatus(t *testing.T, q *Queue, id string, status Status) *Job {
+	t.Helper()
+
+	var found *Job
+	require.Eventually(t, func() bool {
+		for _, job := range q.Jobs() {
+			if job.ID == id && job.Status == status {
+				found = job
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return found
+}
+
+func TestQueueRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := New(t.TempDir())
+	require.NoError(t, err)
+	q.WithBackoff(time.Millisecond, 10*time.Millisecond).WithMaxAttempts(3)
+
+	var calls atomic.Int32
+	q.Register("flaky", func(ctx context.Context, job *Job) error {
+		if calls.Add(1) < 2 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	q.Register("broken", func(ctx context.Context, job *Job) error {
+		return errors.New("permanent")
+	})
+	q.Run(ctx, 2)
+
+	flaky := &Job{Operation: "flaky", Number: 1}
+	require.NoError(t, q.Enqueue(ctx, flaky))
+	broken := &Job{Operation: "broken", Number: 2}
+	require.NoError(t, q.Enqueue(ctx, broken))
+
+	job := waitForStatus(t, q, flaky.ID, Done)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Empty(t, job.Error)
+
+	job = waitForStatus(t, q, broken.ID, Failed)
+	assert.Equal(t, 3, job.Attempts)
+	assert.Equal(t, "permanent", job.Error)
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := New(dir)
+	require.NoError(t, err)
+
+	job := &Job{Operation: "port", Owner: "vitessio", Repo: "vitess", Number: 42, Args: map[string]string{"branch": "release-18.0"}}
+	require.NoError(t, q.Enqueue(WithDelivery(context.Background(), "pull_request", "abc"), job))
+
+	// Simulate a job that was running when the bot was killed.
+	_, _, _ = q.next()
+
+	q, err = New(dir)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ran := make(chan *Job, 1)
+	q.Register("port", func(ctx context.Context, job *Job) error {
+		ran <- job
+		return nil
+	})
+	q.Run(ctx, 1)
+
+	select {
+	case got := <-ran:
+		assert.Equal(t, job.ID, got.ID)
+		assert.Equal(t, "release-18.0", got.Args["branch"])
+		assert.Equal(t, "abc", got.DeliveryID)
+		assert.Equal(t, 2, got.Attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not run after restart")
+	}
+
+	waitForStatus(t, q, job.ID, Done)
+}
+
+func TestQueueRetryAndCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := New(t.TempDir())
+	require.NoError(t, err)
+	q.WithMaxAttempts(1)
+
+	var fail atomic.Bool
+	fail.Store(true)
+	q.Register("flaky", func(ctx context.Context, job *Job) error {
+		if fail.Load() {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	started := make(chan struct{})
+	q.Register("slow", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.ErrorIs(t, q.Retry("unknown"), ErrNotFound)
+	assert.ErrorIs(t, q.Cancel("unknown"), ErrNotFound)
+
+	// A pending job is canceled right away, and can be retried later.
+	flaky := &Job{Operation: "flaky"}
+	require.NoError(t, q.Enqueue(ctx, flaky))
+	require.NoError(t, q.Cancel(flaky.ID))
+	job, err := q.Job(flaky.ID)
+	require.NoError(t, err)
+	assert.Equal(t, Canceled, job.Status)
+	assert.ErrorIs(t, q.Cancel(flaky.ID), ErrInvalidStatus)
+
+	q.Run(ctx, 2)
+	require.NoError(t, q.Retry(flaky.ID))
+	waitForStatus(t, q, flaky.ID, Failed)
+
+	fail.Store(false)
+	require.NoError(t, q.Retry(flaky.ID))
+	job = waitForStatus(t, q, flaky.ID, Done)
+	assert.Equal(t, 1, job.Attempts)
+
+	// A running job has its context canceled.
+	slow := &Job{Operation: "slow"}
+	require.NoError(t, q.Enqueue(ctx, slow))
+	<-started
+	assert.ErrorIs(t, q.Retry(slow.ID), ErrInvalidStatus)
+	require.NoError(t, q.Cancel(slow.ID))
+	job = waitForStatus(t, q, slow.ID, Canceled)
+	assert.Equal(t, context.Canceled.Error(), job.Error)
+}
+
+func TestQueueWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := New(t.TempDir())
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	q.Register("slow", func(ctx context.Context, job *Job) error {
+		<-release
+		return nil
+	})
+	q.Run(ctx, 1)
+
+	job := &Job{Operation: "slow"}
+	require.NoError(t, q.Enqueue(ctx, job))
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer waitCancel()
+	assert.ErrorIs(t, q.Wait(waitCtx), context.DeadlineExceeded)
+
+	close(release)
+	require.NoError(t, q.Wait(ctx))
+	waitForStatus(t, q, job.ID, Done)
+}
+
+func TestQueueKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := New(t.TempDir())
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	var running, maxRunning atomic.Int32
+	q.Register("merge", func(ctx context.Context, job *Job) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			max := maxRunning.Load()
+			if n <= max || maxRunning.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		<-release
+		return nil
+	})
+
+	// Jobs still to run absorb the identical ones.
+	first := &Job{Operation: "merge", Key: "vitessio/vitess#1"}
+	require.NoError(t, q.Enqueue(ctx, first))
+	require.NoError(t, q.Enqueue(ctx, &Job{Operation: "merge", Key: "vitessio/vitess#1"}))
+	other := &Job{Operation: "merge", Key: "vitessio/vitess#1", Args: map[string]string{"sha": "c0ffee"}}
+	require.NoError(t, q.Enqueue(ctx, other))
+	require.Len(t, q.Jobs(), 2)
+
+	q.Run(ctx, 2)
+	waitForStatus(t, q, first.ID, Running)
+
+	// Jobs of the same key do not run concurrently, even with idle workers.
+	time.Sleep(50 * time.Millisecond)
+	got, err := q.Job(other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, Pending, got.Status)
+
+	// Once it started, a job no longer absorbs the new ones.
+	again := &Job{Operation: "merge", Key: "vitessio/vitess#1"}
+	require.NoError(t, q.Enqueue(ctx, again))
+	require.Len(t, q.Jobs(), 3)
+
+	close(release)
+	require.NoError(t, q.Wait(ctx))
+	waitForStatus(t, q, other.ID, Done)
+	waitForStatus(t, q, again.ID, Done)
+	assert.Equal(t, int32(1), maxRunning.Load())
+}
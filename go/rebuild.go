@@ -0,0 +1,232 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/queue"
+	"github.com/vitess.io/vitess-bot/go/stats"
+)
+
+// rebuildCommand returns the slash-command rebuilding a conflicted port from
+// the current tip of its target branch, once the conflicts may have been
+// solved there.
+func (h *PullRequestHandler) rebuildCommand() *command {
+	return &command{
+		name:    "rebuild",
+		usage:   "rebuild",
+		help:    "Cherry-pick this conflicted port again on the tip of its branch, and take it out of draft if it is now clean.",
+		allowed: maintainers,
+		run: func(ctx context.Context, client *github.Client, event github.IssueCommentEvent, args []string) error {
+			repo := event.GetRepo()
+			if repo.GetName() != h.cfg.Vitess.Name {
+				return errors.Errorf("ports are only supported on %s", h.cfg.Vitess.Name)
+			}
+
+			installationID := githubapp.GetInstallationIDFromEvent(&event)
+			settings, err := h.settings.get(ctx, client, installationID, repo.GetOwner().GetLogin(), repo.GetName())
+			if err != nil {
+				return err
+			}
+			if !settings.Features.Ports {
+				return errors.Errorf("ports are disabled on %s/%s", repo.GetOwner().GetLogin(), repo.GetName())
+			}
+
+			pr, _, err := client.PullRequests.Get(ctx, repo.GetOwner().GetLogin(), repo.GetName(), event.GetIssue().GetNumber())
+			if err != nil {
+				return errors.Wrapf(err, "Failed to get Pull Request %s/%s#%d", repo.GetOwner().GetLogin(), repo.GetName(), event.GetIssue().GetNumber())
+			}
+
+			if pr.GetState() != "open" {
+				return errors.Errorf("Pull Request #%d is not open", pr.GetNumber())
+			}
+			if !portBranchRegexp.MatchString(pr.GetHead().GetRef()) {
+				return errors.Errorf("Pull Request #%d is not a port, its branch `%s` does not look like `%s-<number>-to-<branch>`", pr.GetNumber(), pr.GetHead().GetRef(), backport)
+			}
+			if !hasLabel(pr, mergeConflictLabel) {
+				return errors.Errorf("port #%d has no conflicts to solve, it does not have the `%s` label", pr.GetNumber(), mergeConflictLabel)
+			}
+
+			return h.jobs.Enqueue(ctx, &queue.Job{
+				Operation:      rebuildPortOperation,
+				InstallationID: installationID,
+				Owner:          repo.GetOwner().GetLogin(),
+				Repo:           repo.GetName(),
+				Number:         pr.GetNumber(),
+			})
+		},
+	}
+}
+
+// hasLabel tells whether pr has the label name.
+func hasLabel(pr *github.PullRequest, name string) bool {
+	for _, label := range pr.Labels {
+		if label.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runRebuildPortJob resets the branch of the conflicted port of the job to the
+// tip of its target branch, and cherry-picks the original Pull Request again.
+// If there are no more conflicts, the branch is force-pushed, and the port
+// taken out of draft and relieved of its conflict labels. Otherwise, the port
+// is left untouched and the remaining conflicts are reported.
+func (h *PullRequestHandler) runRebuildPortJob(ctx context.Context, job *queue.Job) (err error) {
+	client, err := h.NewInstallationClient(job.InstallationID)
+	if err != nil {
+		return err
+	}
+
+	port, _, err := client.PullRequests.Get(ctx, job.Owner, job.Repo, job.Number)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get Pull Request %s/%s#%d", job.Owner, job.Repo, job.Number)
+	}
+
+	portInfo := getPRInformationFromPR(port.GetBase().GetRepo(), port)
+	ctx, logger := githubapp.PreparePRContext(ctx, job.InstallationID, portInfo.repo, portInfo.num)
+	defer func() {
+		if e := panicHandler(logger); e != nil {
+			err = e
+		}
+	}()
+
+	headRef := port.GetHead().GetRef()
+	m := portBranchRegexp.FindStringSubmatch(headRef)
+	if m == nil {
+		return errors.Errorf("Pull Request %s/%s#%d is not a port, its branch is %s", job.Owner, job.Repo, job.Number, headRef)
+	}
+	portType, branch := m[1], m[3]
+	originalNumber, _ := strconv.Atoi(m[2])
+
+	conflicts, err := h.rebuildPort(ctx, client, job.Owner, job.Repo, port, originalNumber, branch)
+	switch {
+	case err != nil:
+		stats.Inc("ports.rebuilt", "result", "error")
+		return err
+	case len(conflicts) > 0:
+		stats.Inc("ports.rebuilt", "result", "conflict")
+		body := fmt.Sprintf("Rebuilt this %s on the tip of `%s`, but there are still conflicts. The branch was left as is.\n", portType, branch)
+		body += conflictReport(branch, conflicts)
+		if _, _, err := client.Issues.CreateComment(ctx, job.Owner, job.Repo, job.Number, &github.IssueComment{Body: &body}); err != nil {
+			return errors.Wrapf(err, "Failed to comment conflict notice on Pull Request %s/%s#%d", job.Owner, job.Repo, job.Number)
+		}
+		return nil
+	}
+	stats.Inc("ports.rebuilt", "result", "clean")
+
+	if port.GetDraft() {
+		if err := markReadyForReview(ctx, client, port.GetNodeID()); err != nil {
+			return errors.Wrapf(err, "Failed to mark Pull Request %s/%s#%d as ready for review", job.Owner, job.Repo, job.Number)
+		}
+	}
+
+	for _, label := range []string{mergeConflictLabel, skipCILabel} {
+		resp, err := client.Issues.RemoveLabelForIssue(ctx, job.Owner, job.Repo, job.Number, label)
+		if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+			return errors.Wrapf(err, "Failed to remove label %s from Pull Request %s/%s#%d", label, job.Owner, job.Repo, job.Number)
+		}
+	}
+
+	body := fmt.Sprintf("Rebuilt this %s on the tip of `%s` without conflicts.", portType, branch)
+	if _, _, err := client.Issues.CreateComment(ctx, job.Owner, job.Repo, job.Number, &github.IssueComment{Body: &body}); err != nil {
+		return errors.Wrapf(err, "Failed to comment rebuild notice on Pull Request %s/%s#%d", job.Owner, job.Repo, job.Number)
+	}
+
+	if err := h.updatePortStatus(ctx, client, job.InstallationID, job.Owner, job.Repo, originalNumber, portTarget{portType: portType, branch: branch}); err != nil {
+		logger.Error().Err(err).Msgf("Failed to update the port status of Pull Request %s/%s#%d", job.Owner, job.Repo, originalNumber)
+	}
+	return nil
+}
+
+// rebuildPort cherry-picks the Pull Request originalNumber again on the tip of
+// branch, on the branch of port. The branch is only pushed if there are no
+// conflicts, which are returned otherwise.
+func (h *PullRequestHandler) rebuildPort(ctx context.Context, client *github.Client, owner, name string, port *github.PullRequest, originalNumber int, branch string) ([]portConflict, error) {
+	original, _, err := client.PullRequests.Get(ctx, owner, name, originalNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get Pull Request %s/%s#%d", owner, name, originalNumber)
+	}
+	if !original.GetMerged() {
+		return nil, errors.Errorf("Pull Request %s/%s#%d is not merged", owner, name, originalNumber)
+	}
+	originalInfo := getPRInformationFromPR(original.GetBase().GetRepo(), original)
+
+	releaseRef, _, err := client.Git.GetRef(ctx, owner, name, fmt.Sprintf("heads/%s", branch))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get reference heads/%s on repository %s/%s", branch, owner, name)
+	}
+
+	headRef := port.GetHead().GetRef()
+	repo, err := h.worktrees.Acquire(ctx, owner, name, h.cfg.Vitess.DefaultBranch, headRef)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseRepo(ctx, h.worktrees, repo)
+
+	_, conflicts, err := cherryPickOnBranch(ctx, client, repo, originalInfo, original, original.GetMergeCommitSHA(), releaseRef, headRef)
+	if err != nil || len(conflicts) > 0 {
+		return conflicts, err
+	}
+
+	if err := repo.Push(ctx, git.PushOpts{
+		Remote: "origin",
+		Refs:   []string{headRef},
+		Force:  true,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "Failed to push %s to rebuild Pull Request %s/%s#%d", headRef, owner, name, port.GetNumber())
+	}
+	return nil, nil
+}
+
+// markReadyForReview takes the Pull Request of the given node ID out of draft.
+// The REST API cannot do it, only the GraphQL API can.
+func markReadyForReview(ctx context.Context, client *github.Client, nodeID string) error {
+	// The GraphQL endpoint is a sibling of the REST API root, both on
+	// github.com (api.github.com/graphql) and GitHub Enterprise
+	// (/api/graphql next to /api/v3/).
+	req, err := client.NewRequest(http.MethodPost, "../graphql", map[string]any{
+		"query":     "mutation($id: ID!) { markPullRequestReadyForReview(input: {pullRequestId: $id}) { pullRequest { isDraft } } }",
+		"variables": map[string]string{"id": nodeID},
+	})
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return errors.New(resp.Errors[0].Message)
+	}
+	return nil
+}
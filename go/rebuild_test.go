@@ -0,0 +1,173 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/git/gittest"
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+func TestRebuildCommand(t *testing.T) {
+	gh := githubtest.NewServer(t)
+	gh.CreateBranch("vitessio", "vitess", "main", nil)
+
+	conflicted := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Head:   &github.PullRequestBranch{Ref: github.String("backport-1-to-release-18.0")},
+		Labels: []*github.Label{{Name: github.String(mergeConflictLabel)}},
+	})
+	clean := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Head: &github.PullRequestBranch{Ref: github.String("backport-1-to-release-17.0")},
+	})
+	other := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+		Head:   &github.PullRequestBranch{Ref: github.String("fix")},
+		Labels: []*github.Label{{Name: github.String(mergeConflictLabel)}},
+	})
+
+	prHandler, jobs := newTestPullRequestHandler(t, gh)
+	h, err := NewIssueCommentHandler(gh.ClientCreator(), githubtest.DefaultLogin, prHandler.rebuildCommand())
+	require.NoError(t, err)
+
+	comment := func(number int, association string) {
+		payload, err := json.Marshal(github.IssueCommentEvent{
+			Action: github.String("created"),
+			Issue: &github.Issue{
+				Number:           github.Int(number),
+				PullRequestLinks: &github.PullRequestLinks{URL: github.String(fmt.Sprintf("https://api.github.com/repos/vitessio/vitess/pulls/%d", number))},
+			},
+			Comment: &github.IssueComment{
+				Body:              github.String("/vitess-bot rebuild"),
+				User:              &github.User{Login: github.String("maintainer")},
+				AuthorAssociation: github.String(association),
+			},
+			Repo:         &github.Repository{Name: github.String("vitess"), Owner: &github.User{Login: github.String("vitessio")}},
+			Installation: &github.Installation{ID: github.Int64(1)},
+		})
+		require.NoError(t, err)
+		require.NoError(t, h.Handle(context.Background(), "issue_comment", "delivery", payload))
+	}
+
+	comment(conflicted, "CONTRIBUTOR")
+	comment(clean, "MEMBER")
+	comment(other, "MEMBER")
+	assert.Equal(t, []string{"@maintainer, you are not allowed to run `/vitess-bot rebuild`."}, gh.Comments("vitessio", "vitess", conflicted))
+	assert.Equal(t, []string{"port #2 has no conflicts to solve, it does not have the `Merge Conflict` label"}, trimReplies(gh.Comments("vitessio", "vitess", clean)))
+	assert.Equal(t, []string{"Pull Request #3 is not a port, its branch `fix` does not look like `backport-<number>-to-<branch>`"}, trimReplies(gh.Comments("vitessio", "vitess", other)))
+	assert.Empty(t, jobs.Jobs())
+
+	comment(conflicted, "MEMBER")
+	require.Len(t, jobs.Jobs(), 1)
+	assert.Equal(t, rebuildPortOperation, jobs.Jobs()[0].Operation)
+	assert.Equal(t, conflicted, jobs.Jobs()[0].Number)
+}
+
+func TestRunRebuildPortJob(t *testing.T) {
+	ctx := context.Background()
+
+	tcases := []struct {
+		name string
+		// release is the new content of config.go on release-18.0 before the
+		// port is rebuilt.
+		release string
+		clean   bool
+	}{
+		{
+			name:    "solved",
+			release: "package config\n\nconst Version = 18\n",
+			clean:   true,
+		},
+		{
+			name:    "still conflicting",
+			release: "package config\n\nconst Version = 18.2\n",
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			gh := githubtest.NewServer(t)
+			origin := newTestOrigin(t, gh, root)
+			mergeSHA := origin.MergePR("main", "fix", "Fix a bug", map[string]string{"config.go": "package config\n\nconst Version = 19\n"})
+
+			number := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				Title:          github.String("Fix a bug"),
+				User:           &github.User{Login: github.String("author")},
+				State:          github.String("closed"),
+				Merged:         github.Bool(true),
+				MergeCommitSHA: github.String(mergeSHA),
+				Base:           &github.PullRequestBranch{Ref: github.String("main")},
+				Labels:         []*github.Label{{Name: github.String("Backport to: release-18.0")}},
+			})
+
+			h, _ := newTestPullRequestHandler(t, gh)
+			h.worktrees = git.NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+
+			require.NoError(t, h.runPortJob(ctx, &queue.Job{
+				InstallationID: 1,
+				Owner:          "vitessio",
+				Repo:           "vitess",
+				Number:         number,
+				Args:           map[string]string{"branch": "release-18.0", "portType": backport},
+			}))
+			port := gh.PullRequests("vitessio", "vitess")[1]
+			require.True(t, port.GetDraft())
+			conflictedRev := origin.Rev("backport-1-to-release-18.0")
+
+			origin.Commit("release-18.0", "Change the version", map[string]string{"config.go": tc.release})
+			gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+				r.Refs["heads/release-18.0"] = origin.Rev("release-18.0")
+			})
+
+			require.NoError(t, h.runRebuildPortJob(ctx, &queue.Job{
+				Operation:      rebuildPortOperation,
+				InstallationID: 1,
+				Owner:          "vitessio",
+				Repo:           "vitess",
+				Number:         port.GetNumber(),
+			}))
+
+			port = gh.PullRequest("vitessio", "vitess", port.GetNumber())
+			comments := gh.Comments("vitessio", "vitess", port.GetNumber())
+			require.Len(t, comments, 2)
+			if !tc.clean {
+				assert.True(t, port.GetDraft())
+				assert.Equal(t, []string{"Merge Conflict", "Skip CI", "Backport"}, gh.Labels("vitessio", "vitess", port.GetNumber()))
+				assert.Contains(t, comments[1], "Rebuilt this backport on the tip of `release-18.0`, but there are still conflicts.")
+				assert.Contains(t, comments[1], fmt.Sprintf("Cherry-picking %s conflicted in:\n- `config.go`: 1 conflicting hunk", mergeSHA))
+				assert.Equal(t, conflictedRev, origin.Rev("backport-1-to-release-18.0"))
+				return
+			}
+
+			assert.False(t, port.GetDraft())
+			assert.Equal(t, []string{"Backport"}, gh.Labels("vitessio", "vitess", port.GetNumber()))
+			assert.Equal(t, "Rebuilt this backport on the tip of `release-18.0` without conflicts.", comments[1])
+			assert.Equal(t, []string{"Merge branch 'fix'", "Change the version"}, origin.Log("backport-1-to-release-18.0", "release-18.0~1"))
+			assert.Equal(t, "package config\n\nconst Version = 19", origin.File("backport-1-to-release-18.0", "config.go"))
+		})
+	}
+}
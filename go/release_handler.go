@@ -22,15 +22,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
-	"sync"
 
 	"github.com/google/go-github/v53/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/queue"
 	"github.com/vitess.io/vitess-bot/go/semver"
 	"github.com/vitess.io/vitess-bot/go/shell"
 )
@@ -59,30 +60,31 @@ func getReleaseMetadata(event *github.ReleaseEvent) *releaseMetadata {
 
 type ReleaseHandler struct {
 	githubapp.ClientCreator
-	botLogin string
-
-	m sync.Mutex
+	cfg       *botConfig
+	botLogin  string
+	jobs      *queue.Queue
+	worktrees *git.Worktrees
 }
 
-func NewReleaseHandler(cc githubapp.ClientCreator, botLogin string) (h *ReleaseHandler, err error) {
+func NewReleaseHandler(cc githubapp.ClientCreator, cfg *botConfig, jobs *queue.Queue, worktrees *git.Worktrees, botLogin string) (h *ReleaseHandler, err error) {
 	h = &ReleaseHandler{
 		ClientCreator: cc,
+		cfg:           cfg,
 		botLogin:      botLogin,
+		jobs:          jobs,
+		worktrees:     worktrees,
 	}
-	err = os.MkdirAll(h.Workdir(), 0777|os.ModeDir)
 
-	return h, err
-}
+	jobs.Register(releaseCobraDocsOperation, h.runReleaseJob)
 
-func (h *ReleaseHandler) Workdir() string {
-	return filepath.Join("/", "tmp", "release_handler")
+	return h, err
 }
 
 func (h *ReleaseHandler) Handles() []string {
 	return []string{"release"}
 }
 
-func (h *ReleaseHandler) Handle(ctx context.Context, _, _ string, payload []byte) error {
+func (h *ReleaseHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
 	var event github.ReleaseEvent
 	if err := json.Unmarshal(payload, &event); err != nil {
 		return errors.Wrap(err, "Failed to parse release event payload")
@@ -91,7 +93,7 @@ func (h *ReleaseHandler) Handle(ctx context.Context, _, _ string, payload []byte
 	switch event.GetAction() {
 	case "published":
 		releaseMeta := getReleaseMetadata(&event)
-		if releaseMeta.repoName != "vitess" {
+		if releaseMeta.repoName != h.cfg.Vitess.Name {
 			return nil
 		}
 
@@ -99,25 +101,38 @@ func (h *ReleaseHandler) Handle(ctx context.Context, _, _ string, payload []byte
 			return nil
 		}
 
-		version, err := semver.Parse(releaseMeta.tag)
-		if err != nil { // release tag is not semver-compliant (which includes release candidates)
+		if _, err := semver.Parse(releaseMeta.tag); err != nil { // release tag is not semver-compliant (which includes release candidates)
 			return nil
 		}
 
-		client, err := h.NewInstallationClient(githubapp.GetInstallationIDFromEvent(&event))
-		if err != nil {
-			return err
-		}
+		return h.jobs.Enqueue(queue.WithDelivery(ctx, eventType, deliveryID), &queue.Job{
+			Operation:      releaseCobraDocsOperation,
+			InstallationID: githubapp.GetInstallationIDFromEvent(&event),
+			Owner:          releaseMeta.repoOwner,
+			Repo:           releaseMeta.repoName,
+			Args:           map[string]string{"tag": releaseMeta.tag},
+			Payload:        payload,
+		})
+	}
 
-		h.m.Lock()
-		defer h.m.Unlock()
+	return nil
+}
 
-		_, err = h.updateReleasedCobraDocs(ctx, client, releaseMeta, version)
-		if err != nil {
-			return err
-		}
+func (h *ReleaseHandler) updateReleasedCobraDocsForEvent(ctx context.Context, event github.ReleaseEvent) error {
+	releaseMeta := getReleaseMetadata(&event)
+	version, err := semver.Parse(releaseMeta.tag)
+	if err != nil {
+		return err
+	}
 
-		return nil
+	client, err := h.NewInstallationClient(githubapp.GetInstallationIDFromEvent(&event))
+	if err != nil {
+		return err
+	}
+
+	_, err = h.updateReleasedCobraDocs(ctx, client, releaseMeta, version)
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -129,24 +144,30 @@ func (h *ReleaseHandler) updateReleasedCobraDocs(
 	releaseMeta *releaseMetadata,
 	version semver.Version,
 ) (*github.PullRequest, error) {
-	vitess := git.NewRepo(
-		releaseMeta.repoOwner,
-		"vitess",
-	).WithLocalDir(filepath.Join(h.Workdir(), "vitess"))
-	website := git.NewRepo(
-		releaseMeta.repoOwner,
-		"website",
-	).WithLocalDir(filepath.Join(h.Workdir(), "website"))
+	// Each release builds on the Pull Request of the previous one, so they are
+	// synchronized one at a time.
+	job := "release-cobradocs"
+	vitess, err := h.worktrees.Acquire(ctx, releaseMeta.repoOwner, h.cfg.Vitess.Name, h.cfg.Vitess.DefaultBranch, job)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseRepo(ctx, h.worktrees, vitess)
+
+	website, err := h.worktrees.Acquire(ctx, releaseMeta.repoOwner, h.cfg.Website.Name, h.cfg.Website.DefaultBranch, job)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseRepo(ctx, h.worktrees, website)
 
 	logger := zerolog.Ctx(ctx)
-	branch := "prod"
+	branch := website.DefaultBranch
 	newBranch := fmt.Sprintf("update-release-cobradocs-for-%s", version.String())
 	op := "update release cobradocs"
 
 	prs, err := website.FindPRs(ctx, client, github.PullRequestListOptions{
 		State:     "open",
 		Head:      "update-release-cobradocs-for-",
-		Base:      "prod",
+		Base:      website.DefaultBranch,
 		Sort:      "created",
 		Direction: "desc",
 	}, func(pr *github.PullRequest) bool {
@@ -178,27 +199,17 @@ func (h *ReleaseHandler) updateReleasedCobraDocs(
 		return nil, errors.Wrapf(err, "Failed to fetch tags in repository %s/%s to %s for %s", vitess.Owner, vitess.Name, op, version.String())
 	}
 
-	awk, err := shell.NewContext(ctx,
-		"awk",
-		"-F\"",
-		"-e",
-		// This is extracting the value of the COBRADOC_VERSION_PAIRS from the Makefile.
-		// The line we're after looks like this:
-		//	export COBRADOC_VERSION_PAIRS="<this is what we want>"
-		//
-		// It's functionally equivalent to
-		//	grep "COBRADOC_VERSION_PAIRS=" Makefile | \
-		//		cut -d= -f2 | \
-		//		sed 's/"//g'
-		// but runs in a single shell command without requiring piping.
-		`$0 ~ /COBRADOC_VERSION_PAIRS="?([^"])"?/ { printf $2 }`,
-		"Makefile",
-	).InDir(website.LocalDir).Output()
+	makefile, err := os.ReadFile(filepath.Join(website.LocalDir, "Makefile"))
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to extract COBRADOC_VERSION_PAIRS from website Makefile")
+		return nil, errors.Wrap(err, "Failed to read website Makefile")
+	}
+
+	var pairs string
+	if match := versionPairsRegexp.FindSubmatch(makefile); match != nil {
+		pairs = string(match[1])
 	}
 
-	versionPairs, err := extractVersionPairsFromWebsite(string(awk))
+	versionPairs, err := extractVersionPairsFromWebsite(pairs)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to extract COBRADOC_VERSION_PAIRS from website Makefile")
 	}
@@ -206,7 +217,7 @@ func (h *ReleaseHandler) updateReleasedCobraDocs(
 	versionPairs = updateVersionPairs(versionPairs, version)
 
 	// Update the Makefile and author a commit.
-	if err := replaceVersionPairs(ctx, website, versionPairs); err != nil {
+	if err := replaceVersionPairs(website, versionPairs); err != nil {
 		return nil, errors.Wrapf(err, "Failed to update COBRADOC_VERSION_PAIRS in repository %s/%s to %s for %s", website.Owner, website.Name, op, version.String())
 	}
 
@@ -251,7 +262,7 @@ func (h *ReleaseHandler) updateReleasedCobraDocs(
 	newPR := &github.NewPullRequest{
 		Title:               github.String(fmt.Sprintf("[cobradocs] update released cobradocs with %s", version.String())),
 		Head:                github.String(newBranch),
-		Base:                github.String("prod"), // hard-coded since sometimes `branch` is a different base.
+		Base:                github.String(website.DefaultBranch), // not `branch`, since sometimes it is a different base.
 		Body:                github.String(fmt.Sprintf("## Description\nThis is an automated PR to update the released cobradocs with [%s](%s)", version.String(), releaseMeta.url)),
 		MaintainerCanModify: github.Bool(true),
 	}
@@ -263,6 +274,12 @@ func (h *ReleaseHandler) updateReleasedCobraDocs(
 	return newPRCreated, nil
 }
 
+// versionPairsRegexp matches the line of the website Makefile listing the
+// versions of the released cobradocs, capturing its value:
+//
+//	export COBRADOC_VERSION_PAIRS="<this is what we want>"
+var versionPairsRegexp = regexp.MustCompile(`(?m)^export COBRADOC_VERSION_PAIRS="?([^"\n]*)"?$`)
+
 type versionPair struct {
 	release semver.Version
 	tag     string
@@ -340,7 +357,7 @@ func updateVersionPairs(originalPairs []*versionPair, version semver.Version) (n
 	return newPairs
 }
 
-func replaceVersionPairs(ctx context.Context, website *git.Repo, versionPairs []*versionPair) error {
+func replaceVersionPairs(website *git.Repo, versionPairs []*versionPair) error {
 	slices.SortFunc(versionPairs, func(a, b *versionPair) int {
 		return -strings.Compare(a.docs, b.docs)
 	})
@@ -363,11 +380,12 @@ func replaceVersionPairs(ctx context.Context, website *git.Repo, versionPairs []
 		buf.Reset()
 	}
 
-	_, err := shell.NewContext(ctx,
-		"sed",
-		"-i", "",
-		"-e", fmt.Sprintf(`s/\(export COBRADOC_VERSION_PAIRS=\).*/\1%q/`, strings.Join(pairs, ",")),
-		"Makefile",
-	).InDir(website.LocalDir).Output()
-	return err
+	path := filepath.Join(website.LocalDir, "Makefile")
+	makefile, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	makefile = versionPairsRegexp.ReplaceAllLiteral(makefile, []byte(fmt.Sprintf("export COBRADOC_VERSION_PAIRS=%q", strings.Join(pairs, ","))))
+	return os.WriteFile(path, makefile, 0666)
 }
@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/git/gittest"
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+// testSyncCobraDocsScript stands for the sync script of the website, recording
+// the commit of vitess the cobradocs are synchronized with.
+const testSyncCobraDocsScript = `#!/bin/sh
+set -e
+git -C "$VITESS_DIR" rev-parse HEAD > cobradocs.txt
+git add cobradocs.txt
+git commit -q -m "Synchronize cobradocs"
+`
+
+func TestReleaseHandler(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	gh := githubtest.NewServer(t)
+
+	vitess := gittest.NewOrigin(t, root, "vitessio", "vitess", "main")
+	website := gittest.NewOrigin(t, root, "vitessio", "website", "prod")
+	website.Commit("prod", "Add the cobradocs", map[string]string{
+		"Makefile":                "build:\n\thugo\n\nexport COBRADOC_VERSION_PAIRS=\"main:19.0,v18.0.1:18.0,v17.0.5:17.0\"\n",
+		"tools/sync_cobradocs.sh": testSyncCobraDocsScript,
+	})
+	website.Git("update-index", "--chmod=+x", "tools/sync_cobradocs.sh")
+	website.Commit("prod", "Make the sync script executable", nil)
+
+	gh.Update("vitessio", "website", func(r *githubtest.Repo) {
+		r.Refs["heads/prod"] = website.Rev("prod")
+	})
+	gh.OnRefUpdate(func(owner, name, ref, sha string) {
+		if name == "website" {
+			website.SetRef(ref, sha)
+		}
+	})
+
+	jobs, err := queue.New(t.TempDir())
+	require.NoError(t, err)
+	worktrees := git.NewWorktrees(t.TempDir()).WithRemoteURLTemplate(gittest.RemoteURLTemplate(root))
+	h, err := NewReleaseHandler(gh.ClientCreator(), defaultBotConfig(), jobs, worktrees, githubtest.DefaultLogin)
+	require.NoError(t, err)
+
+	publish := func(tag string, draft bool) {
+		payload, err := json.Marshal(github.ReleaseEvent{
+			Action: github.String("published"),
+			Release: &github.RepositoryRelease{
+				TagName: github.String(tag),
+				Draft:   github.Bool(draft),
+				HTMLURL: github.String("https://github.com/vitessio/vitess/releases/tag/" + tag),
+			},
+			Repo:         &github.Repository{Name: github.String("vitess"), Owner: &github.User{Login: github.String("vitessio")}},
+			Installation: &github.Installation{ID: github.Int64(1)},
+		})
+		require.NoError(t, err)
+		require.NoError(t, h.Handle(ctx, "release", "delivery", payload))
+	}
+
+	publish("v18.0.2", true)
+	publish("not-a-version", false)
+	assert.Empty(t, jobs.Jobs())
+
+	publish("v18.0.2", false)
+	require.Len(t, jobs.Jobs(), 1)
+	require.NoError(t, h.runReleaseJob(ctx, jobs.Jobs()[0]))
+
+	pulls := gh.PullRequests("vitessio", "website")
+	require.Len(t, pulls, 1)
+	assert.Equal(t, "[cobradocs] update released cobradocs with 18.0.2", pulls[0].GetTitle())
+	assert.Equal(t, "update-release-cobradocs-for-18.0.2", pulls[0].GetHead().GetRef())
+	assert.Equal(t, "prod", pulls[0].GetBase().GetRef())
+	assert.Contains(t, pulls[0].GetBody(), "https://github.com/vitessio/vitess/releases/tag/v18.0.2")
+
+	assert.Equal(t, []string{
+		"Update released cobradocs with https://github.com/vitessio/vitess/releases/tag/v18.0.2",
+		"Update COBRADOC_VERSION_PAIRS for new release 18.0.2",
+	}, website.Log("update-release-cobradocs-for-18.0.2", "prod"))
+	assert.Equal(t, "build:\n\thugo\n\nexport COBRADOC_VERSION_PAIRS=\"main:19.0,v18.0.2:18.0,v17.0.5:17.0\"", website.File("update-release-cobradocs-for-18.0.2", "Makefile"))
+	assert.Equal(t, vitess.Rev("main"), website.File("update-release-cobradocs-for-18.0.2", "cobradocs.txt"))
+}
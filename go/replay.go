@@ -0,0 +1,355 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/vitess.io/vitess-bot/go/dryrun"
+	"github.com/vitess.io/vitess-bot/go/git"
+	"github.com/vitess.io/vitess-bot/go/queue"
+)
+
+// replayCommand is the subcommand replaying saved webhook deliveries.
+const replayCommand = "replay"
+
+// recordedDelivery is a webhook delivery saved on disk, either by the server
+// when DELIVERIES_DIR is set or by hand.
+type recordedDelivery struct {
+	EventType  string          `json:"event_type"`
+	DeliveryID string          `json:"delivery_id"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+const (
+	// deliveriesRetention is how long recorded deliveries are kept on disk.
+	deliveriesRetention = 7 * 24 * time.Hour
+	// deliveriesPruneInterval is how often the old deliveries are removed.
+	deliveriesPruneInterval = time.Hour
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// recordDeliveries saves every webhook delivery with a valid signature in dir
+// before passing it on to next, so that it can be replayed later. Deliveries
+// older than deliveriesRetention are removed now and every
+// deliveriesPruneInterval, until ctx is done.
+func recordDeliveries(ctx context.Context, dir, secret string, next http.Handler) (http.Handler, error) {
+	if err := os.MkdirAll(dir, 0777|os.ModeDir); err != nil {
+		return nil, errors.Wrapf(err, "Failed to create deliveries directory %s", dir)
+	}
+
+	if err := pruneDeliveries(dir, time.Now().Add(-deliveriesRetention)); err != nil {
+		return nil, errors.Wrapf(err, "Failed to prune deliveries directory %s", dir)
+	}
+
+	go func() {
+		ticker := time.NewTicker(deliveriesPruneInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := pruneDeliveries(dir, now.Add(-deliveriesRetention)); err != nil {
+					zerolog.Ctx(ctx).Error().Err(err).Msgf("Failed to prune deliveries directory %s", dir)
+				}
+			}
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Validate a copy of the request, the dispatcher validates the
+		// original one again.
+		validated := r.Clone(r.Context())
+		validated.Body = io.NopCloser(bytes.NewReader(body))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if payload, err := github.ValidatePayload(validated, []byte(secret)); err == nil {
+			d := &recordedDelivery{
+				EventType:  github.WebHookType(r),
+				DeliveryID: github.DeliveryID(r),
+				ReceivedAt: time.Now().UTC(),
+				Payload:    payload,
+			}
+			if err := saveDelivery(dir, d); err != nil {
+				zerolog.Ctx(r.Context()).Error().Err(err).Msgf("Failed to record delivery %s", d.DeliveryID)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}), nil
+}
+
+// saveDelivery writes d in dir, in a file whose name sorts by reception time.
+func saveDelivery(dir string, d *recordedDelivery) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s-%s.json", d.ReceivedAt.UnixNano(), unsafeFileChars.ReplaceAllString(d.EventType, "_"), unsafeFileChars.ReplaceAllString(d.DeliveryID, "_"))
+	return os.WriteFile(filepath.Join(dir, name), data, 0666)
+}
+
+// pruneDeliveries removes the deliveries saved in dir that were received
+// before the given time. Files not named by saveDelivery are left alone.
+func pruneDeliveries(dir string, before time.Time) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range matches {
+		received, _, ok := strings.Cut(filepath.Base(path), "-")
+		if !ok {
+			continue
+		}
+
+		nanos, err := strconv.ParseInt(received, 10, 64)
+		if err != nil || !time.Unix(0, nanos).Before(before) {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadDeliveries reads the deliveries at the given paths. Directories are
+// expanded to the JSON files they contain, sorted by name.
+//
+// A file is either a delivery recorded by the server, or a raw webhook payload
+// as shown on the "Recent Deliveries" page of the GitHub App, whose event type
+// is eventType.
+func loadDeliveries(paths []string, eventType string) ([]*recordedDelivery, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	deliveries := make([]*recordedDelivery, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read delivery %s", file)
+		}
+
+		d, err := parseDelivery(data, eventType)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid delivery %s", file)
+		}
+		if d.DeliveryID == "" {
+			d.DeliveryID = "replay-" + strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+func parseDelivery(data []byte, eventType string) (*recordedDelivery, error) {
+	var d recordedDelivery
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+
+	if d.Payload == nil {
+		// A raw webhook payload.
+		d = recordedDelivery{Payload: data}
+	}
+	if d.EventType == "" {
+		d.EventType = eventType
+	}
+	if d.EventType == "" {
+		return nil, errors.New("unknown event type, use -event to set it")
+	}
+	return &d, nil
+}
+
+// dispatchDelivery sends d to the webhook handler, signed with secret as
+// GitHub would.
+func dispatchDelivery(ctx context.Context, handler http.Handler, secret string, d *recordedDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", d.EventType)
+	req.Header.Set("X-GitHub-Delivery", d.DeliveryID)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(d.Payload)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return errors.Errorf("status %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	return nil
+}
+
+// replay runs the `replay` subcommand, which feeds saved webhook deliveries to
+// the same handlers as the server, one at a time, and runs the jobs they
+// enqueue before moving on to the next delivery.
+func replay(ctx context.Context, cfg *config, args []string) error {
+	fs := flag.NewFlagSet(replayCommand, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: vitess-bot %s [flags] <file or directory>...\n", replayCommand)
+		fs.PrintDefaults()
+	}
+	apiURL := fs.String("api-url", cfg.Github.V3APIURL, "base URL of the GitHub API the handlers talk to")
+	eventType := fs.String("event", "", "event type of raw webhook payloads, e.g. pull_request")
+	// Replaying a delivery runs its ports, comments and pushes again, so they
+	// are only performed when asked for explicitly.
+	dryRunFlag := fs.Bool("dry-run", true, "log mutations instead of performing them, -dry-run=false performs them")
+	timeout := fs.Duration("timeout", 10*time.Minute, "maximum time to wait for the jobs of each delivery")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no delivery to replay")
+	}
+
+	deliveries, err := loadDeliveries(fs.Args(), *eventType)
+	if err != nil {
+		return err
+	}
+
+	cfg.Github.V3APIURL = *apiURL
+	cfg.dryRun = *dryRunFlag
+
+	jobsDir, err := os.MkdirTemp("", "vitess-bot-replay-jobs")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(jobsDir)
+
+	jobs, err := queue.New(jobsDir)
+	if err != nil {
+		return err
+	}
+	// Failures are reported rather than retried.
+	jobs.WithMaxAttempts(1)
+
+	var dryRun *dryrun.Recorder
+	if cfg.dryRun {
+		dryRun = dryrun.New()
+	}
+
+	// Keep the clones across replays, they are slow to create.
+	worktrees := git.NewWorktrees(filepath.Join(os.TempDir(), "vitess-bot-replay")).
+		WithRemoteURLTemplate(cfg.remoteURLTemplate).
+		WithDryRun(dryRun)
+
+	handler, err := newWebhookHandler(cfg, dryRun, jobs, worktrees)
+	if err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs.Run(runCtx, jobWorkers)
+
+	logger := zerolog.Ctx(ctx)
+	var failed int
+	for _, d := range deliveries {
+		logger.Info().Msgf("Replaying %s delivery %s", d.EventType, d.DeliveryID)
+
+		seen := map[string]bool{}
+		for _, job := range jobs.Jobs() {
+			seen[job.ID] = true
+		}
+
+		if err := dispatchDelivery(ctx, handler, cfg.Github.App.WebhookSecret, d); err != nil {
+			failed++
+			logger.Error().Err(err).Msgf("Delivery %s failed", d.DeliveryID)
+			continue
+		}
+
+		waitCtx, waitCancel := context.WithTimeout(ctx, *timeout)
+		err := jobs.Wait(waitCtx)
+		waitCancel()
+		if err != nil {
+			return errors.Wrapf(err, "Failed to wait for the jobs of delivery %s", d.DeliveryID)
+		}
+
+		for _, job := range jobs.Jobs() {
+			if seen[job.ID] {
+				continue
+			}
+			if job.Status != queue.Done {
+				failed++
+				logger.Error().Msgf("Job %s (%s) of delivery %s %s: %s", job.ID, job.Operation, d.DeliveryID, job.Status, job.Error)
+				continue
+			}
+			logger.Info().Msgf("Job %s (%s) of delivery %s done", job.ID, job.Operation, d.DeliveryID)
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of the replayed deliveries and jobs failed", failed)
+	}
+	return nil
+}
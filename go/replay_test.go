@@ -0,0 +1,182 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingEventHandler struct {
+	deliveries []*recordedDelivery
+}
+
+func (h *recordingEventHandler) Handles() []string {
+	return []string{"pull_request"}
+}
+
+func (h *recordingEventHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h.deliveries = append(h.deliveries, &recordedDelivery{EventType: eventType, DeliveryID: deliveryID, Payload: payload})
+	return nil
+}
+
+func TestRecordAndReplayDeliveries(t *testing.T) {
+	const secret = "secret"
+	dir := t.TempDir()
+
+	recorded := &recordingEventHandler{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorder, err := recordDeliveries(ctx, dir, secret, githubapp.NewEventDispatcher([]githubapp.EventHandler{recorded}, secret))
+	require.NoError(t, err)
+
+	// A delivery with a valid signature is recorded and handled.
+	d := &recordedDelivery{EventType: "pull_request", DeliveryID: "abc-123", Payload: []byte(`{"action":"opened","number":1}`)}
+	require.NoError(t, dispatchDelivery(context.Background(), recorder, secret, d))
+
+	// One with an invalid signature is neither.
+	err = dispatchDelivery(context.Background(), recorder, "wrong", &recordedDelivery{EventType: "pull_request", DeliveryID: "def-456", Payload: []byte(`{}`)})
+	assert.Error(t, err)
+
+	require.Len(t, recorded.deliveries, 1)
+	assert.Equal(t, "abc-123", recorded.deliveries[0].DeliveryID)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0], "-pull_request-abc-123.json"), files[0])
+
+	// Replaying the recorded delivery hands the same payload to the handlers.
+	deliveries, err := loadDeliveries([]string{dir}, "")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+
+	replayed := &recordingEventHandler{}
+	dispatcher := githubapp.NewEventDispatcher([]githubapp.EventHandler{replayed}, secret)
+	require.NoError(t, dispatchDelivery(context.Background(), dispatcher, secret, deliveries[0]))
+
+	require.Len(t, replayed.deliveries, 1)
+	assert.Equal(t, "pull_request", replayed.deliveries[0].EventType)
+	assert.Equal(t, "abc-123", replayed.deliveries[0].DeliveryID)
+	assert.JSONEq(t, string(d.Payload), string(replayed.deliveries[0].Payload))
+}
+
+func TestPruneDeliveries(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	old := &recordedDelivery{EventType: "pull_request", DeliveryID: "old", ReceivedAt: now.Add(-deliveriesRetention - time.Hour), Payload: []byte(`{}`)}
+	recent := &recordedDelivery{EventType: "pull_request", DeliveryID: "recent", ReceivedAt: now.Add(-time.Hour), Payload: []byte(`{}`)}
+	require.NoError(t, saveDelivery(dir, old))
+	require.NoError(t, saveDelivery(dir, recent))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "by-hand.json"), []byte(`{}`), 0666))
+
+	require.NoError(t, pruneDeliveries(dir, now.Add(-deliveriesRetention)))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.True(t, strings.HasSuffix(files[0], "-pull_request-recent.json"), files[0])
+	assert.Equal(t, "by-hand.json", filepath.Base(files[1]))
+}
+
+func TestLoadDeliveries(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0666))
+		return path
+	}
+
+	recorded := write("1-recorded.json", `{"event_type":"release","delivery_id":"abc","payload":{"action":"published"}}`)
+	raw := write("2-raw.json", `{"action":"closed","number":2}`)
+
+	tcases := []struct {
+		name      string
+		paths     []string
+		eventType string
+		expected  []recordedDelivery
+		err       string
+	}{
+		{
+			name:  "recorded delivery",
+			paths: []string{recorded},
+			expected: []recordedDelivery{
+				{EventType: "release", DeliveryID: "abc", Payload: []byte(`{"action":"published"}`)},
+			},
+		},
+		{
+			name:      "raw payload",
+			paths:     []string{raw},
+			eventType: "pull_request",
+			expected: []recordedDelivery{
+				{EventType: "pull_request", DeliveryID: "replay-2-raw", Payload: []byte(`{"action":"closed","number":2}`)},
+			},
+		},
+		{
+			name:  "raw payload without event type",
+			paths: []string{raw},
+			err:   "unknown event type",
+		},
+		{
+			name:      "directory",
+			paths:     []string{dir},
+			eventType: "pull_request",
+			expected: []recordedDelivery{
+				{EventType: "release", DeliveryID: "abc", Payload: []byte(`{"action":"published"}`)},
+				{EventType: "pull_request", DeliveryID: "replay-2-raw", Payload: []byte(`{"action":"closed","number":2}`)},
+			},
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			deliveries, err := loadDeliveries(tc.paths, tc.eventType)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, deliveries, len(tc.expected))
+			for i, expected := range tc.expected {
+				assert.Equal(t, expected.EventType, deliveries[i].EventType)
+				assert.Equal(t, expected.DeliveryID, deliveries[i].DeliveryID)
+				assert.JSONEq(t, string(expected.Payload), string(deliveries[i].Payload))
+			}
+		})
+	}
+}
+
+func TestDispatchDeliveryError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	err := dispatchDelivery(context.Background(), handler, "", &recordedDelivery{EventType: "pull_request", Payload: []byte(`{}`)})
+	assert.EqualError(t, err, "status 500: boom")
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// repoSettingsPath is the file, on the default branch of a repository, that
+// customizes how the bot handles that repository.
+const repoSettingsPath = ".github/vitess-bot.yml"
+
+// repoSettingsTTL is how long the settings of a repository are cached before
+// being fetched again.
+const repoSettingsTTL = 5 * time.Minute
+
+// repoSettings is the configuration a repository gives the bot in
+// repoSettingsPath. Unset fields keep the value of the global configuration.
+type repoSettings struct {
+	// ReviewChecklistPath is the path, in the repository, of the review
+	// checklist commented on new Pull Requests.
+	ReviewChecklistPath string `yaml:"review_checklist"`
+	// Labels are added to every new Pull Request that is not a port.
+	Labels []string `yaml:"labels"`
+
+	BackportLabelPrefix    string `yaml:"backport_label_prefix"`
+	ForwardportLabelPrefix string `yaml:"forwardport_label_prefix"`
+	// SupportedReleases is the number of most recent release branches that
+	// Pull Requests can be ported to. 0 allows every release branch.
+	SupportedReleases int `yaml:"supported_releases"`
+	// AutoMergePorts makes the bot merge the ports it opened without
+	// conflicts, once they are approved and their checks pass.
+	AutoMergePorts bool `yaml:"auto_merge_ports"`
+
+	Features repoFeatures `yaml:"features"`
+
+	// reviewChecklist is the content of the review checklist.
+	reviewChecklist string
+}
+
+// repoFeatures enables or disables each of the things the bot does on a
+// repository. All the features are enabled by default.
+type repoFeatures struct {
+	ReviewChecklist bool `yaml:"review_checklist"`
+	Labels          bool `yaml:"labels"`
+	Ports           bool `yaml:"ports"`
+	PortStatus      bool `yaml:"port_status"`
+	PortLabels      bool `yaml:"port_labels"`
+	CobraDocs       bool `yaml:"cobradocs"`
+	ErrorCodeDocs   bool `yaml:"error_code_docs"`
+	Benchmark       bool `yaml:"benchmark"`
+}
+
+func defaultRepoSettings(cfg *botConfig, reviewChecklist string) *repoSettings {
+	return &repoSettings{
+		Labels:                 append([]string(nil), cfg.Labels.Always...),
+		BackportLabelPrefix:    backportLabelPrefix,
+		ForwardportLabelPrefix: forwardportLabelPrefix,
+		SupportedReleases:      supportedReleases,
+		Features: repoFeatures{
+			ReviewChecklist: true,
+			Labels:          true,
+			Ports:           true,
+			PortStatus:      true,
+			PortLabels:      true,
+			CobraDocs:       true,
+			ErrorCodeDocs:   true,
+			Benchmark:       true,
+		},
+		reviewChecklist: reviewChecklist,
+	}
+}
+
+// parseRepoSettings parses the YAML settings of a repository on top of the
+// given defaults.
+func parseRepoSettings(data []byte, defaults *repoSettings) (*repoSettings, error) {
+	s := *defaults
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if s.BackportLabelPrefix == "" || s.ForwardportLabelPrefix == "" {
+		return nil, errors.New("backport_label_prefix and forwardport_label_prefix must not be empty")
+	}
+	if s.BackportLabelPrefix == s.ForwardportLabelPrefix {
+		return nil, errors.Errorf("backport_label_prefix and forwardport_label_prefix must be different, got %q for both", s.BackportLabelPrefix)
+	}
+	if s.SupportedReleases < 0 {
+		return nil, errors.Errorf("supported_releases must not be negative, got %d", s.SupportedReleases)
+	}
+	return &s, nil
+}
+
+type repoSettingsKey struct {
+	installationID int64
+	owner, repo    string
+}
+
+type cachedRepoSettings struct {
+	settings  *repoSettings
+	fetchedAt time.Time
+}
+
+// repoSettingsCache caches the settings of the repositories of each
+// installation, so that they are not fetched on every event.
+type repoSettingsCache struct {
+	cfg             *botConfig
+	reviewChecklist string
+
+	m       sync.Mutex
+	entries map[repoSettingsKey]cachedRepoSettings
+}
+
+func newRepoSettingsCache(cfg *botConfig, reviewChecklist string) *repoSettingsCache {
+	return &repoSettingsCache{
+		cfg:             cfg,
+		reviewChecklist: reviewChecklist,
+		entries:         map[repoSettingsKey]cachedRepoSettings{},
+	}
+}
+
+// get returns the settings of the given repository, fetching them from its
+// default branch if they are not cached.
+//
+// Invalid settings are logged and replaced by the defaults, so that a bad
+// change to the settings file does not stop the bot from handling the
+// repository.
+func (c *repoSettingsCache) get(ctx context.Context, client *github.Client, installationID int64, owner, repo string) (*repoSettings, error) {
+	key := repoSettingsKey{installationID: installationID, owner: owner, repo: repo}
+
+	c.m.Lock()
+	entry, ok := c.entries[key]
+	c.m.Unlock()
+	if ok && time.Since(entry.fetchedAt) < repoSettingsTTL {
+		return entry.settings, nil
+	}
+
+	settings, err := c.fetch(ctx, client, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	c.m.Lock()
+	c.entries[key] = cachedRepoSettings{settings: settings, fetchedAt: time.Now()}
+	c.m.Unlock()
+
+	return settings, nil
+}
+
+func (c *repoSettingsCache) fetch(ctx context.Context, client *github.Client, owner, repo string) (*repoSettings, error) {
+	logger := zerolog.Ctx(ctx)
+	defaults := defaultRepoSettings(c.cfg, c.reviewChecklist)
+
+	data, found, err := getFileContent(ctx, client, owner, repo, repoSettingsPath)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return defaults, nil
+	}
+
+	settings, err := parseRepoSettings([]byte(data), defaults)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Invalid %s in %s/%s, using the default settings", repoSettingsPath, owner, repo)
+		return defaults, nil
+	}
+
+	if settings.ReviewChecklistPath != "" {
+		checklist, found, err := getFileContent(ctx, client, owner, repo, settings.ReviewChecklistPath)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			settings.reviewChecklist = checklist
+		} else {
+			logger.Error().Msgf("Review checklist %s not found in %s/%s, using the default one", settings.ReviewChecklistPath, owner, repo)
+		}
+	}
+
+	return settings, nil
+}
+
+// getFileContent returns the content of a file on the default branch of a
+// repository, and whether it exists.
+func getFileContent(ctx context.Context, client *github.Client, owner, repo, path string) (string, bool, error) {
+	file, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, path, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.Wrapf(err, "Failed to get %s in %s/%s", path, owner, repo)
+	}
+	if file == nil {
+		return "", false, errors.Errorf("%s in %s/%s is not a file", path, owner, repo)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return "", false, errors.Wrapf(err, "Failed to decode %s in %s/%s", path, owner, repo)
+	}
+	return content, true, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepoSettings(t *testing.T) {
+	defaults := defaultRepoSettings(defaultBotConfig(), "checklist")
+
+	settings, err := parseRepoSettings([]byte(`
+review_checklist: .github/review_checklist.md
+labels: [NeedsIssue]
+backport_label_prefix: "backport: "
+features:
+  cobradocs: false
+`), defaults)
+	require.NoError(t, err)
+
+	assert.Equal(t, ".github/review_checklist.md", settings.ReviewChecklistPath)
+	assert.Equal(t, []string{"NeedsIssue"}, settings.Labels)
+	assert.Equal(t, "backport: ", settings.BackportLabelPrefix)
+	assert.Equal(t, forwardportLabelPrefix, settings.ForwardportLabelPrefix)
+	assert.False(t, settings.Features.CobraDocs)
+	assert.True(t, settings.Features.Ports)
+	assert.Equal(t, supportedReleases, settings.SupportedReleases)
+	assert.Equal(t, "checklist", settings.reviewChecklist)
+
+	// The defaults are left untouched.
+	assert.Equal(t, defaultRepoSettings(defaultBotConfig(), "checklist"), defaults)
+
+	_, err = parseRepoSettings([]byte("feature:\n  ports: false\n"), defaults)
+	assert.ErrorContains(t, err, "field feature not found")
+
+	_, err = parseRepoSettings([]byte("forwardport_label_prefix: \"Backport to: \"\n"), defaults)
+	assert.ErrorContains(t, err, "must be different")
+
+	_, err = parseRepoSettings([]byte("supported_releases: -1\n"), defaults)
+	assert.ErrorContains(t, err, "must not be negative")
+}
+
+func TestPortBranchesFromLabels(t *testing.T) {
+	settings := defaultRepoSettings(defaultBotConfig(), "")
+	settings.ForwardportLabelPrefix = "Forward: "
+
+	pr := &github.PullRequest{
+		Labels: []*github.Label{
+			{Name: github.String("Backport to: release-18.0")},
+			{Name: github.String("Forward: release-19.0")},
+			{Name: github.String("Forwardport to: release-20.0")},
+			nil,
+			{Name: github.String("Component: VTGate")},
+		},
+	}
+
+	backports, forwardports, others := portBranchesFromLabels(pr, settings)
+	assert.Equal(t, []string{"release-18.0"}, backports)
+	assert.Equal(t, []string{"release-19.0"}, forwardports)
+	assert.Equal(t, []string{"Forwardport to: release-20.0", "Component: VTGate"}, others)
+}
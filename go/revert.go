@@ -0,0 +1,235 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/vitess.io/vitess-bot/go/git"
+)
+
+var (
+	// revertCommitRegexp matches the messages of the commits created by
+	// git revert.
+	revertCommitRegexp = regexp.MustCompile(`This reverts commit ([0-9a-f]{7,40})`)
+	// revertPRRegexp matches the body of the Pull Requests created by the
+	// "Revert" button of GitHub.
+	revertPRRegexp = regexp.MustCompile(`(?m)^Reverts (?:([\w.-]+)/([\w.-]+))?#(\d+)`)
+	// revertTitleRegexp matches the titles of reverts, capturing the number of
+	// the reverted Pull Request when the reverted title ends with it.
+	revertTitleRegexp = regexp.MustCompile(`^Revert "(?:.*\(#(\d+)\))?`)
+)
+
+// portRevert closes the open ports of the Pull Requests reverted by the
+// merged Pull Request of the event, and offers to port the revert to the
+// branches the reverted Pull Requests were already ported to.
+func (h *PullRequestHandler) portRevert(ctx context.Context, event github.PullRequestEvent, prInfo prInformation) (err error) {
+	pr := event.GetPullRequest()
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	ctx, logger := githubapp.PreparePRContext(ctx, installationID, prInfo.repo, event.GetNumber())
+	defer func() {
+		if e := panicHandler(logger); e != nil {
+			err = e
+		}
+	}()
+
+	settings, err := h.settings.get(ctx, client, installationID, prInfo.repoOwner, prInfo.repoName)
+	if err != nil {
+		return err
+	}
+
+	reverted, err := revertedPRs(ctx, client, prInfo, pr, h.cfg.Vitess.DefaultBranch)
+	if err != nil {
+		return err
+	}
+
+	// Ports of the revert already requested by its own labels.
+	revertTargets, _, err := portTargets(ctx, client, prInfo.repoOwner, prInfo.repoName, pr, settings)
+	if err != nil {
+		return err
+	}
+	requested := map[portTarget]bool{}
+	for _, target := range revertTargets {
+		requested[target] = true
+	}
+
+	var merged []portStatus
+	for _, original := range reverted {
+		logger.Debug().Msgf("Pull Request %s/%s#%d reverts #%d", prInfo.repoOwner, prInfo.repoName, prInfo.num, original.GetNumber())
+
+		targets, _, err := portTargets(ctx, client, prInfo.repoOwner, prInfo.repoName, original, settings)
+		if err != nil {
+			return err
+		}
+
+		for _, target := range targets {
+			// The CI state of the ports does not matter here.
+			port, err := findPortPR(ctx, client, prInfo.repoOwner, prInfo.repoName, original.GetNumber(), target)
+			if err != nil {
+				return err
+			}
+			status := portStatus{portTarget: target, pr: port}
+
+			switch {
+			case status.pr == nil:
+			case status.pr.MergedAt != nil:
+				if !requested[target] {
+					merged = append(merged, status)
+				}
+			case status.pr.GetState() == "open":
+				if err := closeRevertedPort(ctx, client, prInfo, original.GetNumber(), status.pr); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if len(merged) == 0 {
+		return nil
+	}
+
+	body := revertPortOffer(merged)
+	if _, _, err := client.Issues.CreateComment(ctx, prInfo.repoOwner, prInfo.repoName, prInfo.num, &github.IssueComment{Body: &body}); err != nil {
+		return errors.Wrapf(err, "Failed to comment on revert Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, prInfo.num)
+	}
+	return nil
+}
+
+// isRevert tells whether pr looks like a revert, from its title or body.
+func isRevert(pr *github.PullRequest) bool {
+	return strings.HasPrefix(pr.GetTitle(), "Revert") ||
+		revertCommitRegexp.MatchString(pr.GetBody()) ||
+		revertPRRegexp.MatchString(pr.GetBody())
+}
+
+// revertedPRs returns the merged Pull Requests of defaultBranch that the
+// revert Pull Request pr reverts, as told by its body, the messages of its
+// commits, or its title.
+func revertedPRs(ctx context.Context, client *github.Client, prInfo prInformation, pr *github.PullRequest, defaultBranch string) ([]*github.PullRequest, error) {
+	var numbers []int
+	for _, m := range revertPRRegexp.FindAllStringSubmatch(pr.GetBody(), -1) {
+		if m[1] != "" && (!strings.EqualFold(m[1], prInfo.repoOwner) || !strings.EqualFold(m[2], prInfo.repoName)) {
+			continue
+		}
+		number, _ := strconv.Atoi(m[3])
+		numbers = append(numbers, number)
+	}
+
+	messages := []string{pr.GetBody()}
+	commits, err := git.NewRepo(prInfo.repoOwner, prInfo.repoName).ListPRCommits(ctx, client, prInfo.num)
+	if err != nil {
+		return nil, err
+	}
+	for _, commit := range commits {
+		messages = append(messages, commit.GetCommit().GetMessage())
+	}
+
+	seenSHAs := map[string]bool{}
+	for _, message := range messages {
+		for _, m := range revertCommitRegexp.FindAllStringSubmatch(message, -1) {
+			sha := m[1]
+			if seenSHAs[sha] {
+				continue
+			}
+			seenSHAs[sha] = true
+
+			prs, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, prInfo.repoOwner, prInfo.repoName, sha, nil)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to list the Pull Requests of commit %s on %s/%s", sha, prInfo.repoOwner, prInfo.repoName)
+			}
+			for _, p := range prs {
+				numbers = append(numbers, p.GetNumber())
+			}
+		}
+	}
+
+	if m := revertTitleRegexp.FindStringSubmatch(pr.GetTitle()); len(numbers) == 0 && m != nil && m[1] != "" {
+		number, _ := strconv.Atoi(m[1])
+		numbers = append(numbers, number)
+	}
+
+	sort.Ints(numbers)
+	var reverted []*github.PullRequest
+	for i, number := range numbers {
+		if number == prInfo.num || (i > 0 && number == numbers[i-1]) {
+			continue
+		}
+
+		original, _, err := client.PullRequests.Get(ctx, prInfo.repoOwner, prInfo.repoName, number)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to get Pull Request %s/%s#%d", prInfo.repoOwner, prInfo.repoName, number)
+		}
+		if original.MergedAt == nil || original.GetBase().GetRef() != defaultBranch {
+			continue
+		}
+		reverted = append(reverted, original)
+	}
+
+	return reverted, nil
+}
+
+// closeRevertedPort closes the open port of a reverted Pull Request.
+func closeRevertedPort(ctx context.Context, client *github.Client, revertPRInfo prInformation, original int, port *github.PullRequest) error {
+	body := fmt.Sprintf("#%d was reverted by #%d, closing this port.", original, revertPRInfo.num)
+	if _, _, err := client.Issues.CreateComment(ctx, revertPRInfo.repoOwner, revertPRInfo.repoName, port.GetNumber(), &github.IssueComment{Body: &body}); err != nil {
+		return errors.Wrapf(err, "Failed to comment on reverted port %s/%s#%d", revertPRInfo.repoOwner, revertPRInfo.repoName, port.GetNumber())
+	}
+
+	if _, _, err := client.PullRequests.Edit(ctx, revertPRInfo.repoOwner, revertPRInfo.repoName, port.GetNumber(), &github.PullRequest{State: github.String("closed")}); err != nil {
+		return errors.Wrapf(err, "Failed to close reverted port %s/%s#%d", revertPRInfo.repoOwner, revertPRInfo.repoName, port.GetNumber())
+	}
+	return nil
+}
+
+// revertPortOffer lists the merged ports of the reverted Pull Requests, and
+// the commands porting the revert to the same branches.
+func revertPortOffer(merged []portStatus) string {
+	var b strings.Builder
+	b.WriteString("This reverts Pull Requests that were already ported:\n")
+
+	branches := map[string][]string{}
+	for _, status := range merged {
+		fmt.Fprintf(&b, "- #%d to `%s`\n", status.pr.GetNumber(), status.branch)
+		if !slices.Contains(branches[status.portType], status.branch) {
+			branches[status.portType] = append(branches[status.portType], status.branch)
+		}
+	}
+
+	b.WriteString("\nTo port this revert to the same branches, comment:\n")
+	for _, portType := range []string{backport, forwardport} {
+		if len(branches[portType]) > 0 {
+			fmt.Fprintf(&b, "```\n%s %s %s\n```\n", commandPrefix, portType, strings.Join(branches[portType], " "))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vitess.io/vitess-bot/go/githubtest"
+)
+
+func TestPortRevert(t *testing.T) {
+	tcases := []struct {
+		name   string
+		title  string
+		body   string
+		labels []*github.Label
+		// commit is the message of the commit of the revert.
+		commit string
+		// reverts tells whether the Pull Request is detected as a revert of
+		// the original one.
+		reverts bool
+		// offer is the expected comment on the revert, if any.
+		offer string
+	}{
+		{
+			name:    "git revert",
+			title:   "Revert the fix of a bug",
+			commit:  "Revert \"Fix a bug (#1)\"\n\nThis reverts commit 0123456789abcdef0123456789abcdef01234567.",
+			reverts: true,
+			offer:   "This reverts Pull Requests that were already ported:\n- #2 to `release-18.0`\n\nTo port this revert to the same branches, comment:\n```\n/vitess-bot backport release-18.0\n```\n",
+		},
+		{
+			name:    "revert button",
+			title:   "Revert \"Fix a bug\"",
+			body:    "Reverts vitessio/vitess#1",
+			reverts: true,
+			offer:   "This reverts Pull Requests that were already ported:\n- #2 to `release-18.0`\n\nTo port this revert to the same branches, comment:\n```\n/vitess-bot backport release-18.0\n```\n",
+		},
+		{
+			name:    "title",
+			title:   "Revert \"Fix a bug (#1)\"",
+			labels:  []*github.Label{{Name: github.String("Backport to: release-18.0")}},
+			reverts: true,
+		},
+		{
+			name:  "other repository",
+			title: "Revert \"Fix a bug\"",
+			body:  "Reverts vitessio/website#1",
+		},
+		{
+			name:  "not a revert",
+			title: "Fix another bug",
+			body:  "Follow-up of #1",
+		},
+	}
+
+	for _, tc := range tcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			gh := githubtest.NewServer(t)
+			for _, branch := range []string{"main", "release-17.0", "release-18.0"} {
+				gh.CreateBranch("vitessio", "vitess", branch, nil)
+			}
+
+			original := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				Title:          github.String("Fix a bug"),
+				State:          github.String("closed"),
+				Merged:         github.Bool(true),
+				MergeCommitSHA: github.String("0123456789abcdef0123456789abcdef01234567"),
+				Base:           &github.PullRequestBranch{Ref: github.String("main")},
+				Labels:         []*github.Label{{Name: github.String("Backport to: release-18.0")}, {Name: github.String("Backport to: release-17.0")}},
+			})
+			merged := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				Title:  github.String("[release-18.0] Fix a bug (#1)"),
+				State:  github.String("closed"),
+				Merged: github.Bool(true),
+				Base:   &github.PullRequestBranch{Ref: github.String("release-18.0")},
+				Head:   &github.PullRequestBranch{Ref: github.String("backport-1-to-release-18.0")},
+			})
+			open := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				Title: github.String("[release-17.0] Fix a bug (#1)"),
+				Draft: github.Bool(true),
+				Base:  &github.PullRequestBranch{Ref: github.String("release-17.0")},
+				Head:  &github.PullRequestBranch{Ref: github.String("backport-1-to-release-17.0")},
+			})
+
+			revert := gh.AddPullRequest("vitessio", "vitess", &github.PullRequest{
+				Title:  github.String(tc.title),
+				Body:   github.String(tc.body),
+				State:  github.String("closed"),
+				Merged: github.Bool(true),
+				Base:   &github.PullRequestBranch{Ref: github.String("main")},
+				Head:   &github.PullRequestBranch{Ref: github.String("revert")},
+				Labels: tc.labels,
+			})
+			if tc.commit != "" {
+				gh.Update("vitessio", "vitess", func(r *githubtest.Repo) {
+					r.PullCommits[revert] = []*github.RepositoryCommit{{
+						SHA:    github.String("89abcdef0123456789abcdef0123456789abcdef"),
+						Commit: &github.Commit{Message: github.String(tc.commit)},
+					}}
+				})
+			}
+
+			h, jobs := newTestPullRequestHandler(t, gh)
+			require.NoError(t, h.Handle(context.Background(), "pull_request", "delivery", testPullRequestEvent(t, gh, "closed", revert)))
+			assert.Empty(t, gh.Comments("vitessio", "vitess", open))
+
+			// Only the job of the revert is run, not the ports of its labels.
+			for _, job := range jobs.Jobs() {
+				if job.Operation == revertPortsOperation {
+					require.NoError(t, h.runPREventJob(h.portRevert)(context.Background(), job))
+				}
+			}
+			for _, request := range gh.Requests() {
+				assert.NotContains(t, request, "/check-runs")
+			}
+
+			assert.Empty(t, gh.Comments("vitessio", "vitess", merged))
+			if !tc.reverts {
+				assert.Equal(t, "open", gh.PullRequest("vitessio", "vitess", open).GetState())
+				assert.Empty(t, gh.Comments("vitessio", "vitess", open))
+				assert.Empty(t, gh.Comments("vitessio", "vitess", revert))
+				return
+			}
+
+			assert.Equal(t, "closed", gh.PullRequest("vitessio", "vitess", open).GetState())
+			assert.Equal(t, []string{"#1 was reverted by #4, closing this port."}, gh.Comments("vitessio", "vitess", open))
+			if tc.offer == "" {
+				assert.Empty(t, gh.Comments("vitessio", "vitess", revert))
+			} else {
+				assert.Equal(t, []string{tc.offer}, gh.Comments("vitessio", "vitess", revert))
+			}
+			assert.Len(t, gh.Comments("vitessio", "vitess", original), 0)
+		})
+	}
+}
@@ -21,6 +21,10 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/vitess.io/vitess-bot/go/stats"
 )
 
 type cmd exec.Cmd
@@ -85,6 +89,8 @@ func (c *cmd) WithExtraEnv(env ...string) *cmd {
 
 // Run runs the command and returns an error, capturing stderr, if any.
 func (c *cmd) Run() error {
+	defer c.time(time.Now())
+
 	err := (*exec.Cmd)(c).Run()
 	if err != nil {
 		return wrapErr(err, nil)
@@ -96,6 +102,8 @@ func (c *cmd) Run() error {
 // Output runs the command and returns the output from stdout. If any error
 // occurs, stderr is captured as well.
 func (c *cmd) Output() ([]byte, error) {
+	defer c.time(time.Now())
+
 	out, err := (*exec.Cmd)(c).Output()
 	if err != nil {
 		return nil, wrapErr(err, out)
@@ -104,6 +112,18 @@ func (c *cmd) Output() ([]byte, error) {
 	return out, nil
 }
 
+// time records the duration of the command, along with the git subcommand
+// when running git.
+func (c *cmd) time(start time.Time) {
+	name := filepath.Base(c.Path)
+	tags := []string{"command", name}
+	if name == "git" && len(c.Args) > 1 {
+		tags = append(tags, "subcommand", c.Args[1])
+	}
+
+	stats.Time(start, "shell.duration", tags...)
+}
+
 func wrapErr(err error, out []byte) error {
 	if execErr, ok := err.(*exec.ExitError); ok {
 		err := fmt.Errorf("%w\nstderr: %s", err, execErr.Stderr)
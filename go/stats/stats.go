@@ -0,0 +1,203 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package stats exports a go-metrics registry in the Prometheus text format.
+//
+// Metric names may carry tags using the `name[key:value,...]` convention of
+// githubapp.ClientMetrics, which are exported as Prometheus labels. For
+// example, `jobs.duration[operation:port]` is exported as
+// `vitess_bot_jobs_duration_seconds{operation="port"}`.
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Namespace prefixes the name of every exported metric.
+const Namespace = "vitess_bot"
+
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+// Name returns the name of a metric with the given tags, given as key/value
+// pairs.
+func Name(name string, tags ...string) string {
+	if len(tags) == 0 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(tags)/2)
+	for i := 0; i+1 < len(tags); i += 2 {
+		pairs = append(pairs, tags[i]+":"+tags[i+1])
+	}
+	return name + "[" + strings.Join(pairs, ",") + "]"
+}
+
+// Result returns the tag value describing the outcome of an operation.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Inc increments a counter of the default registry.
+func Inc(name string, tags ...string) {
+	metrics.GetOrRegisterCounter(Name(name, tags...), metrics.DefaultRegistry).Inc(1)
+}
+
+// Time records the time elapsed since start in a timer of the default
+// registry.
+func Time(start time.Time, name string, tags ...string) {
+	metrics.GetOrRegisterTimer(Name(name, tags...), metrics.DefaultRegistry).UpdateSince(start)
+}
+
+// Handler serves the metrics of the registry in the Prometheus text format.
+func Handler(r metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = Write(w, r)
+	})
+}
+
+type sample struct {
+	// series is the labels of the metric the sample belongs to, used to keep
+	// the samples of a summary together.
+	series string
+	suffix string
+	labels string
+	value  float64
+}
+
+type family struct {
+	name    string
+	typ     string
+	samples []sample
+}
+
+// Write writes the metrics of the registry in the Prometheus text format.
+func Write(w io.Writer, r metrics.Registry) error {
+	families := map[string]*family{}
+	add := func(name, typ string, s ...sample) {
+		f, ok := families[name]
+		if !ok {
+			f = &family{name: name, typ: typ}
+			families[name] = f
+		}
+		f.samples = append(f.samples, s...)
+	}
+
+	r.Each(func(rawName string, i any) {
+		name, labels := parseName(rawName)
+
+		switch m := i.(type) {
+		case metrics.Counter:
+			add(strings.TrimSuffix(name, "_total")+"_total", "counter", sample{series: labels, labels: labels, value: float64(m.Count())})
+		case metrics.Meter:
+			add(strings.TrimSuffix(name, "_total")+"_total", "counter", sample{series: labels, labels: labels, value: float64(m.Snapshot().Count())})
+		case metrics.Gauge:
+			add(name, "gauge", sample{series: labels, labels: labels, value: float64(m.Value())})
+		case metrics.GaugeFloat64:
+			add(name, "gauge", sample{series: labels, labels: labels, value: m.Value()})
+		case metrics.Timer:
+			s := m.Snapshot()
+			add(name+"_seconds", "summary", summary(labels, s.Percentiles(quantiles), s.Sum(), s.Count(), float64(time.Second))...)
+		case metrics.Histogram:
+			s := m.Snapshot()
+			add(name, "summary", summary(labels, s.Percentiles(quantiles), s.Sum(), s.Count(), 1)...)
+		}
+	})
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		sort.SliceStable(f.samples, func(i, j int) bool {
+			return f.samples[i].series < f.samples[j].series
+		})
+
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.samples {
+			labels := ""
+			if s.labels != "" {
+				labels = "{" + s.labels + "}"
+			}
+			fmt.Fprintf(bw, "%s%s%s %g\n", f.name, s.suffix, labels, s.value)
+		}
+	}
+	return bw.Flush()
+}
+
+func summary(labels string, percentiles []float64, sum, count int64, unit float64) []sample {
+	samples := make([]sample, 0, len(quantiles)+2)
+	for i, q := range quantiles {
+		samples = append(samples, sample{series: labels, labels: joinLabels(labels, fmt.Sprintf(`quantile="%g"`, q)), value: percentiles[i] / unit})
+	}
+	return append(samples,
+		sample{series: labels, suffix: "_sum", labels: labels, value: float64(sum) / unit},
+		sample{series: labels, suffix: "_count", labels: labels, value: float64(count)},
+	)
+}
+
+func joinLabels(labels ...string) string {
+	nonEmpty := labels[:0:0]
+	for _, l := range labels {
+		if l != "" {
+			nonEmpty = append(nonEmpty, l)
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
+
+var (
+	invalidNameChars  = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// parseName turns a `name[key:value,...]` metric name into a Prometheus
+// metric name and its labels.
+func parseName(raw string) (name, labels string) {
+	base, tags, _ := strings.Cut(raw, "[")
+	name = Namespace + "_" + strings.Trim(invalidNameChars.ReplaceAllString(base, "_"), "_")
+
+	tags = strings.TrimSuffix(tags, "]")
+	if tags == "" {
+		return name, ""
+	}
+
+	var pairs []string
+	for _, tag := range strings.Split(tags, ",") {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			key, value = "tag", tag
+		}
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, invalidNameChars.ReplaceAllString(key, "_"), labelValueEscaper.Replace(value)))
+	}
+	return name, strings.Join(pairs, ",")
+}
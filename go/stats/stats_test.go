@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "ports", Name("ports"))
+	assert.Equal(t, "ports[type:backport,result:created]", Name("ports", "type", "backport", "result", "created"))
+}
+
+func TestWrite(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter(Name("ports", "type", "backport", "result", "created"), r).Inc(2)
+	metrics.GetOrRegisterCounter(Name("ports", "type", "forwardport", "result", "conflict"), r).Inc(1)
+	metrics.GetOrRegisterCounter("github.requests.2xx", r).Inc(5)
+	metrics.GetOrRegisterGauge("github.rate.remaining[installation:42]", r).Update(4000)
+	metrics.GetOrRegisterTimer(Name("shell.duration", "command", `we"ird`), r).Update(2 * time.Second)
+
+	var buf strings.Builder
+	require.NoError(t, Write(&buf, r))
+
+	assert.Equal(t, strings.Join([]string{
+		`# TYPE vitess_bot_github_rate_remaining gauge`,
+		`vitess_bot_github_rate_remaining{installation="42"} 4000`,
+		`# TYPE vitess_bot_github_requests_2xx_total counter`,
+		`vitess_bot_github_requests_2xx_total 5`,
+		`# TYPE vitess_bot_ports_total counter`,
+		`vitess_bot_ports_total{type="backport",result="created"} 2`,
+		`vitess_bot_ports_total{type="forwardport",result="conflict"} 1`,
+		`# TYPE vitess_bot_shell_duration_seconds summary`,
+		`vitess_bot_shell_duration_seconds{command="we\"ird",quantile="0.5"} 2`,
+		`vitess_bot_shell_duration_seconds{command="we\"ird",quantile="0.9"} 2`,
+		`vitess_bot_shell_duration_seconds{command="we\"ird",quantile="0.99"} 2`,
+		`vitess_bot_shell_duration_seconds_sum{command="we\"ird"} 2`,
+		`vitess_bot_shell_duration_seconds_count{command="we\"ird"} 1`,
+		``,
+	}, "\n"), buf.String())
+}